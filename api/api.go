@@ -1,8 +1,11 @@
 package api
 
 import (
+	"encoding/json"
 	"fmt"
+	"log"
 	"net/http"
+	"scheduler-booking/data"
 	"scheduler-booking/service"
 
 	"github.com/go-chi/chi"
@@ -14,22 +17,50 @@ var Debug = true
 type API struct {
 	sAll   *service.ServiceAll
 	format *render.Render
+	auth   AuthConfig
 }
 
-func NewAPI(service *service.ServiceAll) *API {
+func NewAPI(service *service.ServiceAll, auth AuthConfig) *API {
 	format := render.New()
-	return &API{service, format}
+	if auth.Enabled && auth.Secret == "" && len(auth.APIKeys) == 0 {
+		log.Println("WARN: authentication is enabled without secret and API keys")
+	}
+
+	return &API{service, format, auth}
 }
 
 func (api *API) InitRoutes(r chi.Router) {
+	r.Use(api.authenticate)
+	admin := r.With(api.allow(RoleAdmin))
+	staff := r.With(api.allow(RoleAdmin, RoleDoctor))
+	users := r.With(api.allow(RoleAdmin, RoleDoctor, RolePatient))
 
 	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
 		api.response(w, "Server launched successfully!", nil)
 	})
 
 	r.Get("/units", func(w http.ResponseWriter, r *http.Request) {
-		units, err := api.sAll.Units.GetAll()
-		api.response(w, units, err)
+		from, to, err := intervalQuery(r)
+		if err != nil {
+			api.errResponse(w, err)
+			return
+		}
+
+		switch r.URL.Query().Get("mode") {
+		case "":
+			units, err := api.sAll.Units.GetAll(from, to)
+			api.response(w, units, err)
+		case "available":
+			serviceID, err := numberQuery(r, "service")
+			if err != nil {
+				api.errResponse(w, err)
+				return
+			}
+			units, err := api.sAll.Units.GetAvailableFor(from, to, serviceID)
+			api.response(w, units, err)
+		default:
+			api.errResponse(w, invalidParam("mode", "unknown mode %q", r.URL.Query().Get("mode")))
+		}
 	})
 
 	r.Get("/doctors", func(w http.ResponseWriter, r *http.Request) {
@@ -37,16 +68,118 @@ func (api *API) InitRoutes(r chi.Router) {
 		api.response(w, doctors, err)
 	})
 
-	r.Get("/doctors/worktime", func(w http.ResponseWriter, r *http.Request) {
-		data, err := api.sAll.Worktime.GetAll()
-		api.response(w, data, err)
+	r.Get("/doctors/{id}", func(w http.ResponseWriter, r *http.Request) {
+		id := numberParam(r, "id")
+		doctor, err := api.sAll.Doctors.GetOne(id)
+		api.response(w, doctor, err)
+	})
+
+	r.Get("/doctors/{id}/reviews", func(w http.ResponseWriter, r *http.Request) {
+		id := numberParam(r, "id")
+		reviews, err := api.sAll.Reviews.GetAll(id)
+		api.response(w, reviews, err)
+	})
+
+	r.Get("/doctors/{id}/services", func(w http.ResponseWriter, r *http.Request) {
+		id := numberParam(r, "id")
+		services, err := api.sAll.ServiceTypes.GetAll(id)
+		api.response(w, services, err)
+	})
+
+	admin.Post("/doctors/services", func(w http.ResponseWriter, r *http.Request) {
+		serviceType := service.ServiceTypeForm{}
+		err := parseForm(w, r, &serviceType)
+		if err != nil {
+			api.errResponse(w, err)
+			return
+		}
+		id, err := api.sAll.ServiceTypes.Add(serviceType)
+
+		api.response(w, &response{Action: "inserted", ID: id}, err)
+	})
+
+	admin.Put("/doctors/services/{id}", func(w http.ResponseWriter, r *http.Request) {
+		id := numberParam(r, "id")
+		serviceType := service.ServiceTypeForm{}
+		err := parseForm(w, r, &serviceType)
+		if err != nil {
+			api.errResponse(w, err)
+			return
+		}
+		err = api.sAll.ServiceTypes.Update(id, serviceType)
+
+		api.response(w, &response{Action: "updated"}, err)
+	})
+
+	admin.Delete("/doctors/services/{id}", func(w http.ResponseWriter, r *http.Request) {
+		id := numberParam(r, "id")
+		err := api.sAll.ServiceTypes.Delete(id)
+		api.response(w, &response{Action: "deleted"}, err)
+	})
+
+	admin.Post("/doctors", func(w http.ResponseWriter, r *http.Request) {
+		doctor := service.DoctorForm{}
+		err := parseForm(w, r, &doctor)
+		if err != nil {
+			api.errResponse(w, err)
+			return
+		}
+		id, err := api.sAll.Doctors.Add(doctor)
+
+		api.response(w, &response{Action: "inserted", ID: id}, err)
+	})
+
+	admin.Put("/doctors/{id}", func(w http.ResponseWriter, r *http.Request) {
+		id := numberParam(r, "id")
+		doctor := service.DoctorForm{}
+		err := parseForm(w, r, &doctor)
+		if err != nil {
+			api.errResponse(w, err)
+			return
+		}
+		err = api.sAll.Doctors.Update(id, doctor)
+
+		api.response(w, &response{Action: "updated"}, err)
 	})
 
-	r.Post("/doctors/worktime", func(w http.ResponseWriter, r *http.Request) {
+	admin.Delete("/doctors/{id}", func(w http.ResponseWriter, r *http.Request) {
+		id := numberParam(r, "id")
+		force := r.URL.Query().Get("force") == "true"
+		err := api.sAll.Doctors.Delete(id, force, api.actor(r))
+		api.response(w, &response{Action: "deleted"}, err)
+	})
+
+	staff.Get("/doctors/worktime", func(w http.ResponseWriter, r *http.Request) {
+		from, to, err := intervalQuery(r)
+		if err != nil {
+			api.errResponse(w, err)
+			return
+		}
+
+		data, err := api.sAll.Worktime.GetAll(from, to)
+		if err != nil {
+			api.errResponse(w, err)
+			return
+		}
+
+		own := make([]service.DoctorRoutineStr, 0, len(data))
+		for _, sch := range data {
+			if api.checkDoctor(r, sch.DoctorID) == nil {
+				own = append(own, sch)
+			}
+		}
+		api.response(w, own, nil)
+	})
+
+	staff.Post("/doctors/worktime", func(w http.ResponseWriter, r *http.Request) {
 		worktime := service.Worktime{}
 		err := parseForm(w, r, &worktime)
 		if err != nil {
-			api.errResponse(w, err.Error())
+			api.errResponse(w, err)
+			return
+		}
+		if err := api.checkDoctor(r, worktime.DoctorID); err != nil {
+			api.errResponse(w, err)
 			return
 		}
 		id, err := api.sAll.Worktime.Add(worktime)
@@ -62,12 +195,20 @@ func (api *API) InitRoutes(r chi.Router) {
 		}, err)
 	})
 
-	r.Put("/doctors/worktime/{id}", func(w http.ResponseWriter, r *http.Request) {
+	staff.Put("/doctors/worktime/{id}", func(w http.ResponseWriter, r *http.Request) {
 		id := numberParam(r, "id")
 		worktime := service.Worktime{}
 		err := parseForm(w, r, &worktime)
 		if err != nil {
-			api.errResponse(w, err.Error())
+			api.errResponse(w, err)
+			return
+		}
+		if err := api.checkSchedule(r, id); err != nil {
+			api.errResponse(w, err)
+			return
+		}
+		if err := api.checkDoctor(r, worktime.DoctorID); err != nil {
+			api.errResponse(w, err)
 			return
 		}
 		err = api.sAll.Worktime.Update(id, worktime)
@@ -75,41 +216,327 @@ func (api *API) InitRoutes(r chi.Router) {
 		api.response(w, &response{Action: "updated"}, err)
 	})
 
-	r.Delete("/doctors/worktime/{id}", func(w http.ResponseWriter, r *http.Request) {
+	staff.Delete("/doctors/worktime/{id}", func(w http.ResponseWriter, r *http.Request) {
 		id := numberParam(r, "id")
+		if err := api.checkSchedule(r, id); err != nil {
+			api.errResponse(w, err)
+			return
+		}
 		err := api.sAll.Worktime.Delete(id)
 		api.response(w, &response{Action: "deleted"}, err)
 	})
 
-	r.Get("/doctors/reservations", func(w http.ResponseWriter, r *http.Request) {
+	staff.Get("/doctors/timeoff", func(w http.ResponseWriter, r *http.Request) {
+		from, to, err := intervalQuery(r)
+		if err != nil {
+			api.errResponse(w, err)
+			return
+		}
+
+		timeOff, err := api.sAll.TimeOff.GetAll(from, to)
+		if err != nil {
+			api.errResponse(w, err)
+			return
+		}
+
+		own := make([]service.TimeOffStr, 0, len(timeOff))
+		for _, t := range timeOff {
+			if api.checkDoctor(r, t.DoctorID) == nil {
+				own = append(own, t)
+			}
+		}
+		api.response(w, own, nil)
+	})
+
+	staff.Post("/doctors/timeoff", func(w http.ResponseWriter, r *http.Request) {
+		timeOff := service.TimeOffForm{}
+		err := parseForm(w, r, &timeOff)
+		if err != nil {
+			api.errResponse(w, err)
+			return
+		}
+		if err := api.checkDoctor(r, timeOff.DoctorID); err != nil {
+			api.errResponse(w, err)
+			return
+		}
+		id, err := api.sAll.TimeOff.Add(timeOff)
+
+		api.response(w, &response{Action: "inserted", ID: id}, err)
+	})
+
+	staff.Put("/doctors/timeoff/{id}", func(w http.ResponseWriter, r *http.Request) {
+		id := numberParam(r, "id")
+		timeOff := service.TimeOffForm{}
+		err := parseForm(w, r, &timeOff)
+		if err != nil {
+			api.errResponse(w, err)
+			return
+		}
+		if err := api.checkTimeOff(r, id); err != nil {
+			api.errResponse(w, err)
+			return
+		}
+		if err := api.checkDoctor(r, timeOff.DoctorID); err != nil {
+			api.errResponse(w, err)
+			return
+		}
+		err = api.sAll.TimeOff.Update(id, timeOff)
+
+		api.response(w, &response{Action: "updated"}, err)
+	})
+
+	staff.Delete("/doctors/timeoff/{id}", func(w http.ResponseWriter, r *http.Request) {
+		id := numberParam(r, "id")
+		if err := api.checkTimeOff(r, id); err != nil {
+			api.errResponse(w, err)
+			return
+		}
+		err := api.sAll.TimeOff.Delete(id)
+		api.response(w, &response{Action: "deleted"}, err)
+	})
+
+	r.Get("/closures", func(w http.ResponseWriter, r *http.Request) {
+		from, to, err := intervalQuery(r)
+		if err != nil {
+			api.errResponse(w, err)
+			return
+		}
+
+		closures, err := api.sAll.Closures.GetAll(from, to)
+		api.response(w, closures, err)
+	})
+
+	admin.Post("/closures", func(w http.ResponseWriter, r *http.Request) {
+		closure := service.ClosureForm{}
+		err := parseForm(w, r, &closure)
+		if err != nil {
+			api.errResponse(w, err)
+			return
+		}
+		id, err := api.sAll.Closures.Add(closure)
+
+		api.response(w, &response{Action: "inserted", ID: id}, err)
+	})
+
+	admin.Put("/closures/{id}", func(w http.ResponseWriter, r *http.Request) {
+		id := numberParam(r, "id")
+		closure := service.ClosureForm{}
+		err := parseForm(w, r, &closure)
+		if err != nil {
+			api.errResponse(w, err)
+			return
+		}
+		err = api.sAll.Closures.Update(id, closure)
+
+		api.response(w, &response{Action: "updated"}, err)
+	})
+
+	admin.Delete("/closures/{id}", func(w http.ResponseWriter, r *http.Request) {
+		id := numberParam(r, "id")
+		err := api.sAll.Closures.Delete(id)
+		api.response(w, &response{Action: "deleted"}, err)
+	})
+
+	users.Get("/doctors/reservations", func(w http.ResponseWriter, r *http.Request) {
 		reservations, err := api.sAll.Reservations.GetAll()
-		api.response(w, reservations, err)
+		if err != nil {
+			api.errResponse(w, err)
+			return
+		}
+
+		own := make([]data.OccupiedSlot, 0, len(reservations))
+		for _, slot := range reservations {
+			if api.checkReservation(r, slot.DoctorID, slot.ClientEmail) == nil {
+				own = append(own, slot)
+			}
+		}
+		api.response(w, own, nil)
 	})
 
 	r.Post("/doctors/reservations", func(w http.ResponseWriter, r *http.Request) {
 		reservation := service.Reservation{}
 		err := parseForm(w, r, &reservation)
 		if err != nil {
-			api.errResponse(w, err.Error())
+			api.errResponse(w, err)
 			return
 		}
 		id, err := api.sAll.Reservations.Add(reservation)
 
 		api.response(w, &response{ID: id}, err)
 	})
+
+	r.Post("/doctors/reservations/holds", func(w http.ResponseWriter, r *http.Request) {
+		hold := service.Hold{}
+		err := parseForm(w, r, &hold)
+		if err != nil {
+			api.errResponse(w, err)
+			return
+		}
+		info, err := api.sAll.Reservations.Hold(hold)
+
+		api.response(w, info, err)
+	})
+
+	r.Delete("/doctors/reservations/holds/{token}", func(w http.ResponseWriter, r *http.Request) {
+		err := api.sAll.Reservations.ReleaseHold(chi.URLParam(r, "token"))
+		api.response(w, &response{Action: "deleted"}, err)
+	})
+
+	users.Put("/doctors/reservations/{id}", func(w http.ResponseWriter, r *http.Request) {
+		id := numberParam(r, "id")
+		rescheduling := service.Rescheduling{}
+		err := parseForm(w, r, &rescheduling)
+		if err != nil {
+			api.errResponse(w, err)
+			return
+		}
+		if err := api.checkReservationID(r, id); err != nil {
+			api.errResponse(w, err)
+			return
+		}
+		if id := identity(r); rescheduling.DoctorID != 0 && id != nil && id.Role == RoleDoctor {
+			// doctors can't move reservations to other doctors
+			if err := api.checkDoctor(r, rescheduling.DoctorID); err != nil {
+				api.errResponse(w, err)
+				return
+			}
+		}
+		err = api.sAll.Reservations.Reschedule(id, rescheduling, api.actor(r))
+
+		api.response(w, &response{Action: "updated"}, err)
+	})
+
+	users.Delete("/doctors/reservations/{id}", func(w http.ResponseWriter, r *http.Request) {
+		id := numberParam(r, "id")
+		if err := api.checkReservationID(r, id); err != nil {
+			api.errResponse(w, err)
+			return
+		}
+		err := api.sAll.Reservations.Cancel(id, api.actor(r))
+		api.response(w, &response{Action: "deleted"}, err)
+	})
+
+	r.Post("/doctors/reservations/{id}/review", func(w http.ResponseWriter, r *http.Request) {
+		id := numberParam(r, "id")
+		review := service.ReviewForm{}
+		err := parseForm(w, r, &review)
+		if err != nil {
+			api.errResponse(w, err)
+			return
+		}
+		reviewID, err := api.sAll.Reviews.Add(id, review)
+
+		api.response(w, &response{Action: "inserted", ID: reviewID}, err)
+	})
+
+	users.Get("/doctors/reservations/{id}/history", func(w http.ResponseWriter, r *http.Request) {
+		id := numberParam(r, "id")
+		if err := api.checkReservationID(r, id); err != nil {
+			api.errResponse(w, err)
+			return
+		}
+		history, err := api.sAll.Reservations.GetHistory(id)
+		api.response(w, history, err)
+	})
+
+	users.Get("/waitlist", func(w http.ResponseWriter, r *http.Request) {
+		doctorID, err := numberQuery(r, "doctor")
+		if err != nil {
+			api.errResponse(w, err)
+			return
+		}
+
+		entries, err := api.sAll.Waitlist.GetAll(doctorID)
+		if err != nil {
+			api.errResponse(w, err)
+			return
+		}
+
+		own := make([]service.WaitlistEntryStr, 0, len(entries))
+		for _, entry := range entries {
+			if api.checkReservation(r, entry.DoctorID, entry.ClientEmail) == nil {
+				own = append(own, entry)
+			}
+		}
+		api.response(w, own, nil)
+	})
+
+	r.Post("/waitlist", func(w http.ResponseWriter, r *http.Request) {
+		entry := service.WaitlistForm{}
+		err := parseForm(w, r, &entry)
+		if err != nil {
+			api.errResponse(w, err)
+			return
+		}
+		id, err := api.sAll.Waitlist.Add(entry)
+
+		api.response(w, &response{Action: "inserted", ID: id}, err)
+	})
+
+	users.Delete("/waitlist/{id}", func(w http.ResponseWriter, r *http.Request) {
+		id := numberParam(r, "id")
+		if err := api.checkWaitlistEntry(r, id); err != nil {
+			api.errResponse(w, err)
+			return
+		}
+		err := api.sAll.Waitlist.Delete(id)
+		api.response(w, &response{Action: "deleted"}, err)
+	})
+
+	// the token of the offer is the secret of the claim link
+	r.Post("/waitlist/claim/{token}", func(w http.ResponseWriter, r *http.Request) {
+		id, err := api.sAll.Waitlist.Claim(chi.URLParam(r, "token"))
+		api.response(w, &response{Action: "inserted", ID: id}, err)
+	})
 }
 
 func (api *API) response(w http.ResponseWriter, data any, err error) {
 	if err != nil {
-		api.errResponse(w, err.Error())
+		api.errResponse(w, err)
 	} else {
 		api.format.JSON(w, 200, data)
 	}
 }
 
-func (api *API) errResponse(w http.ResponseWriter, msg string) {
-	if Debug {
-		fmt.Println(msg)
+// error response in the format of RFC 7807
+type problem struct {
+	Type   string               `json:"type"`
+	Title  string               `json:"title"`
+	Status int                  `json:"status"`
+	Detail string               `json:"detail"`
+	Code   string               `json:"code"` // stable machine-readable code
+	Errors []service.FieldError `json:"errors,omitempty"`
+}
+
+var kindStatus = map[service.ErrorKind]int{
+	service.KindBadRequest:   http.StatusBadRequest,
+	service.KindValidation:   http.StatusUnprocessableEntity,
+	service.KindNotFound:     http.StatusNotFound,
+	service.KindConflict:     http.StatusConflict,
+	service.KindExpired:      http.StatusUnprocessableEntity,
+	service.KindUnauthorized: http.StatusUnauthorized,
+	service.KindForbidden:    http.StatusForbidden,
+}
+
+func (api *API) errResponse(w http.ResponseWriter, err error) {
+	e := service.AsError(err)
+
+	status, ok := kindStatus[e.Kind]
+	if !ok {
+		status = http.StatusInternalServerError
+		log.Printf("ERROR: %v", err)
+	} else if Debug {
+		fmt.Println(err)
 	}
-	api.format.Text(w, 500, msg)
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: e.Message,
+		Code:   e.Code,
+		Errors: e.Fields,
+	})
 }
@@ -0,0 +1,873 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"scheduler-booking/data"
+	"scheduler-booking/service"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+)
+
+func newTestServer(t *testing.T) (*httptest.Server, *data.DAO) {
+	return newAuthTestServer(t, AuthConfig{})
+}
+
+func newAuthTestServer(t *testing.T, auth AuthConfig) (*httptest.Server, *data.DAO) {
+	Debug = false
+
+	dao := data.NewDAO(data.DBConfig{Path: filepath.Join(t.TempDir(), "db.sqlite")})
+
+	r := chi.NewRouter()
+	NewAPI(service.NewService(dao.Repositories, service.Config{HoldTime: 10, Window: 60}), auth).InitRoutes(r)
+
+	server := httptest.NewServer(r)
+	t.Cleanup(server.Close)
+
+	return server, dao
+}
+
+// creates a doctor who works every day around the clock
+func addTestDoctor(t *testing.T, dao *data.DAO) data.Doctor {
+	doctor := data.Doctor{
+		Name:     "Dr. Test",
+		Category: "Therapist",
+		SlotSize: 30,
+		Price:    "$10",
+		DoctorSchedule: []data.DoctorSchedule{
+			{
+				From:     0,
+				To:       24 * 60,
+				Date:     data.SystemClock.Today().UnixMilli(),
+				Rrule:    "FREQ=DAILY",
+				Duration: 24 * 60 * 60,
+			},
+		},
+	}
+
+	err := dao.GetDB().Create(&doctor).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return doctor
+}
+
+func TestConcurrentReservations(t *testing.T) {
+	server, dao := newTestServer(t)
+	doctor := addTestDoctor(t, dao)
+
+	// tomorrow 10:00
+	date := data.SystemClock.Today().Add(24*time.Hour + 10*time.Hour).UnixMilli()
+
+	const clients = 20
+	statuses := make(chan int, clients)
+	var wg sync.WaitGroup
+	for i := 0; i < clients; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			body, _ := json.Marshal(service.Reservation{
+				DoctorID: doctor.ID,
+				Date:     date,
+				Form:     service.ReservationForm{Name: "Client", Email: "client@scheduler.booking"},
+			})
+
+			res, err := http.Post(server.URL+"/doctors/reservations", "application/json", bytes.NewReader(body))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			res.Body.Close()
+			statuses <- res.StatusCode
+		}(i)
+	}
+	wg.Wait()
+	close(statuses)
+
+	counts := make(map[int]int)
+	for status := range statuses {
+		counts[status]++
+	}
+
+	if counts[http.StatusOK] != 1 || counts[http.StatusConflict] != clients-1 {
+		t.Fatalf("expected one success and %d conflicts, got %v", clients-1, counts)
+	}
+
+	var stored int64
+	dao.GetDB().Model(&data.OccupiedSlot{}).Where("doctor_id = ?", doctor.ID).Count(&stored)
+	if stored != 1 {
+		t.Fatalf("expected one stored reservation, got %d", stored)
+	}
+}
+
+func TestReservationOutsideOfSlots(t *testing.T) {
+	server, dao := newTestServer(t)
+	doctor := addTestDoctor(t, dao)
+
+	tomorrow := data.SystemClock.Today().Add(24 * time.Hour)
+	cases := []struct {
+		date   time.Time
+		status int
+		code   string
+	}{
+		{date: tomorrow.Add(10*time.Hour + 10*time.Minute), status: http.StatusUnprocessableEntity, code: "slot_not_found"},
+		{date: tomorrow.Add(10*time.Hour + time.Millisecond), status: http.StatusUnprocessableEntity, code: "slot_not_found"},
+		{date: tomorrow.Add(-48 * time.Hour), status: http.StatusUnprocessableEntity, code: "booking_expired"},
+		{date: tomorrow.Add(10*time.Hour + 30*time.Minute), status: http.StatusOK},
+	}
+
+	for _, c := range cases {
+		body, _ := json.Marshal(service.Reservation{DoctorID: doctor.ID, Date: c.date.UnixMilli()})
+		res, err := http.Post(server.URL+"/doctors/reservations", "application/json", bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		p := problem{}
+		json.NewDecoder(res.Body).Decode(&p)
+		res.Body.Close()
+
+		if res.StatusCode != c.status || p.Code != c.code {
+			t.Fatalf("%s: expected status %d (%s), got %d (%s)", c.date, c.status, c.code, res.StatusCode, p.Code)
+		}
+	}
+}
+
+func TestHolds(t *testing.T) {
+	server, dao := newTestServer(t)
+	doctor := addTestDoctor(t, dao)
+
+	date := data.SystemClock.Today().Add(24*time.Hour + 11*time.Hour).UnixMilli()
+	post := func(url string, body any, out any) int {
+		raw, _ := json.Marshal(body)
+		res, err := http.Post(server.URL+url, "application/json", bytes.NewReader(raw))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+
+		if out != nil {
+			json.NewDecoder(res.Body).Decode(out)
+		}
+		return res.StatusCode
+	}
+
+	hold := service.HoldInfo{}
+	if status := post("/doctors/reservations/holds", service.Hold{DoctorID: doctor.ID, Date: date}, &hold); status != http.StatusOK || hold.Token == "" {
+		t.Fatalf("failed to hold the slot: %d", status)
+	}
+
+	// held slot can't be booked or held by others
+	if status := post("/doctors/reservations/holds", service.Hold{DoctorID: doctor.ID, Date: date}, nil); status != http.StatusConflict {
+		t.Fatalf("expected conflict for the second hold, got %d", status)
+	}
+	if status := post("/doctors/reservations", service.Reservation{DoctorID: doctor.ID, Date: date}, nil); status != http.StatusConflict {
+		t.Fatalf("expected conflict for the held slot, got %d", status)
+	}
+
+	units := []service.Unit{}
+	res, err := http.Get(server.URL + "/units")
+	if err != nil {
+		t.Fatal(err)
+	}
+	json.NewDecoder(res.Body).Decode(&units)
+	res.Body.Close()
+	if len(units) != 1 || !reflect.DeepEqual(units[0].UsedSlots, []int64{date}) {
+		t.Fatalf("expected held slot to be used, got %+v", units)
+	}
+
+	reservation := service.Reservation{Hold: hold.Token, Form: service.ReservationForm{Name: "Client"}}
+	if status := post("/doctors/reservations", reservation, nil); status != http.StatusOK {
+		t.Fatalf("failed to confirm the hold: %d", status)
+	}
+	if status := post("/doctors/reservations", reservation, nil); status == http.StatusOK {
+		t.Fatal("hold can't be confirmed twice")
+	}
+
+	slots, _ := dao.OccupiedSlots.GetAll()
+	if len(slots) != 1 || slots[0].ClientName != "Client" || slots[0].Date != date {
+		t.Fatalf("expected confirmed reservation, got %+v", slots)
+	}
+}
+
+func TestExpiredHolds(t *testing.T) {
+	_, dao := newTestServer(t)
+	doctor := addTestDoctor(t, dao)
+
+	date := data.SystemClock.Today().Add(24*time.Hour + 11*time.Hour).UnixMilli()
+	expired := data.SystemClock.Now().Add(-time.Minute).UnixMilli()
+	if _, err := dao.OccupiedSlots.Create(&data.OccupiedSlot{DoctorID: doctor.ID, Date: date, HoldToken: "expired", HoldUntil: expired}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// expired hold doesn't block the slot
+	if _, err := dao.OccupiedSlots.GetHold("expired"); err != data.ErrHoldNotFound {
+		t.Fatalf("expected ErrHoldNotFound, got %v", err)
+	}
+	if count, err := dao.OccupiedSlots.DeleteExpiredHolds(); err != nil || count != 1 {
+		t.Fatalf("expected one expired hold, got %d (%v)", count, err)
+	}
+	if _, err := dao.OccupiedSlots.Create(&data.OccupiedSlot{DoctorID: doctor.ID, Date: date, ClientName: "Client"}, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReviews(t *testing.T) {
+	server, dao := newTestServer(t)
+	doctor := addTestDoctor(t, dao)
+
+	past := data.OccupiedSlot{
+		DoctorID:    doctor.ID,
+		Date:        data.SystemClock.Now().Add(-time.Hour).UnixMilli(),
+		ClientEmail: "client@scheduler.booking",
+	}
+	upcoming := data.OccupiedSlot{
+		DoctorID:    doctor.ID,
+		Date:        data.SystemClock.Now().Add(time.Hour).UnixMilli(),
+		ClientEmail: "client@scheduler.booking",
+	}
+	dao.GetDB().Create(&past)
+	dao.GetDB().Create(&upcoming)
+
+	cases := []struct {
+		reservation int
+		form        service.ReviewForm
+		status      int
+	}{
+		{reservation: past.ID, form: service.ReviewForm{Stars: 4, Email: "other@scheduler.booking"}, status: http.StatusUnprocessableEntity},
+		{reservation: past.ID, form: service.ReviewForm{Stars: 6, Email: "client@scheduler.booking"}, status: http.StatusUnprocessableEntity},
+		{reservation: upcoming.ID, form: service.ReviewForm{Stars: 4, Email: "client@scheduler.booking"}, status: http.StatusConflict},
+		{reservation: upcoming.ID + 1, form: service.ReviewForm{Stars: 4, Email: "client@scheduler.booking"}, status: http.StatusNotFound},
+		{reservation: past.ID, form: service.ReviewForm{Stars: 4, Email: "Client@scheduler.booking"}, status: http.StatusOK},
+		{reservation: past.ID, form: service.ReviewForm{Stars: 5, Email: "client@scheduler.booking"}, status: http.StatusConflict},
+	}
+
+	for i, c := range cases {
+		body, _ := json.Marshal(c.form)
+		res, err := http.Post(server.URL+"/doctors/reservations/"+strconv.Itoa(c.reservation)+"/review", "application/json", bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+
+		if res.StatusCode != c.status {
+			t.Fatalf("case %d: expected status %d, got %d", i, c.status, res.StatusCode)
+		}
+	}
+
+	details := service.DoctorDetails{}
+	res, err := http.Get(server.URL + "/doctors/" + strconv.Itoa(doctor.ID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	json.NewDecoder(res.Body).Decode(&details)
+	res.Body.Close()
+
+	expected := data.ReviewSummary{Count: 1, Stars: 4, Average: 4, Distribution: [5]int{0, 0, 0, 1, 0}}
+	if details.Review != expected {
+		t.Fatalf("expected %+v, got %+v", expected, details.Review)
+	}
+}
+
+func TestAvailableSlots(t *testing.T) {
+	server, dao := newTestServer(t)
+	doctor := addTestDoctor(t, dao)
+
+	at := func(h, m int) int64 {
+		return data.SystemClock.Today().Add(24*time.Hour + time.Duration(h)*time.Hour + time.Duration(m)*time.Minute).UnixMilli()
+	}
+	if _, err := dao.OccupiedSlots.Create(&data.OccupiedSlot{DoctorID: doctor.ID, Date: at(10, 30), ClientName: "Client"}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	units := []service.Unit{}
+	url := fmt.Sprintf("%s/units?mode=available&from=%d&to=%d", server.URL, at(10, 0), at(12, 0))
+	res, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	json.NewDecoder(res.Body).Decode(&units)
+	res.Body.Close()
+
+	expected := []int64{at(10, 0), at(11, 0), at(11, 30)}
+	if len(units) != 1 || !reflect.DeepEqual(units[0].AvailableSlots, expected) {
+		t.Fatalf("expected %v, got %+v", expected, units)
+	}
+
+	res, err = http.Get(server.URL + "/units?mode=available&from=tomorrow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected status 400, got %d", res.StatusCode)
+	}
+}
+
+func TestWindow(t *testing.T) {
+	server, dao := newTestServer(t)
+	doctor := addTestDoctor(t, dao)
+
+	day := func(n int) time.Time {
+		return data.SystemClock.Today().AddDate(0, 0, n)
+	}
+	get := func(url string, out any) {
+		res, err := http.Get(server.URL + url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("%s: unexpected status %d", url, res.StatusCode)
+		}
+		json.NewDecoder(res.Body).Decode(out)
+	}
+
+	inside := day(2).Add(10 * time.Hour).UnixMilli()
+	outside := day(5).Add(10 * time.Hour).UnixMilli()
+	for _, date := range []int64{inside, outside} {
+		if _, err := dao.OccupiedSlots.Create(&data.OccupiedSlot{DoctorID: doctor.ID, Date: date, ClientName: "Client"}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	units := []service.Unit{}
+	get(fmt.Sprintf("/units?from=%s&to=%s", day(1).Format("2006-01-02"), day(4).Format("2006-01-02")), &units)
+
+	dates := []int64{day(1).UnixMilli(), day(2).UnixMilli(), day(3).UnixMilli()}
+	if len(units) != 1 || len(units[0].Slots) != 1 || !reflect.DeepEqual(units[0].Slots[0].Dates, dates) {
+		t.Fatalf("expected slots for %v, got %+v", dates, units)
+	}
+	if !reflect.DeepEqual(units[0].UsedSlots, []int64{inside}) {
+		t.Fatalf("expected used slots %v, got %v", []int64{inside}, units[0].UsedSlots)
+	}
+
+	// past schedules are returned only if they are in the requested interval
+	past := day(-10).UnixMilli()
+	if _, err := dao.DoctorsSchedule.Add(doctor.ID, 9*60, 10*60, past, "", 0, "", "", false); err != nil {
+		t.Fatal(err)
+	}
+
+	worktime := []service.DoctorRoutineStr{}
+	get("/doctors/worktime", &worktime)
+	if len(worktime) != 1 {
+		t.Fatalf("expected only the recurring schedule, got %+v", worktime)
+	}
+
+	worktime = []service.DoctorRoutineStr{}
+	get(fmt.Sprintf("/doctors/worktime?from=%d&to=%d", day(-11).UnixMilli(), day(-9).UnixMilli()), &worktime)
+	if len(worktime) != 1 || worktime[0].Rrule != "" {
+		t.Fatalf("expected only the past schedule, got %+v", worktime)
+	}
+}
+
+func TestClosures(t *testing.T) {
+	server, dao := newTestServer(t)
+	doctor := addTestDoctor(t, dao)
+	if err := dao.GetDB().Model(&doctor).Update("site", "Downtown").Error; err != nil {
+		t.Fatal(err)
+	}
+
+	tomorrow := data.SystemClock.Today().Add(24 * time.Hour)
+	at := func(h, m int) int64 {
+		return tomorrow.Add(time.Duration(h)*time.Hour + time.Duration(m)*time.Minute).UnixMilli()
+	}
+	send := func(method, url string, body any) (int, problem) {
+		b, _ := json.Marshal(body)
+		req, _ := http.NewRequest(method, server.URL+url, bytes.NewReader(b))
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+
+		p := problem{}
+		json.NewDecoder(res.Body).Decode(&p)
+		return res.StatusCode, p
+	}
+	available := func() []int64 {
+		units := []service.Unit{}
+		res, err := http.Get(fmt.Sprintf("%s/units?mode=available&from=%d&to=%d", server.URL, at(9, 0), at(12, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		json.NewDecoder(res.Body).Decode(&units)
+		res.Body.Close()
+		return units[0].AvailableSlots
+	}
+
+	day := tomorrow.Format("2006-01-02")
+	closures := []map[string]string{
+		{"start_date": day + " 10:00", "end_date": day + " 11:00", "category": "therapist", "reason": "staff meeting"},
+		{"start_date": day + " 00:00", "end_date": day + " 23:59", "category": "Dentist"},
+		{"start_date": day + " 00:00", "end_date": day + " 23:59", "location": "Uptown"},
+		{"start_date": day + " 09:00", "end_date": day + " 09:30", "location": "downtown", "reason": "fire drill"},
+	}
+	for _, c := range closures {
+		if status, p := send(http.MethodPost, "/closures", c); status != http.StatusOK {
+			t.Fatalf("expected the closure to be added, got %d (%+v)", status, p)
+		}
+	}
+
+	expected := []int64{at(9, 30), at(11, 0), at(11, 30)}
+	if slots := available(); !reflect.DeepEqual(slots, expected) {
+		t.Fatalf("expected slots %v, got %v", expected, slots)
+	}
+
+	reservation := service.Reservation{DoctorID: doctor.ID, Date: at(10, 30), Form: service.ReservationForm{Name: "Client"}}
+	if status, p := send(http.MethodPost, "/doctors/reservations", reservation); status != http.StatusUnprocessableEntity || p.Code != "clinic_closed" {
+		t.Fatalf("expected clinic_closed, got %d (%+v)", status, p)
+	}
+
+	list := []service.ClosureStr{}
+	res, err := http.Get(server.URL + "/closures")
+	if err != nil {
+		t.Fatal(err)
+	}
+	json.NewDecoder(res.Body).Decode(&list)
+	res.Body.Close()
+	if len(list) != 4 || list[3].Reason != "staff meeting" {
+		t.Fatalf("expected 4 closures, got %+v", list)
+	}
+
+	if status, p := send(http.MethodDelete, fmt.Sprintf("/closures/%d", list[3].ID), nil); status != http.StatusOK {
+		t.Fatalf("expected the closure to be deleted, got %d (%+v)", status, p)
+	}
+	if status, p := send(http.MethodPost, "/doctors/reservations", reservation); status != http.StatusOK {
+		t.Fatalf("expected the reservation, got %d (%+v)", status, p)
+	}
+
+	invalid := map[string]string{"start_date": day + " 11:00", "end_date": day + " 10:00"}
+	if status, p := send(http.MethodPost, "/closures", invalid); status != http.StatusUnprocessableEntity || len(p.Errors) != 1 {
+		t.Fatalf("expected validation errors, got %d (%+v)", status, p)
+	}
+	if status, p := send(http.MethodPut, "/closures/100", closures[0]); status != http.StatusNotFound || p.Code != "closure_not_found" {
+		t.Fatalf("expected closure_not_found, got %d (%+v)", status, p)
+	}
+}
+
+func TestTimeOff(t *testing.T) {
+	server, dao := newTestServer(t)
+	doctor := addTestDoctor(t, dao)
+
+	tomorrow := data.SystemClock.Today().Add(24 * time.Hour)
+	at := func(h, m int) int64 {
+		return tomorrow.Add(time.Duration(h)*time.Hour + time.Duration(m)*time.Minute).UnixMilli()
+	}
+	get := func(url string, out any) {
+		res, err := http.Get(server.URL + url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		json.NewDecoder(res.Body).Decode(out)
+	}
+	send := func(method, url string, body any) (int, problem) {
+		b, _ := json.Marshal(body)
+		req, _ := http.NewRequest(method, server.URL+url, bytes.NewReader(b))
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+
+		p := problem{}
+		json.NewDecoder(res.Body).Decode(&p)
+		return res.StatusCode, p
+	}
+
+	reservation, err := dao.OccupiedSlots.Create(&data.OccupiedSlot{DoctorID: doctor.ID, Date: at(10, 30), ClientName: "Client"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	day := tomorrow.Format("2006-01-02")
+	vacation := map[string]any{"doctor_id": doctor.ID, "start_date": day + " 10:00", "end_date": day + " 12:00", "reason": "conference"}
+	if status, p := send(http.MethodPost, "/doctors/timeoff", vacation); status != http.StatusOK {
+		t.Fatalf("expected time off to be added, got %d (%+v)", status, p)
+	}
+
+	timeOff := []service.TimeOffStr{}
+	get("/doctors/timeoff", &timeOff)
+	if len(timeOff) != 1 || !reflect.DeepEqual(timeOff[0].Conflicts, []int{reservation}) {
+		t.Fatalf("expected time off with the conflicting reservation %d, got %+v", reservation, timeOff)
+	}
+
+	units := []service.Unit{}
+	get(fmt.Sprintf("/units?mode=available&from=%d&to=%d", at(9, 0), at(13, 0)), &units)
+	expected := []int64{at(9, 0), at(9, 30), at(12, 0), at(12, 30)}
+	if len(units) != 1 || !reflect.DeepEqual(units[0].AvailableSlots, expected) {
+		t.Fatalf("expected slots %v, got %+v", expected, units)
+	}
+
+	booking := service.Reservation{DoctorID: doctor.ID, Date: at(11, 0), Form: service.ReservationForm{Name: "Client"}}
+	if status, p := send(http.MethodPost, "/doctors/reservations", booking); status != http.StatusUnprocessableEntity || p.Code != "doctor_time_off" {
+		t.Fatalf("expected doctor_time_off, got %d (%+v)", status, p)
+	}
+
+	worktime := []service.DoctorRoutineStr{}
+	get("/doctors/worktime", &worktime)
+	if len(worktime) != 2 || worktime[1].Type != service.TypeTimeOff || worktime[1].Reason != "conference" {
+		t.Fatalf("expected the schedule and time off, got %+v", worktime)
+	}
+
+	// the conflicting reservation is kept until staff reschedule it
+	reservations := []data.OccupiedSlot{}
+	get("/doctors/reservations", &reservations)
+	if len(reservations) != 1 || reservations[0].ID != reservation {
+		t.Fatalf("expected reservation %d, got %+v", reservation, reservations)
+	}
+
+	if status, p := send(http.MethodDelete, fmt.Sprintf("/doctors/timeoff/%d", timeOff[0].ID), nil); status != http.StatusOK {
+		t.Fatalf("expected time off to be deleted, got %d (%+v)", status, p)
+	}
+	if status, p := send(http.MethodPost, "/doctors/reservations", booking); status != http.StatusOK {
+		t.Fatalf("expected the reservation, got %d (%+v)", status, p)
+	}
+}
+
+func TestErrorResponses(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	cases := []struct {
+		method string
+		url    string
+		body   string
+		status int
+		code   string
+		fields []string
+	}{
+		{method: http.MethodPost, url: "/doctors", body: "{", status: http.StatusBadRequest, code: "invalid_body"},
+		{method: http.MethodGet, url: "/units?from=tomorrow", status: http.StatusBadRequest, code: "invalid_parameter", fields: []string{"from"}},
+		{method: http.MethodGet, url: "/doctors/100", status: http.StatusNotFound, code: "doctor_not_found"},
+		{method: http.MethodGet, url: "/doctors/100/services", status: http.StatusNotFound, code: "doctor_not_found"},
+		{method: http.MethodGet, url: "/units?mode=available&service=intake", status: http.StatusBadRequest, code: "invalid_parameter", fields: []string{"service"}},
+		{method: http.MethodGet, url: "/units?mode=available&service=100", status: http.StatusNotFound, code: "service_not_found"},
+		{method: http.MethodDelete, url: "/doctors/reservations/100", status: http.StatusNotFound, code: "reservation_not_found"},
+		{method: http.MethodDelete, url: "/waitlist/100", status: http.StatusNotFound, code: "waitlist_entry_not_found"},
+		{method: http.MethodPost, url: "/waitlist/claim/unknown", status: http.StatusNotFound, code: "offer_not_found"},
+		{method: http.MethodPost, url: "/waitlist", body: `{"doctor": 100}`, status: http.StatusNotFound, code: "doctor_not_found"},
+		{
+			method: http.MethodPost,
+			url:    "/doctors",
+			body:   `{"price": "free"}`,
+			status: http.StatusUnprocessableEntity,
+			code:   "validation_failed",
+			fields: []string{"name", "category", "slot_size", "price"},
+		},
+	}
+
+	for _, c := range cases {
+		req, _ := http.NewRequest(c.method, server.URL+c.url, bytes.NewBufferString(c.body))
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		p := problem{}
+		json.NewDecoder(res.Body).Decode(&p)
+		res.Body.Close()
+
+		if res.StatusCode != c.status || p.Status != c.status || p.Code != c.code {
+			t.Fatalf("%s %s: expected %d (%s), got %d (%+v)", c.method, c.url, c.status, c.code, res.StatusCode, p)
+		}
+		if ct := res.Header.Get("Content-Type"); ct != "application/problem+json" {
+			t.Fatalf("%s %s: unexpected content type %q", c.method, c.url, ct)
+		}
+
+		fields := make([]string, 0)
+		for _, f := range p.Errors {
+			fields = append(fields, f.Field)
+		}
+		if len(c.fields) > 0 && !reflect.DeepEqual(fields, c.fields) {
+			t.Fatalf("%s %s: expected fields %v, got %v", c.method, c.url, c.fields, fields)
+		}
+	}
+}
+
+// returns JWT with the claims signed with HS256
+func newToken(cl claims, secret string) string {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+	payload, _ := json.Marshal(cl)
+	unsigned := header + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(sign(unsigned, secret))
+}
+
+func TestAuth(t *testing.T) {
+	const secret = "secret"
+	server, dao := newAuthTestServer(t, AuthConfig{
+		Enabled: true,
+		Secret:  secret,
+		APIKeys: []APIKey{{Key: "admin-key", Name: "crm", Role: RoleAdmin}},
+	})
+
+	first := addTestDoctor(t, dao)
+	second := addTestDoctor(t, dao)
+
+	date := data.SystemClock.Today().Add(24*time.Hour + 10*time.Hour).UnixMilli()
+	firstSlot, _ := dao.OccupiedSlots.Create(&data.OccupiedSlot{DoctorID: first.ID, Date: date, ClientName: "First", ClientEmail: "first@scheduler.booking"}, nil)
+	secondSlot, _ := dao.OccupiedSlots.Create(&data.OccupiedSlot{DoctorID: second.ID, Date: date, ClientName: "Second", ClientEmail: "second@scheduler.booking"}, nil)
+
+	exp := time.Now().Add(time.Hour).Unix()
+	patient := "Bearer " + newToken(claims{Subject: "1", Role: RolePatient, Email: "first@scheduler.booking", ExpiresAt: exp}, secret)
+	doctor := "Bearer " + newToken(claims{Subject: "2", Role: RoleDoctor, DoctorID: second.ID, ExpiresAt: exp}, secret)
+	expired := "Bearer " + newToken(claims{Subject: "1", Role: RoleAdmin, ExpiresAt: time.Now().Add(-time.Hour).Unix()}, secret)
+	forged := "Bearer " + newToken(claims{Subject: "1", Role: RoleAdmin, ExpiresAt: exp}, "other")
+	endless := "Bearer " + newToken(claims{Subject: "1", Role: RoleAdmin}, secret)
+	unknown := "Bearer " + newToken(claims{Subject: "1", Role: "root", ExpiresAt: exp}, secret)
+	unscoped := "Bearer " + newToken(claims{Subject: "2", Role: RoleDoctor, ExpiresAt: exp}, secret)
+
+	do := func(method, url, auth string, out any) int {
+		req, _ := http.NewRequest(method, server.URL+url, bytes.NewBufferString("{}"))
+		if strings.HasPrefix(auth, "Bearer ") {
+			req.Header.Set("Authorization", auth)
+		} else if auth != "" {
+			req.Header.Set("X-API-Key", auth)
+		}
+
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+
+		if out != nil {
+			json.NewDecoder(res.Body).Decode(out)
+		}
+		return res.StatusCode
+	}
+
+	// reservations are filtered by the owner
+	for auth, count := range map[string]int{patient: 1, doctor: 1, "admin-key": 2} {
+		slots := []data.OccupiedSlot{}
+		do(http.MethodGet, "/doctors/reservations", auth, &slots)
+		if len(slots) != count {
+			t.Fatalf("expected %d reservations, got %+v", count, slots)
+		}
+	}
+
+	cases := []struct {
+		method string
+		url    string
+		auth   string
+		status int
+	}{
+		{method: http.MethodGet, url: "/units", status: http.StatusOK},
+		{method: http.MethodGet, url: "/doctors/reservations", status: http.StatusUnauthorized},
+		{method: http.MethodGet, url: "/doctors/reservations", auth: expired, status: http.StatusUnauthorized},
+		{method: http.MethodGet, url: "/doctors/reservations", auth: forged, status: http.StatusUnauthorized},
+		{method: http.MethodGet, url: "/doctors/reservations", auth: endless, status: http.StatusUnauthorized},
+		{method: http.MethodGet, url: "/doctors/reservations", auth: unknown, status: http.StatusUnauthorized},
+		{method: http.MethodGet, url: "/doctors/reservations", auth: unscoped, status: http.StatusUnauthorized},
+		{method: http.MethodGet, url: "/doctors/reservations", auth: "unknown-key", status: http.StatusUnauthorized},
+		{method: http.MethodGet, url: "/doctors/worktime", auth: patient, status: http.StatusForbidden},
+		{method: http.MethodPost, url: "/doctors", auth: doctor, status: http.StatusForbidden},
+		{method: http.MethodDelete, url: fmt.Sprintf("/doctors/worktime/%d", first.DoctorSchedule[0].ID), auth: doctor, status: http.StatusForbidden},
+		{method: http.MethodDelete, url: fmt.Sprintf("/doctors/reservations/%d", secondSlot), auth: patient, status: http.StatusForbidden},
+		{method: http.MethodGet, url: fmt.Sprintf("/doctors/reservations/%d/history", firstSlot), auth: doctor, status: http.StatusForbidden},
+		{method: http.MethodDelete, url: fmt.Sprintf("/doctors/reservations/%d", firstSlot), auth: patient, status: http.StatusOK},
+		{method: http.MethodDelete, url: fmt.Sprintf("/doctors/worktime/%d", second.DoctorSchedule[0].ID), auth: doctor, status: http.StatusOK},
+	}
+
+	for _, c := range cases {
+		if status := do(c.method, c.url, c.auth, nil); status != c.status {
+			t.Fatalf("%s %s: expected status %d, got %d", c.method, c.url, c.status, status)
+		}
+	}
+
+	// the author of changes is the authenticated user
+	history := []data.ReservationLog{}
+	do(http.MethodGet, fmt.Sprintf("/doctors/reservations/%d/history", firstSlot), "admin-key", &history)
+	if len(history) != 1 || history[0].Actor != "patient:1" {
+		t.Fatalf("expected cancellation by the patient, got %+v", history)
+	}
+}
+
+func TestCancelAndReschedule(t *testing.T) {
+	server, dao := newTestServer(t)
+	doctor := addTestDoctor(t, dao)
+
+	at := func(day, h, m int) int64 {
+		return data.SystemClock.Today().Add(time.Duration(day)*24*time.Hour + time.Duration(h)*time.Hour + time.Duration(m)*time.Minute).UnixMilli()
+	}
+	id, _ := dao.OccupiedSlots.Create(&data.OccupiedSlot{DoctorID: doctor.ID, Date: at(1, 10, 0), ClientName: "Client", ClientEmail: "client@scheduler.booking"}, nil)
+	if _, err := dao.OccupiedSlots.Create(&data.OccupiedSlot{DoctorID: doctor.ID, Date: at(1, 11, 0), ClientName: "Other", ClientEmail: "other@scheduler.booking"}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	do := func(method, url string, body any) (int, string) {
+		raw, _ := json.Marshal(body)
+		req, _ := http.NewRequest(method, server.URL+url, bytes.NewReader(raw))
+		req.Header.Set("X-Actor", "front-desk")
+
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+
+		p := problem{}
+		json.NewDecoder(res.Body).Decode(&p)
+		return res.StatusCode, p.Code
+	}
+	usedSlots := func() []int64 {
+		units := []service.Unit{}
+		res, err := http.Get(server.URL + "/units")
+		if err != nil {
+			t.Fatal(err)
+		}
+		json.NewDecoder(res.Body).Decode(&units)
+		res.Body.Close()
+		if len(units) != 1 {
+			t.Fatalf("expected one unit, got %+v", units)
+		}
+		return units[0].UsedSlots
+	}
+
+	url := fmt.Sprintf("/doctors/reservations/%d", id)
+	cases := []struct {
+		date   int64
+		status int
+		code   string
+	}{
+		{date: at(1, 11, 0), status: http.StatusConflict, code: "slot_taken"},
+		{date: at(1, 10, 10), status: http.StatusUnprocessableEntity, code: "slot_not_found"},
+		{date: at(1, 12, 0), status: http.StatusOK},
+	}
+	for _, c := range cases {
+		if status, code := do(http.MethodPut, url, service.Rescheduling{Date: c.date}); status != c.status || code != c.code {
+			t.Fatalf("move to %d: expected status %d (%s), got %d (%s)", c.date, c.status, c.code, status, code)
+		}
+	}
+	if used := usedSlots(); !reflect.DeepEqual(used, []int64{at(1, 11, 0), at(1, 12, 0)}) {
+		t.Fatalf("expected the slot to be moved, got %v", used)
+	}
+
+	if status, _ := do(http.MethodDelete, url, nil); status != http.StatusOK {
+		t.Fatalf("failed to cancel the reservation: %d", status)
+	}
+	if used := usedSlots(); !reflect.DeepEqual(used, []int64{at(1, 11, 0)}) {
+		t.Fatalf("expected the slot to be freed, got %v", used)
+	}
+
+	history := []data.ReservationLog{}
+	res, err := http.Get(server.URL + url + "/history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	json.NewDecoder(res.Body).Decode(&history)
+	res.Body.Close()
+	if len(history) != 2 ||
+		history[0].Action != data.ActionRescheduled || history[0].Date != at(1, 10, 0) || history[0].NewDate != at(1, 12, 0) ||
+		history[1].Action != data.ActionCancelled || history[1].Date != at(1, 12, 0) ||
+		history[0].Actor != "front-desk" || history[1].Actor != "front-desk" {
+		t.Fatalf("expected rescheduling and cancellation by the front desk, got %+v", history)
+	}
+
+	// past reservations can't be changed
+	past, _ := dao.OccupiedSlots.Create(&data.OccupiedSlot{DoctorID: doctor.ID, Date: at(-1, 10, 0), ClientName: "Client", ClientEmail: "client@scheduler.booking"}, nil)
+	url = fmt.Sprintf("/doctors/reservations/%d", past)
+	if status, code := do(http.MethodPut, url, service.Rescheduling{Date: at(1, 13, 0)}); status != http.StatusUnprocessableEntity || code != "reservation_expired" {
+		t.Fatalf("expected expired reservation, got %d (%s)", status, code)
+	}
+	if status, code := do(http.MethodDelete, url, nil); status != http.StatusUnprocessableEntity || code != "reservation_expired" {
+		t.Fatalf("expected expired reservation, got %d (%s)", status, code)
+	}
+}
+
+func TestDeleteDoctor(t *testing.T) {
+	server, dao := newTestServer(t)
+	doctor := addTestDoctor(t, dao)
+
+	date := data.SystemClock.Today().Add(24*time.Hour + 10*time.Hour).UnixMilli()
+	id, err := dao.OccupiedSlots.Create(&data.OccupiedSlot{DoctorID: doctor.ID, Date: date, ClientName: "Client", ClientEmail: "client@scheduler.booking"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	do := func(url string) (int, string) {
+		req, _ := http.NewRequest(http.MethodDelete, server.URL+url, nil)
+		req.Header.Set("X-Actor", "admin")
+
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+
+		p := problem{}
+		json.NewDecoder(res.Body).Decode(&p)
+		return res.StatusCode, p.Code
+	}
+
+	url := fmt.Sprintf("/doctors/%d", doctor.ID)
+	if status, code := do(url); status != http.StatusConflict || code != "doctor_has_reservations" {
+		t.Fatalf("expected conflict, got %d (%s)", status, code)
+	}
+	if slots, _ := dao.OccupiedSlots.GetAll(); len(slots) != 1 {
+		t.Fatalf("expected the reservation to be kept, got %+v", slots)
+	}
+
+	if status, _ := do(url + "?force=true"); status != http.StatusOK {
+		t.Fatalf("failed to delete the doctor: %d", status)
+	}
+	if deleted, _ := dao.Doctors.GetOne(doctor.ID); deleted.ID != 0 {
+		t.Fatalf("expected the doctor to be deleted, got %+v", deleted)
+	}
+	if slots, _ := dao.OccupiedSlots.GetAll(); len(slots) != 0 {
+		t.Fatalf("expected reservations to be deleted, got %+v", slots)
+	}
+	var schedules int64
+	dao.GetDB().Model(&data.DoctorSchedule{}).Where("doctor_id = ?", doctor.ID).Count(&schedules)
+	if schedules != 0 {
+		t.Fatalf("expected schedules to be deleted, got %d", schedules)
+	}
+
+	history, _ := dao.OccupiedSlots.GetLogs(id)
+	if len(history) != 1 || history[0].Action != data.ActionCancelled || history[0].Actor != "admin" {
+		t.Fatalf("expected the cancellation by the admin, got %+v", history)
+	}
+}
+
+func TestActor(t *testing.T) {
+	admin := &Identity{Subject: "1", Role: RoleAdmin}
+	cases := []struct {
+		enabled  bool
+		identity *Identity
+		header   string
+		actor    string
+	}{
+		{header: "front-desk", actor: "front-desk"},
+		{actor: "anonymous"},
+		{enabled: true, header: "front-desk", actor: "anonymous"},
+		{enabled: true, identity: admin, header: "front-desk", actor: "admin:1"},
+	}
+
+	for _, c := range cases {
+		api := NewAPI(nil, AuthConfig{Enabled: c.enabled, Secret: "secret"})
+		r := httptest.NewRequest(http.MethodDelete, "/doctors/reservations/1", nil)
+		r.Header.Set("X-Actor", c.header)
+		if c.identity != nil {
+			r = r.WithContext(context.WithValue(r.Context(), identityKey{}, c.identity))
+		}
+
+		if actor := api.actor(r); actor != c.actor {
+			t.Fatalf("%+v: expected %q, got %q", c, c.actor, actor)
+		}
+	}
+}
@@ -0,0 +1,339 @@
+package api
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"scheduler-booking/service"
+	"strings"
+	"time"
+)
+
+const (
+	RoleAdmin   = "admin"
+	RoleDoctor  = "doctor"  // access to the own schedule and reservations
+	RolePatient = "patient" // access to the own reservations
+)
+
+type AuthConfig struct {
+	Enabled bool
+	Secret  string   // key of HS256 signatures of JWT
+	APIKeys []APIKey `yaml:"apiKeys"`
+}
+
+// key of the integration, it is passed in the X-API-Key header
+type APIKey struct {
+	Key      string
+	Name     string
+	Role     string
+	DoctorID int    `yaml:"doctor"` // for the doctor role
+	Email    string // for the patient role
+}
+
+// authenticated user
+type Identity struct {
+	Subject  string
+	Role     string
+	DoctorID int
+	Email    string
+}
+
+// claims of JWT
+type claims struct {
+	Subject   string `json:"sub"`
+	Role      string `json:"role"`
+	DoctorID  int    `json:"doctor_id,omitempty"`
+	Email     string `json:"email,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"` // in seconds, required
+	NotBefore int64  `json:"nbf,omitempty"` // in seconds
+}
+
+type identityKey struct{}
+
+var (
+	errUnauthorized = &service.Error{Kind: service.KindUnauthorized, Code: "unauthorized", Message: "authentication is required"}
+	errForbidden    = &service.Error{Kind: service.KindForbidden, Code: "forbidden", Message: "access is denied"}
+)
+
+// stores the identity of the request, requests without credentials are anonymous
+func (api *API) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !api.auth.Enabled {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var id *Identity
+		var err error
+		if key := r.Header.Get("X-API-Key"); key != "" {
+			id, err = api.auth.apiKey(key)
+		} else if header := r.Header.Get("Authorization"); header != "" {
+			token := strings.TrimPrefix(header, "Bearer ")
+			if token == header {
+				err = errors.New("bearer token is expected")
+			} else {
+				id, err = api.auth.token(token, api.sAll.Clock.Now())
+			}
+		}
+
+		if err != nil {
+			api.errResponse(w, &service.Error{
+				Kind:    service.KindUnauthorized,
+				Code:    "invalid_credentials",
+				Message: fmt.Sprintf("invalid credentials: %v", err),
+				Err:     err,
+			})
+			return
+		}
+
+		if id != nil {
+			r = r.WithContext(context.WithValue(r.Context(), identityKey{}, id))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// allows requests of the roles only
+func (api *API) allow(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !api.auth.Enabled {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			id := identity(r)
+			if id == nil {
+				api.errResponse(w, errUnauthorized)
+				return
+			}
+			for _, role := range roles {
+				if id.Role == role {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+
+			api.errResponse(w, errForbidden)
+		})
+	}
+}
+
+// returns the identity of the request, nil for anonymous requests
+func identity(r *http.Request) *Identity {
+	id, _ := r.Context().Value(identityKey{}).(*Identity)
+	return id
+}
+
+// checks if the request has access to all data
+func (api *API) unrestricted(r *http.Request) bool {
+	if !api.auth.Enabled {
+		return true
+	}
+
+	id := identity(r)
+	return id != nil && id.Role == RoleAdmin
+}
+
+// returns the author of changes, the authenticated user if any,
+// the X-Actor header is trusted only when authentication is disabled
+func (api *API) actor(r *http.Request) string {
+	if id := identity(r); id != nil {
+		return id.Role + ":" + id.Subject
+	}
+	if name := r.Header.Get("X-Actor"); name != "" && !api.auth.Enabled {
+		return name
+	}
+
+	return "anonymous"
+}
+
+// checks that the request can access data of the doctor
+func (api *API) checkDoctor(r *http.Request, doctorID int) error {
+	if api.unrestricted(r) {
+		return nil
+	}
+
+	id := identity(r)
+	if id == nil {
+		return errUnauthorized
+	}
+	if id.Role == RoleDoctor && id.DoctorID == doctorID {
+		return nil
+	}
+
+	return errForbidden
+}
+
+// checks that the request can access the reservation of the doctor and the client
+func (api *API) checkReservation(r *http.Request, doctorID int, email string) error {
+	id := identity(r)
+	if id != nil && id.Role == RolePatient {
+		if id.Email != "" && strings.EqualFold(id.Email, email) {
+			return nil
+		}
+		return errForbidden
+	}
+
+	return api.checkDoctor(r, doctorID)
+}
+
+// checks that the request can access the schedule
+func (api *API) checkSchedule(r *http.Request, id int) error {
+	if api.unrestricted(r) {
+		return nil
+	}
+
+	sch, err := api.sAll.Worktime.GetOne(id)
+	if err != nil {
+		return err
+	}
+
+	return api.checkDoctor(r, sch.DoctorID)
+}
+
+// checks that the request can access the time off
+func (api *API) checkTimeOff(r *http.Request, id int) error {
+	if api.unrestricted(r) {
+		return nil
+	}
+
+	timeOff, err := api.sAll.TimeOff.GetOne(id)
+	if err != nil {
+		return err
+	}
+
+	return api.checkDoctor(r, timeOff.DoctorID)
+}
+
+// checks that the request can access the reservation
+func (api *API) checkReservationID(r *http.Request, id int) error {
+	if api.unrestricted(r) {
+		return nil
+	}
+
+	slot, err := api.sAll.Reservations.GetOne(id)
+	if err != nil {
+		return err
+	}
+
+	return api.checkReservation(r, slot.DoctorID, slot.ClientEmail)
+}
+
+// checks that the request can access the waitlist entry of the doctor and the client
+func (api *API) checkWaitlistEntry(r *http.Request, id int) error {
+	if api.unrestricted(r) {
+		return nil
+	}
+
+	entry, err := api.sAll.Waitlist.GetOne(id)
+	if err != nil {
+		return err
+	}
+
+	return api.checkReservation(r, entry.DoctorID, entry.ClientEmail)
+}
+
+func (c AuthConfig) apiKey(key string) (*Identity, error) {
+	for _, k := range c.APIKeys {
+		if subtle.ConstantTimeCompare([]byte(k.Key), []byte(key)) == 1 {
+			return &Identity{Subject: k.Name, Role: k.Role, DoctorID: k.DoctorID, Email: k.Email}, nil
+		}
+	}
+
+	return nil, errors.New("unknown API key")
+}
+
+// verifies JWT signed with HS256 and returns its identity
+func (c AuthConfig) token(token string, now time.Time) (*Identity, error) {
+	if c.Secret == "" {
+		return nil, errors.New("tokens are not accepted")
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+
+	header := struct {
+		Alg string `json:"alg"`
+	}{}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, err
+	}
+	if header.Alg != "HS256" {
+		return nil, fmt.Errorf("unsupported algorithm %q", header.Alg)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("malformed signature")
+	}
+	if !hmac.Equal(signature, sign(parts[0]+"."+parts[1], c.Secret)) {
+		return nil, errors.New("invalid signature")
+	}
+
+	cl := claims{}
+	if err := decodeSegment(parts[1], &cl); err != nil {
+		return nil, err
+	}
+
+	if cl.ExpiresAt == 0 {
+		return nil, errors.New("token has no expiration time")
+	}
+	if now.Unix() >= cl.ExpiresAt {
+		return nil, errors.New("token has expired")
+	}
+	if cl.NotBefore != 0 && now.Unix() < cl.NotBefore {
+		return nil, errors.New("token is not valid yet")
+	}
+
+	id := &Identity{Subject: cl.Subject, Role: cl.Role, DoctorID: cl.DoctorID, Email: cl.Email}
+	if err := id.validate(); err != nil {
+		return nil, err
+	}
+	return id, nil
+}
+
+// checks that the role is known and has the scope of its data
+func (id *Identity) validate() error {
+	switch id.Role {
+	case RoleAdmin:
+	case RoleDoctor:
+		if id.DoctorID == 0 {
+			return errors.New("doctor role requires doctor_id")
+		}
+	case RolePatient:
+		if id.Email == "" {
+			return errors.New("patient role requires email")
+		}
+	default:
+		return fmt.Errorf("unknown role %q", id.Role)
+	}
+
+	return nil
+}
+
+func sign(value, secret string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(value))
+	return mac.Sum(nil)
+}
+
+func decodeSegment(segment string, o interface{}) error {
+	raw, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return errors.New("malformed token")
+	}
+	if err := json.Unmarshal(raw, o); err != nil {
+		return errors.New("malformed token")
+	}
+
+	return nil
+}
@@ -2,8 +2,11 @@ package api
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"scheduler-booking/service"
 	"strconv"
+	"time"
 
 	"github.com/go-chi/chi"
 )
@@ -19,9 +22,70 @@ func numberParam(r *http.Request, key string) int {
 	return num
 }
 
+// returns the timestamp (in milliseconds) from the query, 0 if it is not set,
+// the date in the YYYY-MM-DD format is accepted as well
+func stampQuery(r *http.Request, key string) (int64, error) {
+	value := r.URL.Query().Get(key)
+	if value == "" {
+		return 0, nil
+	}
+
+	if date, err := time.Parse("2006-01-02", value); err == nil {
+		return date.UnixMilli(), nil
+	}
+
+	stamp, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, invalidParam(key, "invalid %s parameter, timestamp in milliseconds or YYYY-MM-DD date is expected", key)
+	}
+
+	return stamp, nil
+}
+
+// returns the number from the query, 0 if it is not set
+func numberQuery(r *http.Request, key string) (int, error) {
+	value := r.URL.Query().Get(key)
+	if value == "" {
+		return 0, nil
+	}
+
+	num, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, invalidParam(key, "invalid %s parameter, number is expected", key)
+	}
+
+	return num, nil
+}
+
+// returns the [from, to) interval from the query
+func intervalQuery(r *http.Request) (int64, int64, error) {
+	from, err := stampQuery(r, "from")
+	if err != nil {
+		return 0, 0, err
+	}
+
+	to, err := stampQuery(r, "to")
+	return from, to, err
+}
+
 func parseForm(w http.ResponseWriter, r *http.Request, o interface{}) error {
 	body := http.MaxBytesReader(w, r.Body, 1048576)
 	dec := json.NewDecoder(body)
 	err := dec.Decode(&o)
-	return err
+	if err != nil {
+		return &service.Error{Kind: service.KindBadRequest, Code: "invalid_body", Message: fmt.Sprintf("invalid request body: %v", err), Err: err}
+	}
+
+	return nil
+}
+
+// returns the error of the malformed query parameter
+func invalidParam(key, format string, args ...any) error {
+	msg := fmt.Sprintf(format, args...)
+	return &service.Error{
+		Kind:    service.KindBadRequest,
+		Code:    "invalid_parameter",
+		Message: msg,
+		Fields:  []service.FieldError{{Field: key, Message: msg}},
+	}
 }
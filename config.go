@@ -1,6 +1,19 @@
 package main
 
-import "scheduler-booking/data"
+import (
+	"errors"
+	"fmt"
+	"scheduler-booking/api"
+	"scheduler-booking/data"
+	"scheduler-booking/notify"
+	"scheduler-booking/seed"
+	"scheduler-booking/service"
+)
+
+const (
+	ModeDemo       = "demo"       // data can be replaced with demo data
+	ModeProduction = "production" // data is never reset
+)
 
 type ConfigServer struct {
 	URL            string
@@ -10,6 +23,32 @@ type ConfigServer struct {
 }
 
 type AppConfig struct {
-	Server ConfigServer
-	DB     data.DBConfig
+	Mode    string       `default:"demo"`
+	Demo    seed.Options // demo data of resets and the seed command
+	Server  ConfigServer
+	DB      data.DBConfig
+	Booking service.Config
+	Auth    api.AuthConfig
+	Notify  notify.Config
+}
+
+func (c AppConfig) validate() error {
+	switch c.Mode {
+	case ModeDemo:
+		return nil
+	case ModeProduction:
+		if c.DB.ResetOnStart {
+			return errors.New("db.resetonstart is not allowed in production mode")
+		}
+		if c.Server.ResetFrequence > 0 {
+			return errors.New("server.resetFrequence is not allowed in production mode")
+		}
+		if !c.Auth.Enabled {
+			// reservations with names and emails of clients would be public
+			return errors.New("auth.enabled is required in production mode")
+		}
+		return nil
+	}
+
+	return fmt.Errorf("unknown mode %q, expected %s or %s", c.Mode, ModeDemo, ModeProduction)
 }
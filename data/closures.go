@@ -0,0 +1,42 @@
+package data
+
+import (
+	"gorm.io/gorm"
+)
+
+type closuresDAO struct {
+	db *gorm.DB
+}
+
+func newClosuresDAO(db *gorm.DB) *closuresDAO {
+	return &closuresDAO{db}
+}
+
+func (d *closuresDAO) GetOne(id int) (Closure, error) {
+	closure := Closure{}
+	err := d.db.Find(&closure, id).Error
+	return closure, err
+}
+
+// returns closures which overlap the interval ordered by their start
+func (d *closuresDAO) GetAll(window Window) ([]Closure, error) {
+	closures := make([]Closure, 0)
+	err := d.db.
+		Where("start_date < ? AND end_date > ?", window.To, window.From).
+		Order("start_date, id").
+		Find(&closures).Error
+	return closures, err
+}
+
+func (d *closuresDAO) Add(closure *Closure) (int, error) {
+	err := d.db.Create(closure).Error
+	return closure.ID, err
+}
+
+func (d *closuresDAO) Update(closure Closure) error {
+	return d.db.Save(&closure).Error
+}
+
+func (d *closuresDAO) Delete(id int) error {
+	return d.db.Delete(&Closure{}, id).Error
+}
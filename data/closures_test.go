@@ -0,0 +1,41 @@
+package data
+
+import (
+	"testing"
+)
+
+func testClosures(t *testing.T, repo Repositories) {
+	closures := []Closure{
+		{StartDate: at(11, 0, 0), EndDate: at(12, 0, 0), Reason: "holiday"},
+		{StartDate: at(6, 12, 0), EndDate: at(6, 14, 0), Category: "Dentist"},
+		{StartDate: at(21, 0, 0), EndDate: at(23, 0, 0), Location: "Downtown"},
+	}
+	for i := range closures {
+		if _, err := repo.Closures.Add(&closures[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	found, err := repo.Closures.GetAll(Window{From: at(6, 0, 0), To: at(12, 0, 0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 2 || found[0].ID != closures[1].ID || found[1].ID != closures[0].ID {
+		t.Fatalf("expected closures %d and %d, got %+v", closures[1].ID, closures[0].ID, found)
+	}
+
+	closures[2].Reason = "renovation"
+	if err := repo.Closures.Update(closures[2]); err != nil {
+		t.Fatal(err)
+	}
+	if closure, err := repo.Closures.GetOne(closures[2].ID); err != nil || closure != closures[2] {
+		t.Fatalf("expected %+v, got %+v (%v)", closures[2], closure, err)
+	}
+
+	if err := repo.Closures.Delete(closures[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if closure, err := repo.Closures.GetOne(closures[0].ID); err != nil || closure.ID != 0 {
+		t.Fatalf("expected the closure to be deleted, got %+v (%v)", closure, err)
+	}
+}
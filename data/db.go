@@ -1,63 +1,139 @@
 package data
 
 import (
+	"errors"
+	"fmt"
+	"strings"
+
+	mysqlerr "github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 )
 
 type DBConfig struct {
-	Path         string
-	ResetOnStart bool
+	Driver       string // sqlite (by default), postgres or mysql
+	DSN          string // connection string of postgres and mysql
+	Path         string // database file of sqlite
+	ResetOnStart bool   // (demo mode) replace data with demo data on start
+
+	// the schema is upgraded by the migrate command only,
+	// the server doesn't start while there are pending migrations
+	ManualMigrations bool `yaml:"manualMigrations"`
 }
 
+// repositories of the SQL database
 type DAO struct {
 	db *gorm.DB
-
-	Doctors         *doctorsDAO
-	DoctorsSchedule *doctorsScheduleDAO
-	OccupiedSlots   *occupiedSlotsDAO
+	Repositories
 }
 
 func NewDAO(config DBConfig) *DAO {
-	db, err := gorm.Open(sqlite.Open(config.Path), &gorm.Config{
-		Logger: logger.Default.LogMode(logger.Error),
-	})
+	return NewDAOWithClock(config, SystemClock)
+}
+
+// creates the DAO which gets the current time from the clock
+func NewDAOWithClock(config DBConfig, clock Clock) *DAO {
+	db, err := connect(config)
 	if err != nil {
-		panic("failed to connect database")
+		panic(err)
 	}
 
-	db.AutoMigrate(&Doctor{})
-	db.AutoMigrate(&Review{})
-	db.AutoMigrate(&DoctorSchedule{})
-	db.AutoMigrate(&OccupiedSlot{})
+	migrator, err := newMigrator(db)
+	if err != nil {
+		panic(fmt.Sprintf("failed to read migrations: %v", err))
+	}
+	if config.ManualMigrations {
+		pending, err := migrator.Pending()
+		if err != nil {
+			panic(fmt.Sprintf("failed to read migrations: %v", err))
+		}
+		if len(pending) > 0 {
+			panic(fmt.Sprintf("database schema is outdated, run \"migrate up\" to apply migrations %v", pending))
+		}
+	} else if _, err := migrator.Up(0); err != nil {
+		panic(fmt.Sprintf("failed to migrate database: %v", err))
+	}
 
-	dao := DAO{db: db}
-	dao.Doctors = newDoctorsDAO(db)
-	dao.DoctorsSchedule = newDoctorsScheduleDAO(db)
-	dao.OccupiedSlots = newOccupiedSlotsDAO(db)
+	return &DAO{db: db, Repositories: Repositories{
+		Clock:           clock,
+		Doctors:         newDoctorsDAO(db, clock),
+		DoctorsSchedule: newDoctorsScheduleDAO(db),
+		OccupiedSlots:   newOccupiedSlotsDAO(db, clock),
+		Reviews:         newReviewsDAO(db),
+		Closures:        newClosuresDAO(db),
+		TimeOff:         newTimeOffDAO(db),
+		Services:        newServicesDAO(db),
+		Waitlist:        newWaitlistDAO(db, clock),
+		Outbox:          newOutboxDAO(db),
+		Reminders:       newRemindersDAO(db),
+		Leases:          newLeasesDAO(db),
+	}}
+}
 
-	if config.ResetOnStart {
-		dao.RestartData()
+func (d *DAO) GetDB() *gorm.DB {
+	return d.db
+}
+
+// opens the database, the schema is changed by migrations only
+func connect(config DBConfig) (*gorm.DB, error) {
+	dialector, err := newDialector(config)
+	if err != nil {
+		return nil, err
 	}
 
-	return &dao
+	db, err := gorm.Open(dialector, &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Error),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect database: %w", err)
+	}
+
+	return db, nil
 }
 
-func (d *DAO) RestartData() {
-	d.db.Transaction(func(tx *gorm.DB) error {
-		dataDown(tx)
-		dataUp(tx)
-		return nil
-	})
+func newDialector(config DBConfig) (gorm.Dialector, error) {
+	switch config.Driver {
+	case "", "sqlite":
+		return sqlite.Open(sqliteDSN(config.Path)), nil
+	case "postgres":
+		return postgres.Open(config.DSN), nil
+	case "mysql":
+		return mysql.Open(config.DSN), nil
+	}
+
+	return nil, fmt.Errorf("unknown database driver %q", config.Driver)
 }
 
-func (d *DAO) GetDB() *gorm.DB {
-	return d.db
+// concurrent writers wait for each other instead of failing with "database is locked"
+func sqliteDSN(path string) string {
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+
+	return path + sep + "_busy_timeout=5000&_txlock=immediate"
 }
 
-func must(err error) {
-	if err != nil {
-		panic(err)
+var ErrSlotTaken = errors.New("this time is already booked")
+
+func isUniqueViolation(err error) bool {
+	if err == nil {
+		return false
 	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == "23505" // unique_violation
+	}
+
+	var myErr *mysqlerr.MySQLError
+	if errors.As(err, &myErr) {
+		return myErr.Number == 1062 // ER_DUP_ENTRY
+	}
+
+	return strings.Contains(err.Error(), "UNIQUE constraint failed")
 }
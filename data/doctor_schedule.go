@@ -20,9 +20,10 @@ func (d *doctorsScheduleDAO) GetOne(id int) (DoctorSchedule, error) {
 	return data, err
 }
 
-func (d *doctorsScheduleDAO) GetAll() ([]DoctorSchedule, error) {
+// returns schedules which can have occurrences in the interval
+func (d *doctorsScheduleDAO) GetAll(window Window) ([]DoctorSchedule, error) {
 	sch := make([]DoctorSchedule, 0)
-	err := d.db.Find(&sch).Error
+	err := d.db.Scopes(inWindow(window)).Find(&sch).Error
 	return sch, err
 }
 
@@ -114,3 +115,16 @@ func (d *doctorsScheduleDAO) Delete(id int) (err error) {
 
 	return nil
 }
+
+// filters schedules by the interval, recurring events are filtered by the start date only
+// and their exceptions by the original start as well
+func inWindow(window Window) func(*gorm.DB) *gorm.DB {
+	from, to, origFrom, origTo := window.schedules()
+
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where(
+			"(rrule <> '' AND date < ?) OR (date >= ? AND date < ?) OR (recurring_event_id <> '' AND original_start >= ? AND original_start < ?)",
+			to, from, to, origFrom, origTo,
+		)
+	}
+}
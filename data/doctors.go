@@ -1,15 +1,20 @@
 package data
 
 import (
+	"errors"
+
 	"gorm.io/gorm"
 )
 
+var ErrDoctorHasReservations = errors.New("doctor has upcoming reservations")
+
 type doctorsDAO struct {
-	db *gorm.DB
+	db    *gorm.DB
+	clock Clock
 }
 
-func newDoctorsDAO(db *gorm.DB) *doctorsDAO {
-	return &doctorsDAO{db}
+func newDoctorsDAO(db *gorm.DB, clock Clock) *doctorsDAO {
+	return &doctorsDAO{db, clock}
 }
 
 func (d *doctorsDAO) GetOne(id int) (Doctor, error) {
@@ -18,19 +23,99 @@ func (d *doctorsDAO) GetOne(id int) (Doctor, error) {
 	return doctor, err
 }
 
-func (d *doctorsDAO) GetAll(preload bool) ([]Doctor, error) {
+// returns the doctor with schedules and upcoming reservations related to the interval
+func (d *doctorsDAO) GetOneWithSchedule(id int, window Window) (Doctor, error) {
+	doctor := Doctor{}
+	err := d.preload(window).Find(&doctor, id).Error
+	return doctor, err
+}
+
+func (d *doctorsDAO) GetAll() ([]Doctor, error) {
 	doctors := make([]Doctor, 0)
-	var err error
-	if !preload {
-		err = d.db.Find(&doctors).Error
-	} else {
-		now := Now().UnixMilli()
-		err = d.db.
-			Preload("Review").
-			Preload("OccupiedSlots", "date >= ?", now).
-			Preload("DoctorSchedule").
-			Find(&doctors).Error
-	}
+	err := d.db.Find(&doctors).Error
+	return doctors, err
+}
 
+// returns doctors with schedules and upcoming reservations related to the interval
+func (d *doctorsDAO) GetAllWithSchedule(window Window) ([]Doctor, error) {
+	doctors := make([]Doctor, 0)
+	err := d.preload(window).Find(&doctors).Error
 	return doctors, err
 }
+
+func (d *doctorsDAO) Add(doctor *Doctor) (int, error) {
+	err := d.db.Create(doctor).Error
+	return doctor.ID, err
+}
+
+func (d *doctorsDAO) Update(doctor Doctor) error {
+	return d.db.
+		Select("name", "subtitle", "details", "category", "price", "gap", "slot_size", "time_zone", "site", "image_url", "min_notice", "max_advance", "same_day_cutoff").
+		Updates(&doctor).Error
+}
+
+// deletes the doctor with schedules and reservations,
+// ErrDoctorHasReservations is returned if there are upcoming reservations and force is not set,
+// otherwise their cancellations are recorded and the messages are added to the outbox
+func (d *doctorsDAO) Delete(id int, force bool, actor string, messages []OutboxMessage) error {
+	return d.db.Transaction(func(tx *gorm.DB) error {
+		now := d.clock.Now().UnixMilli()
+		upcoming := make([]OccupiedSlot, 0)
+		err := tx.Order("id").Find(&upcoming, "doctor_id = ? AND date >= ? AND "+activeSlots, id, now, now).Error
+		if err != nil {
+			return err
+		}
+		if len(upcoming) > 0 && !force {
+			return ErrDoctorHasReservations
+		}
+
+		for _, slot := range upcoming {
+			if slot.HoldUntil != 0 {
+				continue
+			}
+			err := tx.Create(&ReservationLog{
+				ReservationID: slot.ID,
+				Action:        ActionCancelled,
+				Actor:         actor,
+				DoctorID:      slot.DoctorID,
+				Date:          slot.Date,
+				CreatedAt:     now,
+			}).Error
+			if err != nil {
+				return err
+			}
+		}
+		if len(messages) > 0 {
+			if err := tx.Create(&messages).Error; err != nil {
+				return err
+			}
+		}
+
+		// logs of reservations are kept as the audit trail
+		reservations := tx.Model(&OccupiedSlot{}).Select("id").Where("doctor_id = ?", id)
+		if err := tx.Where("reservation_id IN (?)", reservations).Delete(&Reminder{}).Error; err != nil {
+			return err
+		}
+		if err := dropReminders(tx, reservations); err != nil {
+			return err
+		}
+		for _, model := range []interface{}{&OccupiedSlot{}, &DoctorSchedule{}, &TimeOff{}, &ServiceType{}, &WaitlistEntry{}, &Review{}, &ReviewTotal{}} {
+			err := tx.Where("doctor_id = ?", id).Delete(model).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		return tx.Delete(&Doctor{}, id).Error
+	})
+}
+
+func (d *doctorsDAO) preload(window Window) *gorm.DB {
+	now := d.clock.Now().UnixMilli()
+	from, to := window.slots(now)
+
+	// reservations of services which have started can occupy upcoming slots
+	return d.db.
+		Preload("OccupiedSlots", "(date >= ? OR date + (duration + buffer) * 60000 > ?) AND date < ? AND "+activeSlots, from, from, to, now).
+		Preload("DoctorSchedule", inWindow(window))
+}
@@ -0,0 +1,59 @@
+package data
+
+import (
+	"testing"
+	"time"
+)
+
+func testDoctorDeletion(t *testing.T, repo Repositories) {
+	doctor := addDoctor(t, repo, 30)
+
+	past, err := repo.OccupiedSlots.Create(&OccupiedSlot{DoctorID: doctor.ID, Date: time.Now().Add(-24 * time.Hour).UnixMilli(), ClientName: "Client", ClientEmail: "client@scheduler.booking"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	upcoming, err := repo.OccupiedSlots.Create(&OccupiedSlot{DoctorID: doctor.ID, Date: at(7, 10, 0), ClientName: "Client", ClientEmail: "client@scheduler.booking"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Reminders.Record(&Reminder{ReservationID: upcoming, Date: at(7, 10, 0), MinutesBefore: 60}, &OutboxMessage{Status: OutboxSent}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := repo.Doctors.Delete(doctor.ID, false, "admin", nil); err != ErrDoctorHasReservations {
+		t.Fatalf("expected ErrDoctorHasReservations, got %v", err)
+	}
+	if slot, err := repo.OccupiedSlots.GetOne(upcoming); err != nil || slot.ID != upcoming {
+		t.Fatalf("expected the reservation to be kept, got %+v (%v)", slot, err)
+	}
+
+	msg := OutboxMessage{Event: "cancelled", Recipient: "client@scheduler.booking", Status: OutboxPending, NextAttempt: 10}
+	if err := repo.Doctors.Delete(doctor.ID, true, "admin", []OutboxMessage{msg}); err != nil {
+		t.Fatal(err)
+	}
+
+	if deleted, err := repo.Doctors.GetOne(doctor.ID); err != nil || deleted.ID != 0 {
+		t.Fatalf("expected the doctor to be deleted, got %+v (%v)", deleted, err)
+	}
+	if slots, err := repo.OccupiedSlots.GetAll(); err != nil || len(slots) != 0 {
+		t.Fatalf("expected reservations to be deleted, got %+v (%v)", slots, err)
+	}
+
+	// only upcoming reservations are cancelled
+	logs, err := repo.OccupiedSlots.GetLogs(upcoming)
+	if err != nil || len(logs) != 1 || logs[0].Action != ActionCancelled || logs[0].Actor != "admin" || logs[0].Date != at(7, 10, 0) {
+		t.Fatalf("expected the cancellation by the admin, got %+v (%v)", logs, err)
+	}
+	if logs, err := repo.OccupiedSlots.GetLogs(past); err != nil || len(logs) != 0 {
+		t.Fatalf("expected no logs of the past reservation, got %+v (%v)", logs, err)
+	}
+	if due, err := repo.Outbox.GetDue(10, 10); err != nil || len(due) != 1 || due[0].Event != "cancelled" {
+		t.Fatalf("expected the cancellation message, got %+v (%v)", due, err)
+	}
+
+	// reminders of deleted reservations are deleted as well
+	ok, err := repo.Reminders.Record(&Reminder{ReservationID: upcoming, Date: at(7, 10, 0), MinutesBefore: 60}, &OutboxMessage{Status: OutboxSent})
+	if err != nil || !ok {
+		t.Fatalf("expected the reminder to be deleted, got %v (%v)", ok, err)
+	}
+}
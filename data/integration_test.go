@@ -0,0 +1,202 @@
+//go:build integration
+
+package data
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+// runs the suite against sqlite and the engines set by TEST_POSTGRES_DSN and TEST_MYSQL_DSN:
+//
+//	TEST_POSTGRES_DSN="host=localhost user=postgres password=postgres dbname=booking sslmode=disable" \
+//	TEST_MYSQL_DSN="root:root@tcp(localhost:3306)/booking" \
+//	go test -tags integration ./data/
+func TestEngines(t *testing.T) {
+	configs := map[string]DBConfig{
+		"sqlite":   {Driver: "sqlite", Path: filepath.Join(t.TempDir(), "db.sqlite")},
+		"postgres": {Driver: "postgres", DSN: os.Getenv("TEST_POSTGRES_DSN")},
+		"mysql":    {Driver: "mysql", DSN: os.Getenv("TEST_MYSQL_DSN")},
+	}
+
+	for name, config := range configs {
+		config := config
+		t.Run(name, func(t *testing.T) {
+			if config.Driver != "sqlite" && config.DSN == "" {
+				t.Skipf("DSN of %s is not set", name)
+			}
+
+			dao := NewDAO(config)
+			t.Cleanup(func() { clearData(t, dao) })
+
+			testRepositories(t, func(t *testing.T) Repositories {
+				clearData(t, dao)
+				return dao.Repositories
+			})
+			testMigrations(t, config)
+		})
+	}
+}
+
+// deletes all data
+func clearData(t *testing.T, dao *DAO) {
+	tx := dao.db.Session(&gorm.Session{AllowGlobalUpdate: true})
+	for _, model := range []interface{}{&Doctor{}, &Review{}, &ReviewTotal{}, &DoctorSchedule{}, &OccupiedSlot{}, &ReservationLog{}, &Closure{}, &TimeOff{}, &ServiceType{}, &WaitlistEntry{}, &OutboxMessage{}, &Reminder{}, &Lease{}} {
+		if err := tx.Delete(model).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func testMigrations(t *testing.T, config DBConfig) {
+	m, err := NewMigrator(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if pending, err := m.Pending(); err != nil || len(pending) != 0 {
+		t.Fatalf("expected no pending migrations, got %v (%v)", pending, err)
+	}
+
+	done, err := m.Down(len(migrations))
+	if err != nil || len(done) != len(migrations) || done[0] != migrations[len(migrations)-1].Version {
+		t.Fatalf("expected all migrations to be reverted, got %v (%v)", done, err)
+	}
+	if m.db.Migrator().HasTable("doctors") {
+		t.Fatal("expected dropped tables")
+	}
+
+	done, err = m.Up(1)
+	if err != nil || len(done) != 1 || done[0] != 1 {
+		t.Fatalf("expected the first migration, got %v (%v)", done, err)
+	}
+	if done, err = m.Up(0); err != nil || len(done) != len(migrations)-1 {
+		t.Fatalf("expected the rest of migrations, got %v (%v)", done, err)
+	}
+	if !m.db.Migrator().HasIndex("doctor_schedules", "idx_doctor_schedules_doctor_date") {
+		t.Fatal("expected the index of schedules")
+	}
+
+	status, err := m.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range status {
+		if !s.Applied {
+			t.Fatalf("expected applied migration %d", s.Version)
+		}
+	}
+}
+
+// databases created before migrations are upgraded by them
+func TestLegacySchema(t *testing.T) {
+	config := DBConfig{Driver: "sqlite", Path: filepath.Join(t.TempDir(), "db.sqlite")}
+	doctorID, slots := createBaseline(t, config)
+
+	dao := NewDAO(config)
+
+	kept, err := dao.OccupiedSlots.GetAll()
+	if err != nil || len(kept) != 2 || kept[0].ID != slots[0] || kept[1].ID != slots[2] {
+		t.Fatalf("expected the first reservation of the slot, got %+v (%v)", kept, err)
+	}
+	logs, err := dao.OccupiedSlots.GetLogs(slots[1])
+	if err != nil || len(logs) != 1 || logs[0].Action != ActionCancelled {
+		t.Fatalf("expected the cancellation of the double booking, got %+v (%v)", logs, err)
+	}
+
+	reviews, err := dao.Reviews.GetAll(doctorID)
+	if err != nil || len(reviews) != 0 {
+		t.Fatalf("expected no reviews of patients, got %+v (%v)", reviews, err)
+	}
+	for _, id := range slots {
+		if _, err := dao.Reviews.Add(&Review{DoctorID: doctorID, ReservationID: id, Stars: 5}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	summaries, err := dao.Reviews.GetSummaries()
+	if summary := summaries[doctorID]; err != nil || summary.Count != 1248 || summary.Distribution[3] != 1245 || summary.Distribution[4] != 3 {
+		t.Fatalf("expected the total of legacy reviews in the summary, got %+v (%v)", summary, err)
+	}
+	if doctor, err := dao.Doctors.GetOne(doctorID); err != nil || doctor.Site != doctor.TimeZone {
+		t.Fatalf("expected the time zone as the location of the doctor, got %+v (%v)", doctor, err)
+	}
+
+	m, err := NewMigrator(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pending, err := m.Pending(); err != nil || len(pending) != 0 {
+		t.Fatalf("expected no pending migrations, got %v (%v)", pending, err)
+	}
+}
+
+// creates tables of the baseline and returns the doctor and its reservations
+func createBaseline(t *testing.T, config DBConfig) (int, []int) {
+	db, err := connect(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type Doctor struct {
+		ID       int
+		Name     string
+		Subtitle string
+		Details  string
+		Category string
+		Price    string
+		Gap      int
+		SlotSize int
+		ImageURL string
+	}
+	type Review struct {
+		ID       int
+		Count    int
+		Stars    int
+		DoctorID int
+	}
+	type DoctorSchedule struct {
+		ID               int
+		DoctorID         int
+		From             int
+		To               int
+		Date             int64
+		Rrule            string
+		RecurringEventID string
+		OriginalStart    string
+		Duration         int
+		Deleted          bool
+	}
+	type OccupiedSlot struct {
+		ID            int
+		DoctorID      int
+		Date          int64
+		ClientName    string
+		ClientEmail   string
+		ClientDetails string
+	}
+	if err := db.AutoMigrate(&Doctor{}, &Review{}, &DoctorSchedule{}, &OccupiedSlot{}); err != nil {
+		t.Fatal(err)
+	}
+
+	doctor := Doctor{Name: "Dr. Legacy", SlotSize: 30}
+	if err := db.Create(&doctor).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&Review{DoctorID: doctor.ID, Count: 1245, Stars: 4}).Error; err != nil {
+		t.Fatal(err)
+	}
+	// the baseline didn't prevent double bookings
+	slots := []OccupiedSlot{
+		{DoctorID: doctor.ID, Date: at(7, 9, 0), ClientName: "First"},
+		{DoctorID: doctor.ID, Date: at(7, 9, 0), ClientName: "Second"},
+		{DoctorID: doctor.ID, Date: at(7, 10, 0), ClientName: "Third"},
+	}
+	if err := db.Create(&slots).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	return doctor.ID, []int{slots[0].ID, slots[1].ID, slots[2].ID}
+}
@@ -0,0 +1,34 @@
+package data
+
+import (
+	"gorm.io/gorm"
+)
+
+type leasesDAO struct {
+	db *gorm.DB
+}
+
+func newLeasesDAO(db *gorm.DB) *leasesDAO {
+	return &leasesDAO{db}
+}
+
+// the conditional update lets only one replica take the expired lease
+func (d *leasesDAO) Acquire(name, owner string, now, until int64) (bool, error) {
+	res := d.db.Model(&Lease{}).
+		Where("name = ? AND (owner = ? OR expires <= ?)", name, owner, now).
+		Updates(map[string]interface{}{"owner": owner, "expires": until})
+	if res.Error != nil {
+		return false, res.Error
+	}
+	if res.RowsAffected > 0 {
+		return true, nil
+	}
+
+	// the first run of the job
+	err := d.db.Create(&Lease{Name: name, Owner: owner, Expires: until}).Error
+	if isUniqueViolation(err) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
@@ -0,0 +1,38 @@
+package data
+
+import (
+	"testing"
+)
+
+func testLeases(t *testing.T, repo Repositories) {
+	acquire := func(name, owner string, now, until int64) bool {
+		t.Helper()
+		ok, err := repo.Leases.Acquire(name, owner, now, until)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ok
+	}
+
+	if !acquire("job", "first", 10, 20) {
+		t.Fatal("expected the new lease")
+	}
+	if acquire("job", "second", 15, 25) {
+		t.Fatal("expected the active lease of another owner")
+	}
+	if !acquire("other", "second", 15, 25) {
+		t.Fatal("expected the lease of another job")
+	}
+	if !acquire("job", "first", 18, 28) {
+		t.Fatal("expected the extended lease")
+	}
+	if acquire("job", "second", 20, 30) {
+		t.Fatal("expected the extended lease of another owner")
+	}
+	if !acquire("job", "second", 28, 38) {
+		t.Fatal("expected the expired lease to be taken")
+	}
+	if acquire("job", "first", 30, 40) {
+		t.Fatal("expected the lease to be taken by another owner")
+	}
+}
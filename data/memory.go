@@ -0,0 +1,1043 @@
+package data
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// in-memory storage with the same behavior as the SQL database,
+// it is used to embed the booking engine and in tests
+type memory struct {
+	mu    sync.Mutex
+	clock Clock
+
+	ids       map[string]int // last ids of entities
+	doctors   map[int]Doctor // without associations
+	schedules map[int]DoctorSchedule
+	slots     map[int]OccupiedSlot
+	logs      map[int]ReservationLog
+	reviews   map[int]Review
+	closures  map[int]Closure
+	timeOff   map[int]TimeOff
+	services  map[int]ServiceType
+	waitlist  map[int]WaitlistEntry
+	outbox    map[int]OutboxMessage
+	reminders map[int]Reminder
+	leases    map[string]Lease
+}
+
+// returns repositories which keep data in memory
+func NewMemory(clock Clock) Repositories {
+	m := &memory{
+		clock:     clock,
+		ids:       make(map[string]int),
+		doctors:   make(map[int]Doctor),
+		schedules: make(map[int]DoctorSchedule),
+		slots:     make(map[int]OccupiedSlot),
+		logs:      make(map[int]ReservationLog),
+		reviews:   make(map[int]Review),
+		closures:  make(map[int]Closure),
+		timeOff:   make(map[int]TimeOff),
+		services:  make(map[int]ServiceType),
+		waitlist:  make(map[int]WaitlistEntry),
+		outbox:    make(map[int]OutboxMessage),
+		reminders: make(map[int]Reminder),
+		leases:    make(map[string]Lease),
+	}
+
+	return Repositories{
+		Clock:           clock,
+		Doctors:         &memoryDoctors{m},
+		DoctorsSchedule: &memorySchedules{m},
+		OccupiedSlots:   &memorySlots{m},
+		Reviews:         &memoryReviews{m},
+		Closures:        &memoryClosures{m},
+		TimeOff:         &memoryTimeOff{m},
+		Services:        &memoryServices{m},
+		Waitlist:        &memoryWaitlist{m},
+		Outbox:          &memoryOutbox{m},
+		Reminders:       &memoryReminders{m},
+		Leases:          &memoryLeases{m},
+	}
+}
+
+// returns the next id of the entity
+func (m *memory) nextID(entity string) int {
+	m.ids[entity]++
+	return m.ids[entity]
+}
+
+func (m *memory) now() int64 {
+	return m.clock.Now().UnixMilli()
+}
+
+// returns values of the map sorted by ids
+func sorted[T any](items map[int]T, keep func(T) bool) []T {
+	ids := make([]int, 0, len(items))
+	for id, item := range items {
+		if keep == nil || keep(item) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+
+	out := make([]T, len(ids))
+	for i, id := range ids {
+		out[i] = items[id]
+	}
+
+	return out
+}
+
+func isActive(slot OccupiedSlot, now int64) bool {
+	return slot.HoldUntil == 0 || slot.HoldUntil >= now
+}
+
+type memoryDoctors struct {
+	m *memory
+}
+
+func (d *memoryDoctors) GetOne(id int) (Doctor, error) {
+	d.m.mu.Lock()
+	defer d.m.mu.Unlock()
+
+	return d.m.doctors[id], nil
+}
+
+func (d *memoryDoctors) GetOneWithSchedule(id int, window Window) (Doctor, error) {
+	d.m.mu.Lock()
+	defer d.m.mu.Unlock()
+
+	doctor, ok := d.m.doctors[id]
+	if !ok {
+		return Doctor{}, nil
+	}
+
+	return d.withSchedule(doctor, window), nil
+}
+
+func (d *memoryDoctors) GetAll() ([]Doctor, error) {
+	d.m.mu.Lock()
+	defer d.m.mu.Unlock()
+
+	return sorted(d.m.doctors, nil), nil
+}
+
+func (d *memoryDoctors) GetAllWithSchedule(window Window) ([]Doctor, error) {
+	d.m.mu.Lock()
+	defer d.m.mu.Unlock()
+
+	doctors := sorted(d.m.doctors, nil)
+	for i := range doctors {
+		doctors[i] = d.withSchedule(doctors[i], window)
+	}
+
+	return doctors, nil
+}
+
+func (d *memoryDoctors) withSchedule(doctor Doctor, window Window) Doctor {
+	now := d.m.now()
+	from, to := window.slots(now)
+
+	doctor.DoctorSchedule = sorted(d.m.schedules, func(sch DoctorSchedule) bool {
+		return sch.DoctorID == doctor.ID && window.includes(sch)
+	})
+	doctor.OccupiedSlots = sorted(d.m.slots, func(slot OccupiedSlot) bool {
+		return slot.DoctorID == doctor.ID && (slot.Date >= from || slot.end() > from) && slot.Date < to && isActive(slot, now)
+	})
+
+	return doctor
+}
+
+func (d *memoryDoctors) Add(doctor *Doctor) (int, error) {
+	d.m.mu.Lock()
+	defer d.m.mu.Unlock()
+
+	// reservations of the doctor must not take the same slot
+	used := make(map[int64]bool)
+	for _, slot := range doctor.OccupiedSlots {
+		if used[slot.Date] {
+			return 0, ErrSlotTaken
+		}
+		used[slot.Date] = true
+	}
+
+	doctor.ID = d.m.nextID("doctor")
+	for i := range doctor.DoctorSchedule {
+		sch := &doctor.DoctorSchedule[i]
+		sch.ID = d.m.nextID("schedule")
+		sch.DoctorID = doctor.ID
+		d.m.schedules[sch.ID] = *sch
+	}
+	for i := range doctor.OccupiedSlots {
+		slot := &doctor.OccupiedSlots[i]
+		slot.ID = d.m.nextID("slot")
+		slot.DoctorID = doctor.ID
+		d.m.slots[slot.ID] = *slot
+	}
+
+	record := *doctor
+	record.DoctorSchedule = nil
+	record.OccupiedSlots = nil
+	if record.TimeZone == "" {
+		record.TimeZone = "UTC"
+	}
+	d.m.doctors[record.ID] = record
+
+	return doctor.ID, nil
+}
+
+func (d *memoryDoctors) Update(doctor Doctor) error {
+	d.m.mu.Lock()
+	defer d.m.mu.Unlock()
+
+	if _, ok := d.m.doctors[doctor.ID]; ok {
+		doctor.DoctorSchedule = nil
+		doctor.OccupiedSlots = nil
+		d.m.doctors[doctor.ID] = doctor
+	}
+
+	return nil
+}
+
+func (d *memoryDoctors) Delete(id int, force bool, actor string, messages []OutboxMessage) error {
+	d.m.mu.Lock()
+	defer d.m.mu.Unlock()
+
+	now := d.m.now()
+	upcoming := sorted(d.m.slots, func(slot OccupiedSlot) bool {
+		return slot.DoctorID == id && slot.Date >= now && isActive(slot, now)
+	})
+	if len(upcoming) > 0 && !force {
+		return ErrDoctorHasReservations
+	}
+
+	for _, slot := range upcoming {
+		if slot.HoldUntil != 0 {
+			continue
+		}
+		record := ReservationLog{
+			ID:            d.m.nextID("log"),
+			ReservationID: slot.ID,
+			Action:        ActionCancelled,
+			Actor:         actor,
+			DoctorID:      slot.DoctorID,
+			Date:          slot.Date,
+			CreatedAt:     now,
+		}
+		d.m.logs[record.ID] = record
+	}
+	for _, msg := range messages {
+		msg.ID = d.m.nextID("outbox")
+		d.m.outbox[msg.ID] = msg
+	}
+
+	d.m.dropReminders(func(reservationID int) bool { return d.m.slots[reservationID].DoctorID == id })
+	for rid, reminder := range d.m.reminders {
+		if d.m.slots[reminder.ReservationID].DoctorID == id {
+			delete(d.m.reminders, rid)
+		}
+	}
+	for sid, slot := range d.m.slots {
+		if slot.DoctorID == id {
+			delete(d.m.slots, sid)
+		}
+	}
+	for sid, sch := range d.m.schedules {
+		if sch.DoctorID == id {
+			delete(d.m.schedules, sid)
+		}
+	}
+	for tid, timeOff := range d.m.timeOff {
+		if timeOff.DoctorID == id {
+			delete(d.m.timeOff, tid)
+		}
+	}
+	for sid, service := range d.m.services {
+		if service.DoctorID == id {
+			delete(d.m.services, sid)
+		}
+	}
+	for eid, entry := range d.m.waitlist {
+		if entry.DoctorID == id {
+			delete(d.m.waitlist, eid)
+		}
+	}
+	for rid, review := range d.m.reviews {
+		if review.DoctorID == id {
+			delete(d.m.reviews, rid)
+		}
+	}
+	delete(d.m.doctors, id)
+
+	return nil
+}
+
+type memorySchedules struct {
+	m *memory
+}
+
+func (d *memorySchedules) GetOne(id int) (DoctorSchedule, error) {
+	d.m.mu.Lock()
+	defer d.m.mu.Unlock()
+
+	return d.m.schedules[id], nil
+}
+
+func (d *memorySchedules) GetAll(window Window) ([]DoctorSchedule, error) {
+	d.m.mu.Lock()
+	defer d.m.mu.Unlock()
+
+	return sorted(d.m.schedules, window.includes), nil
+}
+
+func (d *memorySchedules) Add(doctorID, from, to int, date int64, rrule string, duration int, original string, recID string, deleted bool) (int, error) {
+	if date == 0 {
+		return 0, errors.New("date argument not defined")
+	}
+
+	d.m.mu.Lock()
+	defer d.m.mu.Unlock()
+
+	sch := DoctorSchedule{
+		ID:               d.m.nextID("schedule"),
+		DoctorID:         doctorID,
+		From:             from,
+		To:               to,
+		Date:             date,
+		Rrule:            rrule,
+		RecurringEventID: recID,
+		OriginalStart:    original,
+		Duration:         duration,
+		Deleted:          deleted,
+	}
+	d.m.schedules[sch.ID] = sch
+
+	return sch.ID, nil
+}
+
+func (d *memorySchedules) Update(id, doctorID, from, to int, date int64, rrule string, duration int, original string, recID string, deleted bool) error {
+	d.m.mu.Lock()
+	defer d.m.mu.Unlock()
+
+	sch := DoctorSchedule{
+		ID:               id,
+		DoctorID:         doctorID,
+		From:             from,
+		To:               to,
+		Date:             date,
+		Rrule:            rrule,
+		RecurringEventID: recID,
+		OriginalStart:    original,
+		Duration:         duration,
+		Deleted:          deleted,
+	}
+
+	// the schedule of another doctor is created anew
+	if d.m.schedules[id].DoctorID != doctorID {
+		delete(d.m.schedules, id)
+		sch.ID = d.m.nextID("schedule")
+	}
+	d.m.schedules[sch.ID] = sch
+
+	return nil
+}
+
+func (d *memorySchedules) Delete(id int) error {
+	d.m.mu.Lock()
+	defer d.m.mu.Unlock()
+
+	recID := strconv.Itoa(id)
+	for sid, sch := range d.m.schedules {
+		if sch.RecurringEventID == recID {
+			delete(d.m.schedules, sid)
+		}
+	}
+	delete(d.m.schedules, id)
+
+	return nil
+}
+
+type memorySlots struct {
+	m *memory
+}
+
+func (d *memorySlots) GetOne(id int) (OccupiedSlot, error) {
+	d.m.mu.Lock()
+	defer d.m.mu.Unlock()
+
+	return d.m.slots[id], nil
+}
+
+func (d *memorySlots) GetAll() ([]OccupiedSlot, error) {
+	d.m.mu.Lock()
+	defer d.m.mu.Unlock()
+
+	return sorted(d.m.slots, func(slot OccupiedSlot) bool { return slot.HoldUntil == 0 }), nil
+}
+
+func (d *memorySlots) GetUpcoming(from, to int64) ([]OccupiedSlot, error) {
+	d.m.mu.Lock()
+	defer d.m.mu.Unlock()
+
+	slots := sorted(d.m.slots, func(slot OccupiedSlot) bool {
+		return slot.HoldUntil == 0 && slot.Date > from && slot.Date <= to
+	})
+	sort.SliceStable(slots, func(i, j int) bool { return slots[i].Date < slots[j].Date })
+
+	return slots, nil
+}
+
+func (d *memorySlots) GetOverlapping(doctorID int, from, to int64) ([]OccupiedSlot, error) {
+	d.m.mu.Lock()
+	defer d.m.mu.Unlock()
+
+	doctor := d.m.doctors[doctorID]
+	slots := sorted(d.m.slots, func(slot OccupiedSlot) bool {
+		if slot.DoctorID != doctorID || slot.HoldUntil != 0 || slot.Date >= to {
+			return false
+		}
+		length := slot.Duration + slot.Buffer
+		if slot.Duration == 0 {
+			length = doctor.SlotSize
+		}
+		return slot.Date+int64(length)*60*1000 > from
+	})
+	sort.SliceStable(slots, func(i, j int) bool { return slots[i].Date < slots[j].Date })
+
+	return slots, nil
+}
+
+func (d *memorySlots) GetUsedSlots(doctorID int, date int64) ([]OccupiedSlot, error) {
+	d.m.mu.Lock()
+	defer d.m.mu.Unlock()
+
+	now := d.m.now()
+	return sorted(d.m.slots, func(slot OccupiedSlot) bool {
+		return slot.DoctorID == doctorID && slot.Date == date && isActive(slot, now)
+	}), nil
+}
+
+func (d *memorySlots) Create(record *OccupiedSlot, msg *OutboxMessage) (int, error) {
+	return d.create(record, msg)
+}
+
+func (d *memorySlots) create(record *OccupiedSlot, msg *OutboxMessage) (int, error) {
+	d.m.mu.Lock()
+	defer d.m.mu.Unlock()
+
+	seat, ok := d.freeSeat(*record, 0)
+	if !ok {
+		return 0, ErrSlotTaken
+	}
+
+	record.Seat = seat
+	record.ID = d.m.nextID("slot")
+	d.m.slots[record.ID] = *record
+	d.m.enqueue(msg)
+
+	return record.ID, nil
+}
+
+// deletes expired holds overlapping the record and returns the free seat of its session,
+// false is returned if there is no such seat
+func (d *memorySlots) freeSeat(record OccupiedSlot, except int) (int, bool) {
+	now := d.m.now()
+	overlapping := make([]OccupiedSlot, 0)
+	for id, slot := range d.m.slots {
+		if !slot.overlaps(record) || id == except {
+			continue
+		}
+		if !isActive(slot, now) {
+			delete(d.m.slots, id)
+			continue
+		}
+
+		overlapping = append(overlapping, slot)
+	}
+
+	return freeSeat(record, overlapping)
+}
+
+func (m *memory) activeHold(token string) (OccupiedSlot, bool) {
+	now := m.now()
+	slots := sorted(m.slots, func(slot OccupiedSlot) bool {
+		return slot.HoldToken == token && slot.HoldUntil >= now
+	})
+	if len(slots) == 0 {
+		return OccupiedSlot{}, false
+	}
+
+	return slots[0], true
+}
+
+func (d *memorySlots) GetHold(token string) (OccupiedSlot, error) {
+	d.m.mu.Lock()
+	defer d.m.mu.Unlock()
+
+	slot, ok := d.m.activeHold(token)
+	if !ok {
+		return slot, ErrHoldNotFound
+	}
+
+	return slot, nil
+}
+
+func (d *memorySlots) ConfirmHold(token, name, email, details string, msg *OutboxMessage) (int, error) {
+	d.m.mu.Lock()
+	defer d.m.mu.Unlock()
+
+	slot, ok := d.m.activeHold(token)
+	if !ok {
+		return 0, ErrHoldNotFound
+	}
+
+	slot.ClientName = name
+	slot.ClientEmail = email
+	slot.ClientDetails = details
+	slot.HoldToken = ""
+	slot.HoldUntil = 0
+	d.m.slots[slot.ID] = slot
+	d.m.enqueue(msg)
+
+	return slot.ID, nil
+}
+
+func (d *memorySlots) DeleteHold(token string) error {
+	d.m.mu.Lock()
+	defer d.m.mu.Unlock()
+
+	for id, slot := range d.m.slots {
+		if slot.HoldToken == token && slot.HoldUntil > 0 {
+			delete(d.m.slots, id)
+		}
+	}
+
+	return nil
+}
+
+func (d *memorySlots) DeleteExpiredHolds() (int64, error) {
+	d.m.mu.Lock()
+	defer d.m.mu.Unlock()
+
+	now := d.m.now()
+	var count int64
+	for id, slot := range d.m.slots {
+		if slot.HoldUntil > 0 && slot.HoldUntil < now {
+			delete(d.m.slots, id)
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+func (d *memorySlots) Delete(id int, actor string, msg *OutboxMessage) error {
+	d.m.mu.Lock()
+	defer d.m.mu.Unlock()
+
+	slot := d.m.slots[id]
+	delete(d.m.slots, id)
+	d.m.dropReminders(func(reservationID int) bool { return reservationID == id })
+	d.log(ReservationLog{
+		ReservationID: id,
+		Action:        ActionCancelled,
+		Actor:         actor,
+		DoctorID:      slot.DoctorID,
+		Date:          slot.Date,
+	})
+	d.m.enqueue(msg)
+
+	return nil
+}
+
+func (d *memorySlots) Move(id, doctor int, date int64, actor string, msg *OutboxMessage) error {
+	d.m.mu.Lock()
+	defer d.m.mu.Unlock()
+
+	slot, ok := d.m.slots[id]
+	moved := slot
+	moved.DoctorID = doctor
+	moved.Date = date
+	seat, free := d.freeSeat(moved, id)
+	if !free {
+		return ErrSlotTaken
+	}
+	if ok {
+		moved.Seat = seat
+		d.m.slots[id] = moved
+		d.m.dropReminders(func(reservationID int) bool { return reservationID == id })
+	}
+	d.log(ReservationLog{
+		ReservationID: id,
+		Action:        ActionRescheduled,
+		Actor:         actor,
+		DoctorID:      slot.DoctorID,
+		Date:          slot.Date,
+		NewDoctorID:   doctor,
+		NewDate:       date,
+	})
+	d.m.enqueue(msg)
+
+	return nil
+}
+
+func (d *memorySlots) log(record ReservationLog) {
+	record.ID = d.m.nextID("log")
+	record.CreatedAt = d.m.now()
+	d.m.logs[record.ID] = record
+}
+
+func (d *memorySlots) GetLogs(id int) ([]ReservationLog, error) {
+	d.m.mu.Lock()
+	defer d.m.mu.Unlock()
+
+	return sorted(d.m.logs, func(l ReservationLog) bool { return l.ReservationID == id }), nil
+}
+
+type memoryReviews struct {
+	m *memory
+}
+
+func (d *memoryReviews) GetAll(doctorID int) ([]Review, error) {
+	d.m.mu.Lock()
+	defer d.m.mu.Unlock()
+
+	reviews := sorted(d.m.reviews, func(r Review) bool { return r.DoctorID == doctorID })
+	sort.SliceStable(reviews, func(i, j int) bool { return reviews[i].CreatedAt > reviews[j].CreatedAt })
+
+	return reviews, nil
+}
+
+func (d *memoryReviews) Add(review *Review) (int, error) {
+	d.m.mu.Lock()
+	defer d.m.mu.Unlock()
+
+	for _, r := range d.m.reviews {
+		if r.ReservationID == review.ReservationID {
+			return 0, ErrReviewExists
+		}
+	}
+
+	review.ID = d.m.nextID("review")
+	d.m.reviews[review.ID] = *review
+
+	return review.ID, nil
+}
+
+func (d *memoryReviews) GetSummaries() (map[int]ReviewSummary, error) {
+	d.m.mu.Lock()
+	defer d.m.mu.Unlock()
+
+	summaries := make(map[int]ReviewSummary)
+	for _, r := range d.m.reviews {
+		if r.Stars < 1 || r.Stars > 5 {
+			continue
+		}
+
+		summary := summaries[r.DoctorID]
+		summary.Distribution[r.Stars-1]++
+		summaries[r.DoctorID] = summary
+	}
+	completeSummaries(summaries)
+
+	return summaries, nil
+}
+
+type memoryClosures struct {
+	m *memory
+}
+
+func (d *memoryClosures) GetOne(id int) (Closure, error) {
+	d.m.mu.Lock()
+	defer d.m.mu.Unlock()
+
+	return d.m.closures[id], nil
+}
+
+func (d *memoryClosures) GetAll(window Window) ([]Closure, error) {
+	d.m.mu.Lock()
+	defer d.m.mu.Unlock()
+
+	closures := sorted(d.m.closures, func(c Closure) bool { return c.StartDate < window.To && c.EndDate > window.From })
+	sort.SliceStable(closures, func(i, j int) bool { return closures[i].StartDate < closures[j].StartDate })
+
+	return closures, nil
+}
+
+func (d *memoryClosures) Add(closure *Closure) (int, error) {
+	d.m.mu.Lock()
+	defer d.m.mu.Unlock()
+
+	closure.ID = d.m.nextID("closure")
+	d.m.closures[closure.ID] = *closure
+
+	return closure.ID, nil
+}
+
+func (d *memoryClosures) Update(closure Closure) error {
+	d.m.mu.Lock()
+	defer d.m.mu.Unlock()
+
+	if _, ok := d.m.closures[closure.ID]; ok {
+		d.m.closures[closure.ID] = closure
+	}
+
+	return nil
+}
+
+func (d *memoryClosures) Delete(id int) error {
+	d.m.mu.Lock()
+	defer d.m.mu.Unlock()
+
+	delete(d.m.closures, id)
+	return nil
+}
+
+type memoryTimeOff struct {
+	m *memory
+}
+
+func (d *memoryTimeOff) GetOne(id int) (TimeOff, error) {
+	d.m.mu.Lock()
+	defer d.m.mu.Unlock()
+
+	return d.m.timeOff[id], nil
+}
+
+func (d *memoryTimeOff) GetAll(window Window) ([]TimeOff, error) {
+	d.m.mu.Lock()
+	defer d.m.mu.Unlock()
+
+	timeOff := sorted(d.m.timeOff, func(t TimeOff) bool { return t.StartDate < window.To && t.EndDate > window.From })
+	sort.SliceStable(timeOff, func(i, j int) bool { return timeOff[i].StartDate < timeOff[j].StartDate })
+
+	return timeOff, nil
+}
+
+func (d *memoryTimeOff) Add(timeOff *TimeOff) (int, error) {
+	d.m.mu.Lock()
+	defer d.m.mu.Unlock()
+
+	timeOff.ID = d.m.nextID("timeOff")
+	d.m.timeOff[timeOff.ID] = *timeOff
+
+	return timeOff.ID, nil
+}
+
+func (d *memoryTimeOff) Update(timeOff TimeOff) error {
+	d.m.mu.Lock()
+	defer d.m.mu.Unlock()
+
+	if _, ok := d.m.timeOff[timeOff.ID]; ok {
+		d.m.timeOff[timeOff.ID] = timeOff
+	}
+
+	return nil
+}
+
+func (d *memoryTimeOff) Delete(id int) error {
+	d.m.mu.Lock()
+	defer d.m.mu.Unlock()
+
+	delete(d.m.timeOff, id)
+	return nil
+}
+
+type memoryServices struct {
+	m *memory
+}
+
+func (d *memoryServices) GetOne(id int) (ServiceType, error) {
+	d.m.mu.Lock()
+	defer d.m.mu.Unlock()
+
+	return d.m.services[id], nil
+}
+
+func (d *memoryServices) GetAll(doctorID int) ([]ServiceType, error) {
+	d.m.mu.Lock()
+	defer d.m.mu.Unlock()
+
+	return sorted(d.m.services, func(s ServiceType) bool { return doctorID == 0 || s.DoctorID == doctorID }), nil
+}
+
+func (d *memoryServices) Add(service *ServiceType) (int, error) {
+	d.m.mu.Lock()
+	defer d.m.mu.Unlock()
+
+	service.ID = d.m.nextID("service")
+	d.m.services[service.ID] = *service
+
+	return service.ID, nil
+}
+
+func (d *memoryServices) Update(service ServiceType) error {
+	d.m.mu.Lock()
+	defer d.m.mu.Unlock()
+
+	if _, ok := d.m.services[service.ID]; ok {
+		d.m.services[service.ID] = service
+	}
+
+	return nil
+}
+
+func (d *memoryServices) Delete(id int) error {
+	d.m.mu.Lock()
+	defer d.m.mu.Unlock()
+
+	delete(d.m.services, id)
+	return nil
+}
+
+type memoryWaitlist struct {
+	m *memory
+}
+
+func (d *memoryWaitlist) GetOne(id int) (WaitlistEntry, error) {
+	d.m.mu.Lock()
+	defer d.m.mu.Unlock()
+
+	return d.m.waitlist[id], nil
+}
+
+func (d *memoryWaitlist) GetAll(doctorID int) ([]WaitlistEntry, error) {
+	d.m.mu.Lock()
+	defer d.m.mu.Unlock()
+
+	return sorted(d.m.waitlist, func(e WaitlistEntry) bool { return doctorID == 0 || e.DoctorID == doctorID }), nil
+}
+
+func (d *memoryWaitlist) GetExpiredOffers(now int64) ([]WaitlistEntry, error) {
+	d.m.mu.Lock()
+	defer d.m.mu.Unlock()
+
+	return sorted(d.m.waitlist, func(e WaitlistEntry) bool { return e.Status == WaitlistOffered && e.OfferUntil < now }), nil
+}
+
+func (d *memoryWaitlist) GetByOffer(token string) (WaitlistEntry, error) {
+	d.m.mu.Lock()
+	defer d.m.mu.Unlock()
+
+	entries := sorted(d.m.waitlist, func(e WaitlistEntry) bool { return e.OfferToken == token })
+	if len(entries) == 0 {
+		return WaitlistEntry{}, nil
+	}
+
+	return entries[0], nil
+}
+
+func (d *memoryWaitlist) Add(entry *WaitlistEntry) (int, error) {
+	d.m.mu.Lock()
+	defer d.m.mu.Unlock()
+
+	entry.ID = d.m.nextID("waitlist")
+	d.m.waitlist[entry.ID] = *entry
+
+	return entry.ID, nil
+}
+
+func (d *memoryWaitlist) ExpireWaiting(doctorID int, wall int64) (int64, error) {
+	d.m.mu.Lock()
+	defer d.m.mu.Unlock()
+
+	var count int64
+	for id, entry := range d.m.waitlist {
+		if entry.DoctorID == doctorID && entry.Status == WaitlistWaiting && entry.EndDate < wall {
+			entry.Status = WaitlistExpired
+			d.m.waitlist[id] = entry
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+func (d *memoryWaitlist) Offer(id int, token string, date, until int64) (bool, error) {
+	d.m.mu.Lock()
+	defer d.m.mu.Unlock()
+
+	entry, ok := d.m.waitlist[id]
+	if !ok || entry.Status != WaitlistWaiting {
+		return false, nil
+	}
+
+	entry.Status = WaitlistOffered
+	entry.OfferToken = token
+	entry.OfferDate = date
+	entry.OfferUntil = until
+	d.m.waitlist[id] = entry
+
+	return true, nil
+}
+
+func (d *memoryWaitlist) Close(id int, status string, reservationID int) (bool, error) {
+	d.m.mu.Lock()
+	defer d.m.mu.Unlock()
+
+	entry, ok := d.m.waitlist[id]
+	if !ok || entry.Status != WaitlistOffered {
+		return false, nil
+	}
+
+	entry.Status = status
+	entry.ReservationID = reservationID
+	d.m.waitlist[id] = entry
+
+	return true, nil
+}
+
+func (d *memoryWaitlist) Claim(id int, msg *OutboxMessage) (int, error) {
+	d.m.mu.Lock()
+	defer d.m.mu.Unlock()
+
+	entry, ok := d.m.waitlist[id]
+	if !ok || entry.Status != WaitlistOffered {
+		return 0, ErrOfferClosed
+	}
+	slot, ok := d.m.activeHold(entry.OfferToken)
+	if !ok {
+		return 0, ErrHoldNotFound
+	}
+
+	slot.ClientName = entry.ClientName
+	slot.ClientEmail = entry.ClientEmail
+	slot.ClientDetails = entry.ClientDetails
+	slot.HoldToken = ""
+	slot.HoldUntil = 0
+	d.m.slots[slot.ID] = slot
+
+	entry.Status = WaitlistClaimed
+	entry.ReservationID = slot.ID
+	d.m.waitlist[id] = entry
+	d.m.enqueue(msg)
+
+	return slot.ID, nil
+}
+
+func (d *memoryWaitlist) Delete(id int) error {
+	d.m.mu.Lock()
+	defer d.m.mu.Unlock()
+
+	delete(d.m.waitlist, id)
+
+	return nil
+}
+
+type memoryOutbox struct {
+	m *memory
+}
+
+// adds the message if it is set, the caller holds the lock
+func (m *memory) enqueue(msg *OutboxMessage) {
+	if msg == nil {
+		return
+	}
+
+	msg.ID = m.nextID("outbox")
+	m.outbox[msg.ID] = *msg
+}
+
+// drops pending reminders of reservations which match the filter, the caller holds the lock
+func (m *memory) dropReminders(filter func(reservationID int) bool) {
+	for id, msg := range m.outbox {
+		if msg.ReservationID != 0 && msg.Status == OutboxPending && filter(msg.ReservationID) {
+			delete(m.outbox, id)
+		}
+	}
+}
+
+func (d *memoryOutbox) Add(msg *OutboxMessage) (int, error) {
+	d.m.mu.Lock()
+	defer d.m.mu.Unlock()
+
+	msg.ID = d.m.nextID("outbox")
+	d.m.outbox[msg.ID] = *msg
+
+	return msg.ID, nil
+}
+
+func (d *memoryOutbox) GetDue(now int64, limit int) ([]OutboxMessage, error) {
+	d.m.mu.Lock()
+	defer d.m.mu.Unlock()
+
+	messages := sorted(d.m.outbox, func(msg OutboxMessage) bool { return isClaimable(msg, now) })
+	if len(messages) > limit {
+		messages = messages[:limit]
+	}
+
+	return messages, nil
+}
+
+func (d *memoryOutbox) Claim(id int, now, until int64) (bool, error) {
+	d.m.mu.Lock()
+	defer d.m.mu.Unlock()
+
+	msg, ok := d.m.outbox[id]
+	if !ok || !isClaimable(msg, now) {
+		return false, nil
+	}
+
+	msg.Status = OutboxSending
+	msg.LockedUntil = until
+	d.m.outbox[id] = msg
+
+	return true, nil
+}
+
+func isClaimable(msg OutboxMessage, now int64) bool {
+	return (msg.Status == OutboxPending && msg.NextAttempt <= now) ||
+		(msg.Status == OutboxSending && msg.LockedUntil < now)
+}
+
+func (d *memoryOutbox) Update(msg OutboxMessage) error {
+	d.m.mu.Lock()
+	defer d.m.mu.Unlock()
+
+	if _, ok := d.m.outbox[msg.ID]; ok {
+		d.m.outbox[msg.ID] = msg
+	}
+
+	return nil
+}
+
+type memoryReminders struct {
+	m *memory
+}
+
+func (d *memoryReminders) Record(reminder *Reminder, msg *OutboxMessage) (bool, error) {
+	d.m.mu.Lock()
+	defer d.m.mu.Unlock()
+
+	for _, r := range d.m.reminders {
+		if r.ReservationID == reminder.ReservationID && r.Date == reminder.Date && r.MinutesBefore == reminder.MinutesBefore {
+			return false, nil
+		}
+	}
+
+	reminder.ID = d.m.nextID("reminders")
+	d.m.reminders[reminder.ID] = *reminder
+	msg.ID = d.m.nextID("outbox")
+	d.m.outbox[msg.ID] = *msg
+
+	return true, nil
+}
+
+type memoryLeases struct {
+	m *memory
+}
+
+func (d *memoryLeases) Acquire(name, owner string, now, until int64) (bool, error) {
+	d.m.mu.Lock()
+	defer d.m.mu.Unlock()
+
+	if lease, ok := d.m.leases[name]; ok && lease.Owner != owner && lease.Expires > now {
+		return false, nil
+	}
+	d.m.leases[name] = Lease{Name: name, Owner: owner, Expires: until}
+
+	return true, nil
+}
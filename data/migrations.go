@@ -0,0 +1,588 @@
+package data
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// numbered change of the schema, applied migrations are stored in the schema_migrations table
+type migration struct {
+	Version int
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error
+}
+
+// record of the applied migration
+type SchemaMigration struct {
+	Version   int `gorm:"primaryKey;autoIncrement:false"`
+	Name      string
+	AppliedAt int64 // in milliseconds
+}
+
+// state of the migration
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt int64
+}
+
+// migrations in the order of versions, versions must not be changed after the release,
+// models of the migration are its own copies, so later changes of models don't affect it
+var migrations = []migration{
+	{
+		Version: 1,
+		Name:    "initial schema",
+		Up: func(tx *gorm.DB) error {
+			type Doctor struct {
+				ID       int
+				Name     string
+				Subtitle string
+				Details  string
+				Category string
+				Price    string
+				Gap      int
+				SlotSize int
+				TimeZone string `gorm:"default:UTC"`
+				ImageURL string
+			}
+			type Review struct {
+				ID            int
+				DoctorID      int `gorm:"index"`
+				ReservationID int `gorm:"uniqueIndex"`
+				Stars         int
+				Comment       string
+				ClientName    string
+				CreatedAt     int64
+			}
+			type DoctorSchedule struct {
+				ID               int
+				DoctorID         int
+				From             int
+				To               int
+				Date             int64
+				Rrule            string
+				RecurringEventID string
+				OriginalStart    string
+				Duration         int
+				Deleted          bool
+			}
+			type OccupiedSlot struct {
+				ID            int
+				DoctorID      int   `gorm:"uniqueIndex:idx_doctor_date"`
+				Date          int64 `gorm:"uniqueIndex:idx_doctor_date"`
+				ClientName    string
+				ClientEmail   string
+				ClientDetails string
+				HoldToken     string `gorm:"index;size:64"`
+				HoldUntil     int64  `gorm:"default:0"` // legacy reservations are confirmed
+			}
+			type ReservationLog struct {
+				ID            int
+				ReservationID int `gorm:"index"`
+				Action        string
+				Actor         string
+				DoctorID      int
+				Date          int64
+				NewDoctorID   int
+				NewDate       int64
+				CreatedAt     int64
+			}
+
+			// databases created before migrations already have these tables,
+			// AutoMigrate only adds what they miss, but legacy reviews and reservations are prepared first
+			if err := tx.AutoMigrate(&ReservationLog{}); err != nil {
+				return err
+			}
+			if err := upgradeLegacyTables(tx); err != nil {
+				return err
+			}
+			return tx.AutoMigrate(&Doctor{}, &Review{}, &DoctorSchedule{}, &OccupiedSlot{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable("reservation_logs", "occupied_slots", "doctor_schedules", "reviews", "legacy_reviews", "doctors")
+		},
+	},
+	{
+		Version: 2,
+		Name:    "index of doctor schedules",
+		Up: func(tx *gorm.DB) error {
+			return tx.Exec("CREATE INDEX idx_doctor_schedules_doctor_date ON doctor_schedules (doctor_id, date)").Error
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropIndex("doctor_schedules", "idx_doctor_schedules_doctor_date")
+		},
+	},
+	{
+		Version: 3,
+		Name:    "booking policy of doctors",
+		Up: func(tx *gorm.DB) error {
+			type Doctor struct {
+				MinNotice     int `gorm:"default:0"`
+				MaxAdvance    int `gorm:"default:0"`
+				SameDayCutoff int `gorm:"default:0"`
+			}
+			for _, field := range []string{"MinNotice", "MaxAdvance", "SameDayCutoff"} {
+				if err := tx.Migrator().AddColumn(&Doctor{}, field); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			type Doctor struct {
+				MinNotice     int
+				MaxAdvance    int
+				SameDayCutoff int
+			}
+			for _, field := range []string{"MinNotice", "MaxAdvance", "SameDayCutoff"} {
+				if err := tx.Migrator().DropColumn(&Doctor{}, field); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version: 4,
+		Name:    "clinic closures",
+		Up: func(tx *gorm.DB) error {
+			type Closure struct {
+				ID        int
+				StartDate int64 `gorm:"index"`
+				EndDate   int64
+				Location  string
+				Category  string
+				Reason    string
+			}
+			return tx.Migrator().CreateTable(&Closure{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable("closures")
+		},
+	},
+	{
+		Version: 5,
+		Name:    "time off of doctors",
+		Up: func(tx *gorm.DB) error {
+			type TimeOff struct {
+				ID        int
+				DoctorID  int `gorm:"index"`
+				StartDate int64
+				EndDate   int64
+				Reason    string
+			}
+			return tx.Migrator().CreateTable(&TimeOff{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable("time_offs")
+		},
+	},
+	{
+		Version: 6,
+		Name:    "service types",
+		Up: func(tx *gorm.DB) error {
+			type ServiceType struct {
+				ID       int
+				DoctorID int `gorm:"index"`
+				Name     string
+				Duration int
+				Buffer   int
+				Price    string
+			}
+			type OccupiedSlot struct {
+				ServiceID int `gorm:"default:0"`
+				Duration  int `gorm:"default:0"`
+				Buffer    int `gorm:"default:0"`
+			}
+			if err := tx.Migrator().CreateTable(&ServiceType{}); err != nil {
+				return err
+			}
+			for _, field := range []string{"ServiceID", "Duration", "Buffer"} {
+				if err := tx.Migrator().AddColumn(&OccupiedSlot{}, field); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			type OccupiedSlot struct {
+				ServiceID int
+				Duration  int
+				Buffer    int
+			}
+			for _, field := range []string{"ServiceID", "Duration", "Buffer"} {
+				if err := tx.Migrator().DropColumn(&OccupiedSlot{}, field); err != nil {
+					return err
+				}
+			}
+			return tx.Migrator().DropTable("service_types")
+		},
+	},
+	{
+		Version: 7,
+		Name:    "capacity of group sessions",
+		Up: func(tx *gorm.DB) error {
+			type ServiceType struct {
+				Capacity int `gorm:"default:0"`
+			}
+			type OccupiedSlot struct {
+				Seat     int `gorm:"default:0"`
+				Capacity int `gorm:"default:0"`
+			}
+			if err := tx.Migrator().AddColumn(&ServiceType{}, "Capacity"); err != nil {
+				return err
+			}
+			for _, field := range []string{"Seat", "Capacity"} {
+				if err := tx.Migrator().AddColumn(&OccupiedSlot{}, field); err != nil {
+					return err
+				}
+			}
+			// reservations of the group session share its start
+			if err := tx.Migrator().DropIndex("occupied_slots", "idx_doctor_date"); err != nil {
+				return err
+			}
+			return tx.Exec("CREATE UNIQUE INDEX idx_doctor_date_seat ON occupied_slots (doctor_id, date, seat)").Error
+		},
+		Down: func(tx *gorm.DB) error {
+			type ServiceType struct {
+				Capacity int
+			}
+			type OccupiedSlot struct {
+				Seat     int
+				Capacity int
+			}
+			if err := tx.Migrator().DropIndex("occupied_slots", "idx_doctor_date_seat"); err != nil {
+				return err
+			}
+			// the previous schema keeps only one reservation of the slot
+			if err := tx.Exec("DELETE FROM occupied_slots WHERE seat > 0").Error; err != nil {
+				return err
+			}
+			if err := tx.Exec("CREATE UNIQUE INDEX idx_doctor_date ON occupied_slots (doctor_id, date)").Error; err != nil {
+				return err
+			}
+			for _, field := range []string{"Seat", "Capacity"} {
+				if err := tx.Migrator().DropColumn(&OccupiedSlot{}, field); err != nil {
+					return err
+				}
+			}
+			return tx.Migrator().DropColumn(&ServiceType{}, "Capacity")
+		},
+	},
+	{
+		Version: 8,
+		Name:    "waitlist",
+		Up: func(tx *gorm.DB) error {
+			type WaitlistEntry struct {
+				ID            int
+				DoctorID      int `gorm:"index"`
+				ServiceID     int
+				StartDate     int64
+				EndDate       int64
+				ClientName    string
+				ClientEmail   string
+				ClientDetails string
+				Status        string
+				CreatedAt     int64
+				OfferToken    string `gorm:"index;size:64"`
+				OfferDate     int64
+				OfferUntil    int64
+				ReservationID int
+			}
+			return tx.Migrator().CreateTable(&WaitlistEntry{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable("waitlist_entries")
+		},
+	},
+	{
+		Version: 9,
+		Name:    "outbox of notifications",
+		Up: func(tx *gorm.DB) error {
+			type OutboxMessage struct {
+				ID          int
+				Event       string
+				Recipient   string
+				Payload     string
+				Status      string `gorm:"index:idx_outbox_due"`
+				Attempts    int
+				NextAttempt int64 `gorm:"index:idx_outbox_due"`
+				LastError   string
+				CreatedAt   int64
+				SentAt      int64
+			}
+			return tx.Migrator().CreateTable(&OutboxMessage{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable("outbox_messages")
+		},
+	},
+	{
+		Version: 10,
+		Name:    "reminders and leases of jobs",
+		Up: func(tx *gorm.DB) error {
+			type Reminder struct {
+				ID            int
+				ReservationID int   `gorm:"uniqueIndex:idx_reminder"`
+				Date          int64 `gorm:"uniqueIndex:idx_reminder"`
+				MinutesBefore int   `gorm:"uniqueIndex:idx_reminder"`
+				CreatedAt     int64
+			}
+			type Lease struct {
+				Name    string `gorm:"primaryKey;size:64"`
+				Owner   string `gorm:"size:128"`
+				Expires int64
+			}
+			return tx.Migrator().CreateTable(&Reminder{}, &Lease{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable("reminders", "leases")
+		},
+	},
+	{
+		Version: 11,
+		Name:    "claims of outbox messages",
+		Up: func(tx *gorm.DB) error {
+			type OutboxMessage struct {
+				LockedUntil int64 `gorm:"default:0"`
+			}
+			return tx.Migrator().AddColumn(&OutboxMessage{}, "LockedUntil")
+		},
+		Down: func(tx *gorm.DB) error {
+			type OutboxMessage struct {
+				LockedUntil int64
+			}
+			return tx.Migrator().DropColumn(&OutboxMessage{}, "LockedUntil")
+		},
+	},
+	{
+		Version: 12,
+		Name:    "totals of legacy reviews",
+		Up: func(tx *gorm.DB) error {
+			// aggregates moved aside by the first migration keep their shape
+			if tx.Migrator().HasTable("legacy_reviews") {
+				return tx.Migrator().RenameTable("legacy_reviews", "review_totals")
+			}
+
+			type ReviewTotal struct {
+				ID       int
+				DoctorID int `gorm:"index"`
+				Count    int
+				Stars    int
+			}
+			return tx.Migrator().CreateTable(&ReviewTotal{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().RenameTable("review_totals", "legacy_reviews")
+		},
+	},
+	{
+		Version: 13,
+		Name:    "locations of doctors",
+		Up: func(tx *gorm.DB) error {
+			type Doctor struct {
+				Site string `gorm:"default:''"`
+			}
+			if err := tx.Migrator().AddColumn(&Doctor{}, "Site"); err != nil {
+				return err
+			}
+			// closures were matched on time zones before, so they keep applying to the same doctors
+			return tx.Exec("UPDATE doctors SET site = time_zone").Error
+		},
+		Down: func(tx *gorm.DB) error {
+			type Doctor struct {
+				Site string
+			}
+			return tx.Migrator().DropColumn(&Doctor{}, "Site")
+		},
+	},
+	{
+		Version: 14,
+		Name:    "reservations of reminders",
+		Up: func(tx *gorm.DB) error {
+			type OutboxMessage struct {
+				ReservationID int `gorm:"default:0;index"`
+			}
+			if err := tx.Migrator().AddColumn(&OutboxMessage{}, "ReservationID"); err != nil {
+				return err
+			}
+			return tx.Migrator().CreateIndex(&OutboxMessage{}, "ReservationID")
+		},
+		Down: func(tx *gorm.DB) error {
+			type OutboxMessage struct {
+				ReservationID int `gorm:"index"`
+			}
+			if err := tx.Migrator().DropIndex(&OutboxMessage{}, "ReservationID"); err != nil {
+				return err
+			}
+			return tx.Migrator().DropColumn(&OutboxMessage{}, "ReservationID")
+		},
+	},
+}
+
+// prepares tables of databases created before migrations:
+// their reviews are aggregates of doctors, so the table is moved to legacy_reviews and reviews of patients
+// get their own table; their reservations may share slots, so only the first reservation of the slot is kept
+// and others are logged as cancelled before the unique index is created
+func upgradeLegacyTables(tx *gorm.DB) error {
+	if tx.Migrator().HasTable("reviews") && tx.Migrator().HasColumn("reviews", "count") {
+		if err := tx.Migrator().RenameTable("reviews", "legacy_reviews"); err != nil {
+			return err
+		}
+	}
+
+	if !tx.Migrator().HasTable("occupied_slots") || tx.Migrator().HasIndex("occupied_slots", "idx_doctor_date") {
+		return nil
+	}
+	const duplicates = "id NOT IN (SELECT id FROM (SELECT MIN(id) AS id FROM occupied_slots GROUP BY doctor_id, date) AS kept)"
+	err := tx.Exec("INSERT INTO reservation_logs (reservation_id, action, actor, doctor_id, date, new_doctor_id, new_date, created_at) "+
+		"SELECT id, ?, ?, doctor_id, date, 0, 0, ? FROM occupied_slots WHERE "+duplicates,
+		"cancelled", "migration", time.Now().UnixMilli()).Error
+	if err != nil {
+		return err
+	}
+	return tx.Exec("DELETE FROM occupied_slots WHERE " + duplicates).Error
+}
+
+type Migrator struct {
+	db *gorm.DB
+}
+
+// connects to the database without changes of the schema
+func NewMigrator(config DBConfig) (*Migrator, error) {
+	db, err := connect(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return newMigrator(db)
+}
+
+func newMigrator(db *gorm.DB) (*Migrator, error) {
+	if err := db.AutoMigrate(&SchemaMigration{}); err != nil {
+		return nil, err
+	}
+
+	return &Migrator{db: db}, nil
+}
+
+// applies migrations up to the version, 0 applies all migrations;
+// each migration runs in a transaction, but MySQL commits DDL implicitly
+func (m *Migrator) Up(version int) ([]int, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	done := make([]int, 0)
+	for _, mg := range migrations {
+		if version != 0 && mg.Version > version {
+			break
+		}
+		if _, ok := applied[mg.Version]; ok {
+			continue
+		}
+
+		err := m.db.Transaction(func(tx *gorm.DB) error {
+			if err := mg.Up(tx); err != nil {
+				return err
+			}
+			return tx.Create(&SchemaMigration{Version: mg.Version, Name: mg.Name, AppliedAt: time.Now().UnixMilli()}).Error
+		})
+		if err != nil {
+			return done, fmt.Errorf("migration %d (%s): %w", mg.Version, mg.Name, err)
+		}
+		done = append(done, mg.Version)
+	}
+
+	return done, nil
+}
+
+// reverts the number of last applied migrations
+func (m *Migrator) Down(steps int) ([]int, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	done := make([]int, 0)
+	for i := len(migrations) - 1; i >= 0 && len(done) < steps; i-- {
+		mg := migrations[i]
+		if _, ok := applied[mg.Version]; !ok {
+			continue
+		}
+
+		err := m.db.Transaction(func(tx *gorm.DB) error {
+			if err := mg.Down(tx); err != nil {
+				return err
+			}
+			return tx.Delete(&SchemaMigration{}, mg.Version).Error
+		})
+		if err != nil {
+			return done, fmt.Errorf("migration %d (%s): %w", mg.Version, mg.Name, err)
+		}
+		done = append(done, mg.Version)
+	}
+
+	return done, nil
+}
+
+// returns states of all known migrations
+func (m *Migrator) Status() ([]MigrationStatus, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	status := make([]MigrationStatus, len(migrations))
+	for i, mg := range migrations {
+		rec, ok := applied[mg.Version]
+		status[i] = MigrationStatus{Version: mg.Version, Name: mg.Name, Applied: ok, AppliedAt: rec.AppliedAt}
+	}
+
+	return status, nil
+}
+
+// returns versions of migrations which are not applied yet
+func (m *Migrator) Pending() ([]int, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	pending := make([]int, 0)
+	for _, mg := range migrations {
+		if _, ok := applied[mg.Version]; !ok {
+			pending = append(pending, mg.Version)
+		}
+	}
+
+	return pending, nil
+}
+
+func (m *Migrator) applied() (map[int]SchemaMigration, error) {
+	records := make([]SchemaMigration, 0)
+	if err := m.db.Find(&records).Error; err != nil {
+		return nil, err
+	}
+
+	applied := make(map[int]SchemaMigration, len(records))
+	for _, rec := range records {
+		applied[rec.Version] = rec
+	}
+
+	return applied, nil
+}
+
+// versions must be ascending
+func init() {
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].Version <= migrations[i-1].Version {
+			panic(fmt.Sprintf("migration %d must follow %d", migrations[i].Version, migrations[i-1].Version))
+		}
+	}
+}
@@ -1,5 +1,12 @@
 package data
 
+import (
+	"log"
+	"time"
+)
+
+// the schema is created by migrations, changes of models need a new migration (see migrations.go)
+
 type Doctor struct {
 	ID       int    `json:"id"`
 	Name     string `json:"name"`
@@ -9,26 +16,65 @@ type Doctor struct {
 	Price    string `json:"price"`
 	Gap      int    `json:"gap"`
 	SlotSize int    `json:"slot_size"`
+	TimeZone string `json:"timezone" gorm:"default:UTC"` // IANA name, schedules are set in wall clock of this zone
+	Site     string `json:"location"`                    // clinic location, closures of the location apply to the doctor
 	ImageURL string `json:"-"`
 
+	// booking policy, 0 means no limit
+	MinNotice     int `json:"min_notice" gorm:"default:0"`      // in minutes before the start of the slot
+	MaxAdvance    int `json:"max_advance" gorm:"default:0"`     // in days from now
+	SameDayCutoff int `json:"same_day_cutoff" gorm:"default:0"` // in minutes of the day, same-day bookings are closed after it
+
 	DoctorSchedule []DoctorSchedule `json:"-"`
 	OccupiedSlots  []OccupiedSlot   `json:"-"`
-	Review         Review           `json:"-" gorm:"foreignkey:DoctorID"`
 }
 
+// returns the doctor's time zone
+func (d Doctor) Location() *time.Location {
+	loc, err := LoadLocation(d.TimeZone)
+	if err != nil {
+		log.Printf("WARN: invalid time zone %q of doctor %d: %v", d.TimeZone, d.ID, err)
+		return time.UTC
+	}
+
+	return loc
+}
+
+// patient's review of the completed appointment
 type Review struct {
-	ID       int `json:"-"`
-	Count    int `json:"count"`
-	Stars    int `json:"stars"`
-	DoctorID int `json:"-"`
+	ID            int    `json:"id"`
+	DoctorID      int    `json:"doctor_id" gorm:"index"`
+	ReservationID int    `json:"reservation_id" gorm:"uniqueIndex"` // one review per appointment
+	Stars         int    `json:"stars"`                             // from 1 to 5
+	Comment       string `json:"comment"`
+	ClientName    string `json:"client_name"`
+	CreatedAt     int64  `json:"created_at"`
 }
 
+// aggregated reviews of the doctor from the database created before reviews of patients,
+// they are counted as Count reviews with Stars
+type ReviewTotal struct {
+	ID       int
+	DoctorID int `gorm:"index"`
+	Count    int
+	Stars    int // rounded average
+}
+
+// aggregated reviews of the doctor
+type ReviewSummary struct {
+	Count        int     `json:"count"`
+	Stars        int     `json:"stars"` // rounded average
+	Average      float64 `json:"average"`
+	Distribution [5]int  `json:"distribution"` // number of reviews with 1, 2, 3, 4 and 5 stars
+}
+
+// schedule is set in the wall clock of the doctor's time zone
 type DoctorSchedule struct {
 	ID               int
 	DoctorID         int
-	From             int
-	To               int
-	Date             int64
+	From             int   // in minutes
+	To               int   // in minutes
+	Date             int64 // date only, wall clock encoded in UTC
 	Rrule            string
 	RecurringEventID string
 	OriginalStart    string
@@ -38,9 +84,186 @@ type DoctorSchedule struct {
 
 type OccupiedSlot struct {
 	ID            int    `json:"id"`
-	DoctorID      int    `json:"doctor_id"`
-	Date          int64  `json:"date"`
+	DoctorID      int    `json:"doctor_id" gorm:"uniqueIndex:idx_doctor_date_seat"`
+	Date          int64  `json:"date" gorm:"uniqueIndex:idx_doctor_date_seat"` // moment of the reservation (UTC)
+	ClientName    string `json:"client_name"`
+	ClientEmail   string `json:"client_email"`
+	ClientDetails string `json:"client_details"`
+
+	// booked service of the doctor, 0 durations mean one slot of the doctor
+	ServiceID int `json:"service_id,omitempty"`
+	Duration  int `json:"duration,omitempty"` // in minutes
+	Buffer    int `json:"buffer,omitempty"`   // in minutes after the appointment
+
+	// reservations of the group session share its start, each of them takes a seat
+	Seat     int `json:"seat,omitempty" gorm:"uniqueIndex:idx_doctor_date_seat"`
+	Capacity int `json:"capacity,omitempty"` // seats of the session, 0 means the only one
+
+	// temporary hold of the slot until the reservation is confirmed
+	HoldToken string `json:"-" gorm:"index;size:64"`
+	HoldUntil int64  `json:"-"` // 0 for confirmed reservations
+}
+
+// closure of the clinic, e.g. a public holiday, it is set in the wall clock of each doctor's time zone
+type Closure struct {
+	ID        int    `json:"id"`
+	StartDate int64  `json:"start_date" gorm:"index"` // wall clock encoded in UTC
+	EndDate   int64  `json:"end_date"`                // wall clock encoded in UTC
+	Location  string `json:"location"`                // (optional) clinic location of doctors, all doctors by default
+	Category  string `json:"category"`                // (optional) category of doctors, all doctors by default
+	Reason    string `json:"reason"`
+}
+
+// time off of the doctor, e.g. a vacation, it overrides the doctor's work time
+type TimeOff struct {
+	ID        int    `json:"id"`
+	DoctorID  int    `json:"doctor_id" gorm:"index"`
+	StartDate int64  `json:"start_date"` // wall clock of the doctor's time zone encoded in UTC
+	EndDate   int64  `json:"end_date"`   // wall clock of the doctor's time zone encoded in UTC
+	Reason    string `json:"reason"`
+}
+
+// returns whether the records occupy the same time of the doctor,
+// records without the duration occupy only their start
+func (s OccupiedSlot) overlaps(other OccupiedSlot) bool {
+	if s.DoctorID != other.DoctorID {
+		return false
+	}
+
+	return s.Date == other.Date || (s.Date < other.end() && other.Date < s.end())
+}
+
+func (s OccupiedSlot) end() int64 {
+	return s.Date + int64(s.Duration+s.Buffer)*60*1000
+}
+
+// returns the number of seats of the record's session
+func (s OccupiedSlot) Seats() int {
+	if s.Capacity > 1 {
+		return s.Capacity
+	}
+	return 1
+}
+
+// returns the free seat of the record's session among active records overlapping it,
+// false is returned if their time is used by another session or the session is full
+func freeSeat(record OccupiedSlot, overlapping []OccupiedSlot) (int, bool) {
+	capacity := record.Seats()
+	used := make(map[int]bool, len(overlapping))
+	for _, slot := range overlapping {
+		if slot.Date != record.Date || slot.ServiceID != record.ServiceID {
+			return 0, false
+		}
+		if c := slot.Seats(); c < capacity {
+			capacity = c
+		}
+		used[slot.Seat] = true
+	}
+	if len(overlapping) >= capacity {
+		return 0, false
+	}
+
+	seat := 0
+	for used[seat] {
+		seat++
+	}
+	return seat, true
+}
+
+// appointment type of the doctor, e.g. a 20-minute follow-up or a 60-minute intake
+type ServiceType struct {
+	ID       int    `json:"id"`
+	DoctorID int    `json:"doctor_id" gorm:"index"`
+	Name     string `json:"name"`
+	Duration int    `json:"duration"` // in minutes
+	Buffer   int    `json:"buffer"`   // in minutes after the appointment, it can't be booked
+	Price    string `json:"price"`
+	Capacity int    `json:"capacity"` // patients of the group session, 1 for individual appointments
+}
+
+// statuses of waitlist entries
+const (
+	WaitlistWaiting = "waiting"
+	WaitlistOffered = "offered" // the freed slot is held for the patient
+	WaitlistClaimed = "claimed"
+	WaitlistExpired = "expired" // the offer wasn't claimed in time or the requested time has passed
+)
+
+// patient waiting for a free slot of the doctor in the interval or for the specific slot
+type WaitlistEntry struct {
+	ID            int    `json:"id"`
+	DoctorID      int    `json:"doctor_id" gorm:"index"`
+	ServiceID     int    `json:"service_id,omitempty"`
+	StartDate     int64  `json:"start_date"` // wall clock of the doctor's time zone encoded in UTC
+	EndDate       int64  `json:"end_date"`   // equals the start for the specific slot
 	ClientName    string `json:"client_name"`
 	ClientEmail   string `json:"client_email"`
 	ClientDetails string `json:"client_details"`
+	Status        string `json:"status"`
+	CreatedAt     int64  `json:"created_at"`
+
+	// the freed slot is held for the patient until the offer expires
+	OfferToken    string `json:"-" gorm:"index;size:64"`
+	OfferDate     int64  `json:"offer_date,omitempty"`  // wall clock of the doctor's time zone encoded in UTC
+	OfferUntil    int64  `json:"offer_until,omitempty"` // moment of the expiration (UTC)
+	ReservationID int    `json:"reservation_id,omitempty"`
 }
+
+// statuses of outbox messages
+const (
+	OutboxPending = "pending"
+	OutboxSending = "sending" // claimed by the replica until LockedUntil
+	OutboxSent    = "sent"
+	OutboxFailed  = "failed" // attempts are over
+)
+
+// notification of the event which waits to be sent, it survives restarts of the server
+type OutboxMessage struct {
+	ID          int    `json:"id"`
+	Event       string `json:"event"` // e.g. "booked", "cancelled" or "rescheduled"
+	Recipient   string `json:"recipient"`
+	Payload     string `json:"payload"` // JSON data of templates of the event
+	Status      string `json:"status" gorm:"index:idx_outbox_due"`
+	Attempts    int    `json:"attempts"`
+	NextAttempt int64  `json:"next_attempt" gorm:"index:idx_outbox_due"` // moment of the next attempt (UTC)
+	LastError   string `json:"last_error"`
+	CreatedAt   int64  `json:"created_at"`
+	SentAt      int64  `json:"sent_at"`
+	LockedUntil int64  `json:"locked_until"` // end of the claim of the sending message
+
+	ReservationID int `json:"reservation_id,omitempty" gorm:"index"` // reservation of the reminder, pending reminders are dropped with its changes
+}
+
+// reminder of the reservation, the record prevents duplicates after restarts and in other replicas
+type Reminder struct {
+	ID            int   `json:"id"`
+	ReservationID int   `json:"reservation_id" gorm:"uniqueIndex:idx_reminder"`
+	Date          int64 `json:"date" gorm:"uniqueIndex:idx_reminder"`           // moment of the reservation (UTC), the rescheduled one gets new reminders
+	MinutesBefore int   `json:"minutes_before" gorm:"uniqueIndex:idx_reminder"` // the reminder is sent in minutes before the reservation
+	CreatedAt     int64 `json:"created_at"`
+}
+
+// lease of the background job, only its owner runs the job until it expires
+type Lease struct {
+	Name    string `json:"name" gorm:"primaryKey;size:64"`
+	Owner   string `json:"owner" gorm:"size:128"`
+	Expires int64  `json:"expires"` // moment of the expiration (UTC)
+}
+
+// history of reservation changes
+type ReservationLog struct {
+	ID            int    `json:"id"`
+	ReservationID int    `json:"reservation_id" gorm:"index"`
+	Action        string `json:"action"` // "cancelled" or "rescheduled"
+	Actor         string `json:"actor"`
+	DoctorID      int    `json:"doctor_id"`
+	Date          int64  `json:"date"`
+	NewDoctorID   int    `json:"new_doctor_id,omitempty"`
+	NewDate       int64  `json:"new_date,omitempty"`
+	CreatedAt     int64  `json:"created_at"`
+}
+
+const (
+	ActionCancelled   = "cancelled"
+	ActionRescheduled = "rescheduled"
+)
@@ -1,15 +1,24 @@
 package data
 
 import (
+	"errors"
+
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+var ErrHoldNotFound = errors.New("hold has expired or doesn't exist")
+
+// active holds are considered as used slots
+const activeSlots = "(hold_until = 0 OR hold_until >= ?)"
+
 type occupiedSlotsDAO struct {
-	db *gorm.DB
+	db    *gorm.DB
+	clock Clock
 }
 
-func newOccupiedSlotsDAO(db *gorm.DB) *occupiedSlotsDAO {
-	return &occupiedSlotsDAO{db}
+func newOccupiedSlotsDAO(db *gorm.DB, clock Clock) *occupiedSlotsDAO {
+	return &occupiedSlotsDAO{db, clock}
 }
 
 func (d *occupiedSlotsDAO) GetOne(id int) (OccupiedSlot, error) {
@@ -18,28 +27,266 @@ func (d *occupiedSlotsDAO) GetOne(id int) (OccupiedSlot, error) {
 	return slot, err
 }
 
+// returns confirmed reservations
 func (d *occupiedSlotsDAO) GetAll() ([]OccupiedSlot, error) {
 	slots := make([]OccupiedSlot, 0)
-	err := d.db.Find(&slots).Error
+	err := d.db.Find(&slots, "hold_until = 0").Error
 	return slots, err
 }
 
-func (d *occupiedSlotsDAO) GetUsedSlot(doctorId int, date int64) (OccupiedSlot, error) {
-	slots := OccupiedSlot{}
+func (d *occupiedSlotsDAO) GetUpcoming(from, to int64) ([]OccupiedSlot, error) {
+	slots := make([]OccupiedSlot, 0)
 	err := d.db.
-		Limit(1).
-		Find(&slots, " doctor_id = ? AND date = ?", doctorId, date).Error
+		Order("date, id").
+		Find(&slots, "date > ? AND date <= ? AND hold_until = 0", from, to).Error
 	return slots, err
 }
 
-func (d *occupiedSlotsDAO) Add(doctor int, date int64, name, email, details string) (int, error) {
-	record := OccupiedSlot{
-		DoctorID:      doctor,
-		Date:          date,
-		ClientName:    name,
-		ClientEmail:   email,
-		ClientDetails: details,
-	}
-	err := d.db.Save(&record).Error
+// returns confirmed reservations of the doctor which overlap the [from, to) interval ordered by dates,
+// reservations without durations take the slot of the doctor
+func (d *occupiedSlotsDAO) GetOverlapping(doctorID int, from, to int64) ([]OccupiedSlot, error) {
+	slots := make([]OccupiedSlot, 0)
+	err := d.db.
+		Where("doctor_id = ? AND hold_until = 0 AND date < ?", doctorID, to).
+		Where("date + (CASE WHEN duration > 0 THEN duration + buffer ELSE (SELECT slot_size FROM doctors WHERE id = ?) END) * 60000 > ?", doctorID, from).
+		Order("date, id").
+		Find(&slots).Error
+	return slots, err
+}
+
+// returns reservations and active holds starting at the date
+func (d *occupiedSlotsDAO) GetUsedSlots(doctorId int, date int64) ([]OccupiedSlot, error) {
+	slots := make([]OccupiedSlot, 0)
+	err := d.db.
+		Order("id").
+		Find(&slots, "doctor_id = ? AND date = ? AND "+activeSlots, doctorId, date, d.clock.Now().UnixMilli()).Error
+	return slots, err
+}
+
+// adds the reservation or the hold (if HoldUntil is set) of the service and queues the message (if it is set),
+// ErrSlotTaken is returned if its time overlaps another session of the doctor or its session is full
+func (d *occupiedSlotsDAO) Create(record *OccupiedSlot, msg *OutboxMessage) (int, error) {
+	err := d.create(record, msg)
 	return record.ID, err
 }
+
+func (d *occupiedSlotsDAO) create(record *OccupiedSlot, msg *OutboxMessage) error {
+	err := d.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockDoctor(tx, record.DoctorID); err != nil {
+			return err
+		}
+
+		// expired hold doesn't block the slot
+		err := tx.
+			Where("doctor_id = ? AND date = ? AND hold_until > 0 AND hold_until < ?", record.DoctorID, record.Date, d.clock.Now().UnixMilli()).
+			Delete(&OccupiedSlot{}).Error
+		if err != nil {
+			return err
+		}
+
+		seat, err := d.freeSeat(tx, *record, 0)
+		if err != nil {
+			return err
+		}
+
+		record.Seat = seat
+		if err := tx.Create(record).Error; err != nil {
+			return err
+		}
+
+		return enqueue(tx, msg)
+	})
+	if isUniqueViolation(err) {
+		err = ErrSlotTaken
+	}
+
+	return err
+}
+
+// locks the doctor till the end of the transaction, so overlapping reservations of the doctor are checked
+// one by one, the unique index catches only reservations with the same start;
+// sqlite ignores the lock, its transactions are serialized by _txlock=immediate
+func lockDoctor(tx *gorm.DB, id int) error {
+	return tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").Find(&Doctor{}, id).Error
+}
+
+// returns the free seat of the record's session, ErrSlotTaken is returned if there is no such seat,
+// records with durations occupy the time till their end
+func (d *occupiedSlotsDAO) freeSeat(tx *gorm.DB, record OccupiedSlot, except int) (int, error) {
+	overlapping := make([]OccupiedSlot, 0)
+	err := tx.
+		Where("doctor_id = ? AND id <> ? AND "+activeSlots, record.DoctorID, except, d.clock.Now().UnixMilli()).
+		Where("date = ? OR (date < ? AND date + (duration + buffer) * 60000 > ?)", record.Date, record.end(), record.Date).
+		Find(&overlapping).Error
+	if err != nil {
+		return 0, err
+	}
+
+	seat, ok := freeSeat(record, overlapping)
+	if !ok {
+		return 0, ErrSlotTaken
+	}
+
+	return seat, nil
+}
+
+// returns the active hold
+func (d *occupiedSlotsDAO) GetHold(token string) (OccupiedSlot, error) {
+	slot := OccupiedSlot{}
+	err := d.db.
+		Limit(1).
+		Find(&slot, "hold_token = ? AND hold_until >= ?", token, d.clock.Now().UnixMilli()).Error
+	if err == nil && slot.ID == 0 {
+		err = ErrHoldNotFound
+	}
+
+	return slot, err
+}
+
+// turns the active hold into the reservation and queues the message (if it is set)
+func (d *occupiedSlotsDAO) ConfirmHold(token, name, email, details string, msg *OutboxMessage) (int, error) {
+	slot := OccupiedSlot{}
+	err := d.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.
+			Limit(1).
+			Find(&slot, "hold_token = ? AND hold_until >= ?", token, d.clock.Now().UnixMilli()).Error
+		if err != nil {
+			return err
+		}
+		if slot.ID == 0 {
+			return ErrHoldNotFound
+		}
+
+		err = tx.Model(&OccupiedSlot{}).
+			Where("id = ?", slot.ID).
+			Updates(map[string]interface{}{
+				"client_name":    name,
+				"client_email":   email,
+				"client_details": details,
+				"hold_token":     "",
+				"hold_until":     0,
+			}).Error
+		if err != nil {
+			return err
+		}
+
+		return enqueue(tx, msg)
+	})
+
+	return slot.ID, err
+}
+
+// releases the hold before its expiration
+func (d *occupiedSlotsDAO) DeleteHold(token string) error {
+	return d.db.Delete(&OccupiedSlot{}, "hold_token = ? AND hold_until > 0", token).Error
+}
+
+// deletes expired holds and returns their number
+func (d *occupiedSlotsDAO) DeleteExpiredHolds() (int64, error) {
+	res := d.db.Delete(&OccupiedSlot{}, "hold_until > 0 AND hold_until < ?", d.clock.Now().UnixMilli())
+	return res.RowsAffected, res.Error
+}
+
+// deletes the reservation, records the change and queues the message (if it is set)
+func (d *occupiedSlotsDAO) Delete(id int, actor string, msg *OutboxMessage) error {
+	return d.db.Transaction(func(tx *gorm.DB) error {
+		slot := OccupiedSlot{}
+		err := tx.Find(&slot, id).Error
+		if err != nil {
+			return err
+		}
+
+		err = tx.Delete(&OccupiedSlot{}, id).Error
+		if err != nil {
+			return err
+		}
+		if err := dropReminders(tx, []int{id}); err != nil {
+			return err
+		}
+
+		err = tx.Create(&ReservationLog{
+			ReservationID: id,
+			Action:        ActionCancelled,
+			Actor:         actor,
+			DoctorID:      slot.DoctorID,
+			Date:          slot.Date,
+			CreatedAt:     d.clock.Now().UnixMilli(),
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		return enqueue(tx, msg)
+	})
+}
+
+// moves the reservation to another doctor or date, records the change and queues the message (if it is set)
+func (d *occupiedSlotsDAO) Move(id, doctor int, date int64, actor string, msg *OutboxMessage) error {
+	err := d.db.Transaction(func(tx *gorm.DB) error {
+		slot := OccupiedSlot{}
+		err := tx.Find(&slot, id).Error
+		if err != nil {
+			return err
+		}
+
+		if err := lockDoctor(tx, doctor); err != nil {
+			return err
+		}
+
+		// expired hold doesn't block the slot
+		err = tx.
+			Where("doctor_id = ? AND date = ? AND hold_until > 0 AND hold_until < ?", doctor, date, d.clock.Now().UnixMilli()).
+			Delete(&OccupiedSlot{}).Error
+		if err != nil {
+			return err
+		}
+
+		moved := slot
+		moved.DoctorID = doctor
+		moved.Date = date
+		seat, err := d.freeSeat(tx, moved, id)
+		if err != nil {
+			return err
+		}
+
+		err = tx.Model(&OccupiedSlot{}).
+			Where("id = ?", id).
+			Updates(map[string]interface{}{"doctor_id": doctor, "date": date, "seat": seat}).Error
+		if err != nil {
+			return err
+		}
+		if err := dropReminders(tx, []int{id}); err != nil {
+			return err
+		}
+
+		err = tx.Create(&ReservationLog{
+			ReservationID: id,
+			Action:        ActionRescheduled,
+			Actor:         actor,
+			DoctorID:      slot.DoctorID,
+			Date:          slot.Date,
+			NewDoctorID:   doctor,
+			NewDate:       date,
+			CreatedAt:     d.clock.Now().UnixMilli(),
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		return enqueue(tx, msg)
+	})
+	if isUniqueViolation(err) {
+		err = ErrSlotTaken
+	}
+
+	return err
+}
+
+func (d *occupiedSlotsDAO) GetLogs(id int) ([]ReservationLog, error) {
+	logs := make([]ReservationLog, 0)
+	err := d.db.
+		Where("reservation_id = ?", id).
+		Order("id").
+		Find(&logs).Error
+	return logs, err
+}
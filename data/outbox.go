@@ -0,0 +1,60 @@
+package data
+
+import (
+	"gorm.io/gorm"
+)
+
+// due pending messages and sending ones whose claims have expired (the replica stopped while sending them)
+const claimableMessages = "((status = ? AND next_attempt <= ?) OR (status = ? AND locked_until < ?))"
+
+type outboxDAO struct {
+	db *gorm.DB
+}
+
+func newOutboxDAO(db *gorm.DB) *outboxDAO {
+	return &outboxDAO{db}
+}
+
+// adds the message (if it is set) in the transaction of the change which it reports
+func enqueue(tx *gorm.DB, msg *OutboxMessage) error {
+	if msg == nil {
+		return nil
+	}
+
+	return tx.Create(msg).Error
+}
+
+// drops pending reminders in the transaction which cancels or moves their reservations (ids or a query of ids)
+func dropReminders(tx *gorm.DB, reservations interface{}) error {
+	return tx.Where("reservation_id IN (?) AND status = ?", reservations, OutboxPending).Delete(&OutboxMessage{}).Error
+}
+
+func (d *outboxDAO) Add(msg *OutboxMessage) (int, error) {
+	err := d.db.Create(msg).Error
+	return msg.ID, err
+}
+
+// returns pending messages which are due at the moment and sending ones whose claims have expired,
+// the oldest ones first
+func (d *outboxDAO) GetDue(now int64, limit int) ([]OutboxMessage, error) {
+	messages := make([]OutboxMessage, 0)
+	err := d.db.
+		Where(claimableMessages, OutboxPending, now, OutboxSending, now).
+		Order("id").
+		Limit(limit).
+		Find(&messages).Error
+	return messages, err
+}
+
+// the conditional update lets only one replica claim the message
+func (d *outboxDAO) Claim(id int, now, until int64) (bool, error) {
+	res := d.db.Model(&OutboxMessage{}).
+		Where("id = ?", id).
+		Where(claimableMessages, OutboxPending, now, OutboxSending, now).
+		Updates(map[string]interface{}{"status": OutboxSending, "locked_until": until})
+	return res.RowsAffected > 0, res.Error
+}
+
+func (d *outboxDAO) Update(msg OutboxMessage) error {
+	return d.db.Save(&msg).Error
+}
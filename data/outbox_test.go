@@ -0,0 +1,148 @@
+package data
+
+import (
+	"testing"
+	"time"
+)
+
+func testOutbox(t *testing.T, repo Repositories) {
+	messages := []OutboxMessage{
+		{Event: "booked", Recipient: "first@scheduler.booking", Status: OutboxPending, NextAttempt: 10},
+		{Event: "booked", Recipient: "later@scheduler.booking", Status: OutboxPending, NextAttempt: 30},
+		{Event: "cancelled", Recipient: "sent@scheduler.booking", Status: OutboxSent, NextAttempt: 10},
+		{Event: "cancelled", Recipient: "second@scheduler.booking", Status: OutboxPending, NextAttempt: 20},
+	}
+	for i := range messages {
+		if _, err := repo.Outbox.Add(&messages[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	due, err := repo.Outbox.GetDue(20, 10)
+	if err != nil || len(due) != 2 || due[0].ID != messages[0].ID || due[1].ID != messages[3].ID {
+		t.Fatalf("expected due messages in order, got %+v (%v)", due, err)
+	}
+	if due, err := repo.Outbox.GetDue(20, 1); err != nil || len(due) != 1 {
+		t.Fatalf("expected the limit of messages, got %+v (%v)", due, err)
+	}
+
+	sent := due[0]
+	sent.Status = OutboxSent
+	sent.Attempts = 1
+	if err := repo.Outbox.Update(sent); err != nil {
+		t.Fatal(err)
+	}
+	if due, err := repo.Outbox.GetDue(20, 10); err != nil || len(due) != 1 || due[0].ID != messages[3].ID {
+		t.Fatalf("expected the sent message to be skipped, got %+v (%v)", due, err)
+	}
+
+	// the claimed message is skipped until its claim expires
+	if ok, err := repo.Outbox.Claim(messages[3].ID, 20, 40); !ok || err != nil {
+		t.Fatalf("expected the claim, got %v (%v)", ok, err)
+	}
+	if ok, err := repo.Outbox.Claim(messages[3].ID, 20, 40); ok || err != nil {
+		t.Fatalf("expected the message claimed by another replica, got %v (%v)", ok, err)
+	}
+	if ok, err := repo.Outbox.Claim(messages[2].ID, 20, 40); ok || err != nil {
+		t.Fatalf("expected the sent message not to be claimed, got %v (%v)", ok, err)
+	}
+	if due, err := repo.Outbox.GetDue(20, 10); err != nil || len(due) != 0 {
+		t.Fatalf("expected the claimed message to be skipped, got %+v (%v)", due, err)
+	}
+	if due, err := repo.Outbox.GetDue(41, 10); err != nil || len(due) != 2 || due[1].ID != messages[3].ID {
+		t.Fatalf("expected the message of the expired claim, got %+v (%v)", due, err)
+	}
+	if ok, err := repo.Outbox.Claim(messages[3].ID, 41, 60); !ok || err != nil {
+		t.Fatalf("expected the expired claim to be taken over, got %v (%v)", ok, err)
+	}
+}
+
+func testReservationMessages(t *testing.T, repo Repositories) {
+	doctor := addDoctor(t, repo, 30)
+	message := func(event string) *OutboxMessage {
+		return &OutboxMessage{Event: event, Recipient: "client@scheduler.booking", Status: OutboxPending}
+	}
+	expect := func(events ...string) {
+		t.Helper()
+		due, err := repo.Outbox.GetDue(0, 10)
+		if err != nil || len(due) != len(events) {
+			t.Fatalf("expected messages %v, got %+v (%v)", events, due, err)
+		}
+		for i, event := range events {
+			if due[i].Event != event {
+				t.Fatalf("expected messages %v, got %+v", events, due)
+			}
+		}
+	}
+
+	first := OccupiedSlot{DoctorID: doctor.ID, Date: at(1, 9, 0), ClientEmail: "client@scheduler.booking"}
+	if _, err := repo.OccupiedSlots.Create(&first, message("booked")); err != nil {
+		t.Fatal(err)
+	}
+	taken := OccupiedSlot{DoctorID: doctor.ID, Date: at(1, 9, 0), ClientEmail: "client@scheduler.booking"}
+	if _, err := repo.OccupiedSlots.Create(&taken, message("booked")); err != ErrSlotTaken {
+		t.Fatalf("expected ErrSlotTaken, got %v", err)
+	}
+	expect("booked")
+
+	second := OccupiedSlot{DoctorID: doctor.ID, Date: at(1, 10, 0), ClientEmail: "client@scheduler.booking"}
+	if _, err := repo.OccupiedSlots.Create(&second, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.OccupiedSlots.Move(second.ID, doctor.ID, at(1, 9, 0), "admin", message("rescheduled")); err != ErrSlotTaken {
+		t.Fatalf("expected ErrSlotTaken, got %v", err)
+	}
+	expect("booked")
+
+	if err := repo.OccupiedSlots.Move(second.ID, doctor.ID, at(1, 11, 0), "admin", message("rescheduled")); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.OccupiedSlots.Delete(first.ID, "admin", message("cancelled")); err != nil {
+		t.Fatal(err)
+	}
+	expect("booked", "rescheduled", "cancelled")
+
+	if _, err := repo.OccupiedSlots.Create(&OccupiedSlot{DoctorID: doctor.ID, Date: at(1, 12, 0), HoldToken: "expired", HoldUntil: SystemClock.Now().Add(-time.Minute).UnixMilli()}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.OccupiedSlots.ConfirmHold("expired", "Client", "client@scheduler.booking", "", message("booked")); err != ErrHoldNotFound {
+		t.Fatalf("expected ErrHoldNotFound, got %v", err)
+	}
+	expect("booked", "rescheduled", "cancelled")
+}
+
+func testReminderMessages(t *testing.T, repo Repositories) {
+	doctor := addDoctor(t, repo, 30)
+	other := addDoctor(t, repo, 30)
+	reservations := make([]OccupiedSlot, 0)
+	for _, slot := range []OccupiedSlot{
+		{DoctorID: doctor.ID, Date: at(7, 9, 0)},
+		{DoctorID: doctor.ID, Date: at(7, 10, 0)},
+		{DoctorID: doctor.ID, Date: at(7, 11, 0)},
+		{DoctorID: other.ID, Date: at(7, 9, 0)},
+	} {
+		if _, err := repo.OccupiedSlots.Create(&slot, nil); err != nil {
+			t.Fatal(err)
+		}
+		reservations = append(reservations, slot)
+		msg := OutboxMessage{Event: "reminder", Recipient: "client@scheduler.booking", Status: OutboxPending, ReservationID: slot.ID}
+		if _, err := repo.Outbox.Add(&msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := repo.OccupiedSlots.Delete(reservations[0].ID, "admin", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.OccupiedSlots.Move(reservations[1].ID, doctor.ID, at(7, 12, 0), "admin", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Doctors.Delete(other.ID, true, "admin", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	due, err := repo.Outbox.GetDue(0, 10)
+	if err != nil || len(due) != 1 || due[0].ReservationID != reservations[2].ID {
+		t.Fatalf("expected the reminder of reservation %d, got %+v (%v)", reservations[2].ID, due, err)
+	}
+}
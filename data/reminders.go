@@ -0,0 +1,30 @@
+package data
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type remindersDAO struct {
+	db *gorm.DB
+}
+
+func newRemindersDAO(db *gorm.DB) *remindersDAO {
+	return &remindersDAO{db}
+}
+
+// the unique index of reminders lets only one replica record the reminder
+func (d *remindersDAO) Record(reminder *Reminder, msg *OutboxMessage) (bool, error) {
+	recorded := false
+	err := d.db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(reminder)
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+
+		recorded = true
+		return tx.Create(msg).Error
+	})
+
+	return recorded && err == nil, err
+}
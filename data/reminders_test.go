@@ -0,0 +1,55 @@
+package data
+
+import (
+	"testing"
+)
+
+func testReminders(t *testing.T, repo Repositories) {
+	doctor := addDoctor(t, repo, 30)
+
+	ids := make(map[int64]int)
+	for _, h := range []int{11, 9, 10, 12} {
+		id, err := repo.OccupiedSlots.Create(&OccupiedSlot{DoctorID: doctor.ID, Date: at(7, h, 0), ClientName: "Client", ClientEmail: "client@scheduler.booking"}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[at(7, h, 0)] = id
+	}
+	if _, err := repo.OccupiedSlots.Create(&OccupiedSlot{DoctorID: doctor.ID, Date: at(7, 13, 0), HoldToken: "hold", HoldUntil: at(7, 14, 0)}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// holds are not reservations
+	upcoming, err := repo.OccupiedSlots.GetUpcoming(at(7, 9, 0), at(7, 13, 0))
+	if err != nil || len(upcoming) != 3 || upcoming[0].ID != ids[at(7, 10, 0)] || upcoming[1].ID != ids[at(7, 11, 0)] || upcoming[2].ID != ids[at(7, 12, 0)] {
+		t.Fatalf("expected reservations in (9:00, 13:00] ordered by dates, got %+v (%v)", upcoming, err)
+	}
+
+	record := func(id int, date int64, before int) bool {
+		t.Helper()
+		ok, err := repo.Reminders.Record(
+			&Reminder{ReservationID: id, Date: date, MinutesBefore: before},
+			&OutboxMessage{Event: "reminder", Recipient: "client@scheduler.booking", Status: OutboxPending, NextAttempt: 10},
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ok
+	}
+
+	if !record(ids[at(7, 9, 0)], at(7, 9, 0), 60) || !record(ids[at(7, 9, 0)], at(7, 9, 0), 1440) {
+		t.Fatal("expected reminders to be recorded")
+	}
+	if record(ids[at(7, 9, 0)], at(7, 9, 0), 60) {
+		t.Fatal("expected the duplicate reminder to be skipped")
+	}
+	// the rescheduled reservation gets new reminders
+	if !record(ids[at(7, 9, 0)], at(7, 10, 0), 60) {
+		t.Fatal("expected the reminder of the new date to be recorded")
+	}
+
+	due, err := repo.Outbox.GetDue(10, 10)
+	if err != nil || len(due) != 3 {
+		t.Fatalf("expected messages of recorded reminders only, got %+v (%v)", due, err)
+	}
+}
@@ -0,0 +1,158 @@
+package data
+
+// storage of the booking engine, it is implemented by the DAO (SQL databases) and the memory storage
+type Repositories struct {
+	Clock Clock
+
+	Doctors         DoctorsRepository
+	DoctorsSchedule SchedulesRepository
+	OccupiedSlots   ReservationsRepository
+	Reviews         ReviewsRepository
+	Closures        ClosuresRepository
+	TimeOff         TimeOffRepository
+	Services        ServicesRepository
+	Waitlist        WaitlistRepository
+	Outbox          OutboxRepository
+	Reminders       RemindersRepository
+	Leases          LeasesRepository
+}
+
+// missing entities are returned as zero values without errors
+type DoctorsRepository interface {
+	GetOne(id int) (Doctor, error)
+	// returns the doctor with schedules and upcoming reservations related to the interval
+	GetOneWithSchedule(id int, window Window) (Doctor, error)
+	GetAll() ([]Doctor, error)
+	// returns doctors with schedules and upcoming reservations related to the interval
+	GetAllWithSchedule(window Window) ([]Doctor, error)
+	// adds the doctor with its schedules and reservations
+	Add(doctor *Doctor) (int, error)
+	Update(doctor Doctor) error
+	// deletes the doctor with schedules, time off, services, waitlist, reservations, their reminders and reviews,
+	// ErrDoctorHasReservations is returned if there are upcoming reservations and force is not set,
+	// otherwise their cancellations by the actor are logged and the messages are added to the outbox,
+	// logs of reservations are kept
+	Delete(id int, force bool, actor string, messages []OutboxMessage) error
+}
+
+type SchedulesRepository interface {
+	GetOne(id int) (DoctorSchedule, error)
+	// returns schedules which can have occurrences in the interval
+	GetAll(window Window) ([]DoctorSchedule, error)
+	Add(doctorID, from, to int, date int64, rrule string, duration int, original string, recID string, deleted bool) (int, error)
+	Update(id, doctorID, from, to int, date int64, rrule string, duration int, original string, recID string, deleted bool) error
+	// deletes the schedule with its exceptions
+	Delete(id int) error
+}
+
+// reservations and holds of slots, expired holds don't block slots
+type ReservationsRepository interface {
+	GetOne(id int) (OccupiedSlot, error)
+	// returns confirmed reservations
+	GetAll() ([]OccupiedSlot, error)
+	// returns confirmed reservations of the doctor which overlap the [from, to) interval ordered by dates,
+	// reservations without durations take the slot of the doctor
+	GetOverlapping(doctorID int, from, to int64) ([]OccupiedSlot, error)
+	// returns reservations and active holds starting at the date, several ones share the group session
+	GetUsedSlots(doctorID int, date int64) ([]OccupiedSlot, error)
+	// adds the reservation or the hold (if HoldUntil is set) of the service and queues the message (if it is set),
+	// ErrSlotTaken is returned if its time overlaps another session of the doctor or its session is full
+	Create(record *OccupiedSlot, msg *OutboxMessage) (int, error)
+	// returns the active hold, ErrHoldNotFound is returned if there is no such hold
+	GetHold(token string) (OccupiedSlot, error)
+	// turns the active hold into the reservation and queues the message (if it is set)
+	ConfirmHold(token, name, email, details string, msg *OutboxMessage) (int, error)
+	DeleteHold(token string) error
+	// deletes expired holds and returns their number
+	DeleteExpiredHolds() (int64, error)
+	// deletes the reservation, records the change and queues the message (if it is set)
+	Delete(id int, actor string, msg *OutboxMessage) error
+	// moves the reservation to another doctor or date, records the change and queues the message (if it is set)
+	Move(id, doctor int, date int64, actor string, msg *OutboxMessage) error
+	GetLogs(id int) ([]ReservationLog, error)
+	// returns confirmed reservations starting in the (from, to] interval ordered by dates
+	GetUpcoming(from, to int64) ([]OccupiedSlot, error)
+}
+
+type ReviewsRepository interface {
+	// returns reviews of the doctor, the newest first
+	GetAll(doctorID int) ([]Review, error)
+	// adds the review, ErrReviewExists is returned if the appointment already has a review
+	Add(review *Review) (int, error)
+	// returns review summaries by doctors
+	GetSummaries() (map[int]ReviewSummary, error)
+}
+
+type ClosuresRepository interface {
+	GetOne(id int) (Closure, error)
+	// returns closures which overlap the interval ordered by their start
+	GetAll(window Window) ([]Closure, error)
+	Add(closure *Closure) (int, error)
+	Update(closure Closure) error
+	Delete(id int) error
+}
+
+type TimeOffRepository interface {
+	GetOne(id int) (TimeOff, error)
+	// returns time off of all doctors which overlaps the interval ordered by its start
+	GetAll(window Window) ([]TimeOff, error)
+	Add(timeOff *TimeOff) (int, error)
+	Update(timeOff TimeOff) error
+	Delete(id int) error
+}
+
+type ServicesRepository interface {
+	GetOne(id int) (ServiceType, error)
+	// returns services of the doctor, 0 returns services of all doctors
+	GetAll(doctorID int) ([]ServiceType, error)
+	Add(service *ServiceType) (int, error)
+	Update(service ServiceType) error
+	Delete(id int) error
+}
+
+// patients waiting for freed slots, state changes are conditional as offers can expire concurrently
+type WaitlistRepository interface {
+	GetOne(id int) (WaitlistEntry, error)
+	// returns entries of the doctor in the order of registration, 0 returns entries of all doctors
+	GetAll(doctorID int) ([]WaitlistEntry, error)
+	// returns entries whose offers have expired before the moment in the order of registration
+	GetExpiredOffers(now int64) ([]WaitlistEntry, error)
+	// returns the entry which has got the offer with the token
+	GetByOffer(token string) (WaitlistEntry, error)
+	Add(entry *WaitlistEntry) (int, error)
+	// offers the held slot to the waiting patient, false is returned if the entry isn't waiting anymore
+	Offer(id int, token string, date, until int64) (bool, error)
+	// closes the offer with the status (claimed or expired), false is returned if the entry has no offer
+	Close(id int, status string, reservationID int) (bool, error)
+	// closes waiting entries of the doctor whose requested time has passed before the moment (wall clock),
+	// returns their number
+	ExpireWaiting(doctorID int, wall int64) (int64, error)
+	// closes the offer as claimed and turns its hold into the reservation of the patient,
+	// the message (if any) is added to the outbox, the id of the reservation is returned,
+	// ErrOfferClosed is returned if the entry has no offer, ErrHoldNotFound if the hold has expired
+	Claim(id int, msg *OutboxMessage) (int, error)
+	Delete(id int) error
+}
+
+// notifications which wait to be sent
+type OutboxRepository interface {
+	Add(msg *OutboxMessage) (int, error)
+	// returns pending messages which are due at the moment and sending ones whose claims have expired,
+	// the oldest ones first
+	GetDue(now int64, limit int) ([]OutboxMessage, error)
+	// claims the message for sending until the given time, false is returned
+	// if it is sent or claimed by another replica
+	Claim(id int, now, until int64) (bool, error)
+	Update(msg OutboxMessage) error
+}
+
+type RemindersRepository interface {
+	// records the reminder with its message in the outbox,
+	// false is returned if the reminder is already recorded
+	Record(reminder *Reminder, msg *OutboxMessage) (bool, error)
+}
+
+type LeasesRepository interface {
+	// takes or extends the lease until the moment, false is returned if another owner holds it at the current moment
+	Acquire(name, owner string, now, until int64) (bool, error)
+}
@@ -0,0 +1,183 @@
+package data
+
+import (
+	"sort"
+	"testing"
+	"time"
+)
+
+// runs the same checks against implementations of repositories, open returns empty repositories
+func testRepositories(t *testing.T, open func(t *testing.T) Repositories) {
+	t.Run("schedule window", func(t *testing.T) { testScheduleWindow(t, open(t)) })
+	t.Run("occupied slots", func(t *testing.T) { testOccupiedSlots(t, open(t)) })
+	t.Run("reviews", func(t *testing.T) { testReviews(t, open(t)) })
+	t.Run("closures", func(t *testing.T) { testClosures(t, open(t)) })
+	t.Run("time off", func(t *testing.T) { testTimeOff(t, open(t)) })
+	t.Run("services", func(t *testing.T) { testServices(t, open(t)) })
+	t.Run("group sessions", func(t *testing.T) { testGroupSessions(t, open(t)) })
+	t.Run("concurrent reservations", func(t *testing.T) { testConcurrentReservations(t, open(t)) })
+	t.Run("overlapping reservations", func(t *testing.T) { testOverlappingReservations(t, open(t)) })
+	t.Run("waitlist", func(t *testing.T) { testWaitlist(t, open(t)) })
+	t.Run("waitlist claim", func(t *testing.T) { testWaitlistClaim(t, open(t)) })
+	t.Run("waitlist expiration", func(t *testing.T) { testWaitlistExpiration(t, open(t)) })
+	t.Run("outbox", func(t *testing.T) { testOutbox(t, open(t)) })
+	t.Run("reservation messages", func(t *testing.T) { testReservationMessages(t, open(t)) })
+	t.Run("reminder messages", func(t *testing.T) { testReminderMessages(t, open(t)) })
+	t.Run("reminders", func(t *testing.T) { testReminders(t, open(t)) })
+	t.Run("leases", func(t *testing.T) { testLeases(t, open(t)) })
+	t.Run("doctor deletion", func(t *testing.T) { testDoctorDeletion(t, open(t)) })
+}
+
+func TestMemory(t *testing.T) {
+	testRepositories(t, func(t *testing.T) Repositories {
+		return NewMemory(SystemClock)
+	})
+}
+
+func testScheduleWindow(t *testing.T, repo Repositories) {
+	doctor := Doctor{Name: "Dr. Test", SlotSize: 30}
+	if _, err := repo.Doctors.Add(&doctor); err != nil {
+		t.Fatal(err)
+	}
+
+	day := func(n int) int64 {
+		return time.Date(2030, 1, 1+n, 0, 0, 0, 0, time.UTC).UnixMilli()
+	}
+	add := func(date int64, rrule, original, recID string) int {
+		id, err := repo.DoctorsSchedule.Add(doctor.ID, 9*60, 17*60, date, rrule, 0, original, recID, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+
+	recurring := add(day(0), "FREQ=DAILY", "", "")
+	inside := add(day(10), "", "", "")
+	add(day(30), "", "", "")                           // after the window
+	add(day(2), "", "", "")                            // before the window
+	moved := add(day(30), "", "2030-01-12 09:00", "1") // exception moved out of the window
+	add(day(30), "FREQ=WEEKLY;BYDAY=MO", "", "")       // recurring event after the window
+
+	window := Window{From: day(10), To: day(12)}
+	schedules, err := repo.DoctorsSchedule.GetAll(window)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ids := make([]int, 0, len(schedules))
+	for _, sch := range schedules {
+		ids = append(ids, sch.ID)
+	}
+	sort.Ints(ids)
+
+	expected := []int{recurring, inside, moved}
+	if len(ids) != len(expected) || ids[0] != expected[0] || ids[1] != expected[1] || ids[2] != expected[2] {
+		t.Fatalf("expected schedules %v, got %v", expected, ids)
+	}
+
+	doctors, err := repo.Doctors.GetAllWithSchedule(window)
+	if err != nil || len(doctors) != 1 || len(doctors[0].DoctorSchedule) != len(expected) {
+		t.Fatalf("expected preloaded schedules, got %+v (%v)", doctors, err)
+	}
+}
+
+func testOccupiedSlots(t *testing.T, repo Repositories) {
+	doctor := Doctor{Name: "Dr. Test", SlotSize: 30}
+	if _, err := repo.Doctors.Add(&doctor); err != nil {
+		t.Fatal(err)
+	}
+
+	date := SystemClock.Now().Add(24 * time.Hour).Truncate(time.Hour).UnixMilli()
+	next := date + time.Hour.Milliseconds()
+	later := next + time.Hour.Milliseconds()
+
+	id, err := repo.OccupiedSlots.Create(&OccupiedSlot{DoctorID: doctor.ID, Date: date, ClientName: "Client", ClientEmail: "client@scheduler.booking"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.OccupiedSlots.Create(&OccupiedSlot{DoctorID: doctor.ID, Date: date, ClientName: "Other"}, nil); err != ErrSlotTaken {
+		t.Fatalf("expected ErrSlotTaken, got %v", err)
+	}
+
+	// active holds block the slot, expired ones are replaced
+	if _, err := repo.OccupiedSlots.Create(&OccupiedSlot{DoctorID: doctor.ID, Date: next, HoldToken: "active", HoldUntil: SystemClock.Now().Add(time.Minute).UnixMilli()}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.OccupiedSlots.Create(&OccupiedSlot{DoctorID: doctor.ID, Date: next, ClientName: "Other"}, nil); err != ErrSlotTaken {
+		t.Fatalf("expected ErrSlotTaken for the held slot, got %v", err)
+	}
+	if _, err := repo.OccupiedSlots.Create(&OccupiedSlot{DoctorID: doctor.ID, Date: later, HoldToken: "expired", HoldUntil: SystemClock.Now().Add(-time.Minute).UnixMilli()}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.OccupiedSlots.Create(&OccupiedSlot{DoctorID: doctor.ID, Date: later, HoldToken: "replaced", HoldUntil: SystemClock.Now().Add(time.Minute).UnixMilli()}, nil); err != nil {
+		t.Fatalf("expired hold must be replaced, got %v", err)
+	}
+
+	if err := repo.OccupiedSlots.Move(id, doctor.ID, next, "admin", nil); err != ErrSlotTaken {
+		t.Fatalf("expected ErrSlotTaken for the move, got %v", err)
+	}
+	if err := repo.OccupiedSlots.DeleteHold("active"); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.OccupiedSlots.Move(id, doctor.ID, next, "admin", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	slots, err := repo.OccupiedSlots.GetUsedSlots(doctor.ID, next)
+	if err != nil || len(slots) != 1 || slots[0].ID != id {
+		t.Fatalf("expected moved reservation, got %+v (%v)", slots, err)
+	}
+	logs, err := repo.OccupiedSlots.GetLogs(id)
+	if err != nil || len(logs) != 1 || logs[0].Action != ActionRescheduled {
+		t.Fatalf("expected the log of the move, got %+v (%v)", logs, err)
+	}
+
+	if err := repo.Doctors.Delete(doctor.ID, false, "admin", nil); err != ErrDoctorHasReservations {
+		t.Fatalf("expected ErrDoctorHasReservations, got %v", err)
+	}
+	if err := repo.Doctors.Delete(doctor.ID, true, "admin", nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testReviews(t *testing.T, repo Repositories) {
+	reviews := []Review{
+		{DoctorID: 1, ReservationID: 1, Stars: 5},
+		{DoctorID: 1, ReservationID: 2, Stars: 4},
+		{DoctorID: 2, ReservationID: 3, Stars: 3},
+	}
+	for i := range reviews {
+		if _, err := repo.Reviews.Add(&reviews[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := repo.Reviews.Add(&Review{DoctorID: 1, ReservationID: 1, Stars: 1}); err != ErrReviewExists {
+		t.Fatalf("expected ErrReviewExists, got %v", err)
+	}
+
+	summaries, err := repo.Reviews.GetSummaries()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := ReviewSummary{Count: 2, Stars: 5, Average: 4.5, Distribution: [5]int{0, 0, 0, 1, 1}}
+	if summaries[1] != expected {
+		t.Fatalf("expected %+v, got %+v", expected, summaries[1])
+	}
+}
+
+// adds the doctor without schedules
+func addDoctor(t *testing.T, repo Repositories, slotSize int) Doctor {
+	t.Helper()
+	doctor := Doctor{Name: "Dr. Test", SlotSize: slotSize}
+	if _, err := repo.Doctors.Add(&doctor); err != nil {
+		t.Fatal(err)
+	}
+
+	return doctor
+}
+
+// returns the moment of January 2030 (in milliseconds)
+func at(day, h, m int) int64 {
+	return time.Date(2030, 1, day, h, m, 0, 0, time.UTC).UnixMilli()
+}
@@ -0,0 +1,88 @@
+package data
+
+import (
+	"errors"
+	"math"
+
+	"gorm.io/gorm"
+)
+
+var ErrReviewExists = errors.New("appointment already has a review")
+
+type reviewsDAO struct {
+	db *gorm.DB
+}
+
+func newReviewsDAO(db *gorm.DB) *reviewsDAO {
+	return &reviewsDAO{db}
+}
+
+// returns reviews of the doctor, the newest first
+func (d *reviewsDAO) GetAll(doctorID int) ([]Review, error) {
+	reviews := make([]Review, 0)
+	err := d.db.
+		Where("doctor_id = ?", doctorID).
+		Order("created_at DESC").
+		Find(&reviews).Error
+	return reviews, err
+}
+
+// adds the review, ErrReviewExists is returned if the appointment already has a review
+func (d *reviewsDAO) Add(review *Review) (int, error) {
+	err := d.db.Create(review).Error
+	if isUniqueViolation(err) {
+		err = ErrReviewExists
+	}
+
+	return review.ID, err
+}
+
+// returns review summaries by doctors, totals of legacy reviews are included
+func (d *reviewsDAO) GetSummaries() (map[int]ReviewSummary, error) {
+	rows := make([]ReviewTotal, 0)
+	err := d.db.Model(&Review{}).
+		Select("doctor_id, stars, COUNT(*) AS count").
+		Group("doctor_id, stars").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	totals := make([]ReviewTotal, 0)
+	if err := d.db.Find(&totals).Error; err != nil {
+		return nil, err
+	}
+	rows = append(rows, totals...)
+
+	summaries := make(map[int]ReviewSummary)
+	for _, row := range rows {
+		if row.Stars < 1 || row.Stars > 5 {
+			continue
+		}
+
+		summary := summaries[row.DoctorID]
+		summary.Distribution[row.Stars-1] += row.Count
+		summaries[row.DoctorID] = summary
+	}
+
+	completeSummaries(summaries)
+
+	return summaries, nil
+}
+
+// calculates totals of summaries by their distributions
+func completeSummaries(summaries map[int]ReviewSummary) {
+	for id, summary := range summaries {
+		total := 0
+		for i, count := range summary.Distribution {
+			summary.Count += count
+			total += (i + 1) * count
+		}
+
+		if summary.Count > 0 {
+			summary.Average = math.Round(float64(total)/float64(summary.Count)*100) / 100
+			summary.Stars = int(math.Round(summary.Average))
+		}
+		summaries[id] = summary
+	}
+}
@@ -0,0 +1,44 @@
+package data
+
+import (
+	"gorm.io/gorm"
+)
+
+type servicesDAO struct {
+	db *gorm.DB
+}
+
+func newServicesDAO(db *gorm.DB) *servicesDAO {
+	return &servicesDAO{db}
+}
+
+func (d *servicesDAO) GetOne(id int) (ServiceType, error) {
+	service := ServiceType{}
+	err := d.db.Find(&service, id).Error
+	return service, err
+}
+
+// returns services of the doctor, 0 returns services of all doctors
+func (d *servicesDAO) GetAll(doctorID int) ([]ServiceType, error) {
+	services := make([]ServiceType, 0)
+	query := d.db.Order("id")
+	if doctorID != 0 {
+		query = query.Where("doctor_id = ?", doctorID)
+	}
+
+	err := query.Find(&services).Error
+	return services, err
+}
+
+func (d *servicesDAO) Add(service *ServiceType) (int, error) {
+	err := d.db.Create(service).Error
+	return service.ID, err
+}
+
+func (d *servicesDAO) Update(service ServiceType) error {
+	return d.db.Save(&service).Error
+}
+
+func (d *servicesDAO) Delete(id int) error {
+	return d.db.Delete(&ServiceType{}, id).Error
+}
@@ -0,0 +1,202 @@
+package data
+
+import (
+	"sync"
+	"testing"
+)
+
+func testServices(t *testing.T, repo Repositories) {
+	doctor := addDoctor(t, repo, 20)
+
+	intake := ServiceType{DoctorID: doctor.ID, Name: "Intake", Duration: 60, Buffer: 10, Price: "$90"}
+	if _, err := repo.Services.Add(&intake); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Services.Add(&ServiceType{DoctorID: doctor.ID + 1, Name: "Other", Duration: 20}); err != nil {
+		t.Fatal(err)
+	}
+	if services, err := repo.Services.GetAll(doctor.ID); err != nil || len(services) != 1 || services[0] != intake {
+		t.Fatalf("expected %+v, got %+v (%v)", intake, services, err)
+	}
+
+	// the intake occupies 10:00-11:10
+	record := OccupiedSlot{DoctorID: doctor.ID, Date: at(1, 10, 0), ServiceID: intake.ID, Duration: intake.Duration, Buffer: intake.Buffer}
+	if _, err := repo.OccupiedSlots.Create(&record, nil); err != nil || record.ID == 0 {
+		t.Fatalf("expected the reservation, got %v", err)
+	}
+
+	cases := []struct {
+		record OccupiedSlot
+		err    error
+	}{
+		{record: OccupiedSlot{DoctorID: doctor.ID, Date: at(1, 10, 40)}, err: ErrSlotTaken},
+		{record: OccupiedSlot{DoctorID: doctor.ID, Date: at(1, 11, 0)}, err: ErrSlotTaken}, // buffer
+		{record: OccupiedSlot{DoctorID: doctor.ID, Date: at(1, 9, 40), Duration: 30}, err: ErrSlotTaken},
+		{record: OccupiedSlot{DoctorID: doctor.ID, Date: at(1, 9, 40), Duration: 20}},
+		{record: OccupiedSlot{DoctorID: doctor.ID, Date: at(1, 11, 10), Duration: 20}},
+		{record: OccupiedSlot{DoctorID: doctor.ID + 1, Date: at(1, 10, 20), Duration: 20}},
+	}
+	for _, c := range cases {
+		if _, err := repo.OccupiedSlots.Create(&c.record, nil); err != c.err {
+			t.Fatalf("%+v: expected %v, got %v", c.record, c.err, err)
+		}
+	}
+
+	intake.Price = "$100"
+	if err := repo.Services.Update(intake); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Services.Delete(intake.ID); err != nil {
+		t.Fatal(err)
+	}
+	if service, err := repo.Services.GetOne(intake.ID); err != nil || service.ID != 0 {
+		t.Fatalf("expected the service to be deleted, got %+v (%v)", service, err)
+	}
+}
+
+func testGroupSessions(t *testing.T, repo Repositories) {
+	doctor := addDoctor(t, repo, 60)
+	session := func(date int64) *OccupiedSlot {
+		return &OccupiedSlot{DoctorID: doctor.ID, Date: date, ServiceID: 1, Duration: 60, Capacity: 2}
+	}
+
+	first, second := session(at(1, 10, 0)), session(at(1, 10, 0))
+	for _, record := range []*OccupiedSlot{first, second} {
+		if _, err := repo.OccupiedSlots.Create(record, nil); err != nil {
+			t.Fatalf("expected the seat of the session, got %v", err)
+		}
+	}
+	if first.Seat == second.Seat {
+		t.Fatalf("expected different seats, got %d", first.Seat)
+	}
+
+	cases := []struct {
+		record *OccupiedSlot
+		err    error
+	}{
+		{record: session(at(1, 10, 0)), err: ErrSlotTaken},                                               // full
+		{record: &OccupiedSlot{DoctorID: doctor.ID, Date: at(1, 10, 0), Capacity: 8}, err: ErrSlotTaken}, // another service
+		{record: &OccupiedSlot{DoctorID: doctor.ID, Date: at(1, 10, 0), ServiceID: 1, Duration: 60, Capacity: 8}, err: ErrSlotTaken},
+		{record: session(at(1, 11, 0))},
+	}
+	for _, c := range cases {
+		if _, err := repo.OccupiedSlots.Create(c.record, nil); err != c.err {
+			t.Fatalf("%+v: expected %v, got %v", c.record, c.err, err)
+		}
+	}
+
+	slots, err := repo.OccupiedSlots.GetUsedSlots(doctor.ID, at(1, 10, 0))
+	if err != nil || len(slots) != 2 {
+		t.Fatalf("expected 2 reservations of the session, got %+v (%v)", slots, err)
+	}
+
+	// the freed seat is taken by the moved reservation
+	if err := repo.OccupiedSlots.Delete(first.ID, "admin", nil); err != nil {
+		t.Fatal(err)
+	}
+	last := session(at(1, 11, 0))
+	if _, err := repo.OccupiedSlots.Create(last, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.OccupiedSlots.Move(last.ID, doctor.ID, at(1, 10, 0), "admin", nil); err != nil {
+		t.Fatalf("expected the move to the free seat, got %v", err)
+	}
+	if moved, err := repo.OccupiedSlots.GetOne(last.ID); err != nil || moved.Seat == second.Seat {
+		t.Fatalf("expected another seat, got %+v (%v)", moved, err)
+	}
+	if _, err := repo.OccupiedSlots.Create(session(at(1, 11, 0)), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.OccupiedSlots.Move(second.ID, doctor.ID, at(1, 11, 0), "admin", nil); err != ErrSlotTaken {
+		t.Fatalf("expected ErrSlotTaken for the move to the full session, got %v", err)
+	}
+}
+
+func testConcurrentReservations(t *testing.T, repo Repositories) {
+	doctor := addDoctor(t, repo, 10)
+
+	// hour-long reservations which start at different times of the same hour
+	errs := make(chan error, 6)
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := repo.OccupiedSlots.Create(&OccupiedSlot{DoctorID: doctor.ID, Date: at(1, 9, i*10), Duration: 60}, nil)
+			errs <- err
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	booked := 0
+	for err := range errs {
+		switch err {
+		case nil:
+			booked++
+		case ErrSlotTaken:
+		default:
+			t.Fatal(err)
+		}
+	}
+	if booked != 1 {
+		t.Fatalf("expected one of overlapping reservations, got %d", booked)
+	}
+
+	// reservations moved to overlapping times
+	moved := make([]OccupiedSlot, 2)
+	for i := range moved {
+		moved[i] = OccupiedSlot{DoctorID: doctor.ID, Date: at(1, 12+i*2, 0), Duration: 60}
+		if _, err := repo.OccupiedSlots.Create(&moved[i], nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	errs = make(chan error, len(moved))
+	for i, slot := range moved {
+		wg.Add(1)
+		go func(i int, slot OccupiedSlot) {
+			defer wg.Done()
+			errs <- repo.OccupiedSlots.Move(slot.ID, doctor.ID, at(1, 16, i*30), "admin", nil)
+		}(i, slot)
+	}
+	wg.Wait()
+	close(errs)
+
+	booked = 0
+	for err := range errs {
+		switch err {
+		case nil:
+			booked++
+		case ErrSlotTaken:
+		default:
+			t.Fatal(err)
+		}
+	}
+	if booked != 1 {
+		t.Fatalf("expected one of overlapping moves, got %d", booked)
+	}
+}
+
+func testOverlappingReservations(t *testing.T, repo Repositories) {
+	doctor := addDoctor(t, repo, 30)
+	other := addDoctor(t, repo, 30)
+
+	records := []*OccupiedSlot{
+		{DoctorID: doctor.ID, Date: at(1, 8, 0), Duration: 60, Buffer: 30}, // ends with its buffer at 9:30
+		{DoctorID: doctor.ID, Date: at(1, 7, 30)},                          // takes the slot till 8:00
+		{DoctorID: doctor.ID, Date: at(1, 9, 30)},
+		{DoctorID: doctor.ID, Date: at(1, 10, 0)},
+		{DoctorID: other.ID, Date: at(1, 9, 30)},
+		{DoctorID: doctor.ID, Date: at(1, 9, 45), HoldToken: "hold", HoldUntil: at(2, 0, 0)},
+	}
+	for _, record := range records {
+		if _, err := repo.OccupiedSlots.Create(record, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	slots, err := repo.OccupiedSlots.GetOverlapping(doctor.ID, at(1, 8, 0), at(1, 10, 0))
+	if err != nil || len(slots) != 2 || slots[0].ID != records[0].ID || slots[1].ID != records[2].ID {
+		t.Fatalf("expected reservations overlapping 8:00-10:00, got %+v (%v)", slots, err)
+	}
+}
@@ -0,0 +1,42 @@
+package data
+
+import (
+	"gorm.io/gorm"
+)
+
+type timeOffDAO struct {
+	db *gorm.DB
+}
+
+func newTimeOffDAO(db *gorm.DB) *timeOffDAO {
+	return &timeOffDAO{db}
+}
+
+func (d *timeOffDAO) GetOne(id int) (TimeOff, error) {
+	timeOff := TimeOff{}
+	err := d.db.Find(&timeOff, id).Error
+	return timeOff, err
+}
+
+// returns time off of all doctors which overlaps the interval ordered by its start
+func (d *timeOffDAO) GetAll(window Window) ([]TimeOff, error) {
+	timeOff := make([]TimeOff, 0)
+	err := d.db.
+		Where("start_date < ? AND end_date > ?", window.To, window.From).
+		Order("start_date, id").
+		Find(&timeOff).Error
+	return timeOff, err
+}
+
+func (d *timeOffDAO) Add(timeOff *TimeOff) (int, error) {
+	err := d.db.Create(timeOff).Error
+	return timeOff.ID, err
+}
+
+func (d *timeOffDAO) Update(timeOff TimeOff) error {
+	return d.db.Save(&timeOff).Error
+}
+
+func (d *timeOffDAO) Delete(id int) error {
+	return d.db.Delete(&TimeOff{}, id).Error
+}
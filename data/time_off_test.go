@@ -0,0 +1,40 @@
+package data
+
+import (
+	"testing"
+)
+
+func testTimeOff(t *testing.T, repo Repositories) {
+	doctor := addDoctor(t, repo, 30)
+
+	vacation := TimeOff{DoctorID: doctor.ID, StartDate: at(11, 0, 0), EndDate: at(21, 0, 0), Reason: "vacation"}
+	if _, err := repo.TimeOff.Add(&vacation); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.TimeOff.Add(&TimeOff{DoctorID: doctor.ID, StartDate: at(31, 0, 0), EndDate: at(32, 0, 0)}); err != nil {
+		t.Fatal(err)
+	}
+
+	found, err := repo.TimeOff.GetAll(Window{From: at(20, 0, 0), To: at(31, 0, 0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 || found[0] != vacation {
+		t.Fatalf("expected %+v, got %+v", vacation, found)
+	}
+
+	vacation.EndDate = at(16, 0, 0)
+	if err := repo.TimeOff.Update(vacation); err != nil {
+		t.Fatal(err)
+	}
+	if found, err := repo.TimeOff.GetAll(Window{From: at(20, 0, 0), To: at(31, 0, 0)}); err != nil || len(found) != 0 {
+		t.Fatalf("expected no time off after the update, got %+v (%v)", found, err)
+	}
+
+	if err := repo.Doctors.Delete(doctor.ID, false, "admin", nil); err != nil {
+		t.Fatal(err)
+	}
+	if timeOff, err := repo.TimeOff.GetOne(vacation.ID); err != nil || timeOff.ID != 0 {
+		t.Fatalf("expected time off to be deleted with the doctor, got %+v (%v)", timeOff, err)
+	}
+}
@@ -2,10 +2,90 @@ package data
 
 import "time"
 
-func Now() time.Time {
-	return time.Now().UTC()
+// source of the current time, fixed clocks make the scheduling logic deterministic
+type Clock func() time.Time
+
+var SystemClock Clock = time.Now
+
+// returns the clock which always shows the moment
+func FixedClock(t time.Time) Clock {
+	return func() time.Time { return t }
+}
+
+func (c Clock) Now() time.Time {
+	return c().UTC()
+}
+
+// returns the current date in UTC
+func (c Clock) Today() time.Time {
+	return c.Now().Truncate(24 * time.Hour)
+}
+
+// returns the current date of the location as wall clock encoded in UTC
+func (c Clock) TodayIn(loc *time.Location) time.Time {
+	y, m, d := c.Now().In(loc).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// converts the moment (in milliseconds) to the wall clock of the location encoded in UTC
+func ToWall(stamp int64, loc *time.Location) int64 {
+	t := time.UnixMilli(stamp).In(loc)
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC).UnixMilli()
+}
+
+// converts the wall clock of the location encoded in UTC (in milliseconds) to the moment
+func FromWall(stamp int64, loc *time.Location) int64 {
+	t := time.UnixMilli(stamp).UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), loc).UnixMilli()
+}
+
+// returns the location by IANA name, UTC is used by default
+func LoadLocation(name string) (*time.Location, error) {
+	if name == "" {
+		return time.UTC, nil
+	}
+
+	return time.LoadLocation(name)
 }
 
-func DateNow() time.Time {
-	return Now().Truncate(24 * time.Hour)
+// end date of endless recurring schedules, as in the Scheduler
+var EndDate = time.Date(9999, 2, 1, 0, 0, 0, 0, time.UTC)
+
+const dayMilli = 24 * 60 * 60 * 1000 // in milliseconds
+
+// interval of dates [From, To), wall clock encoded in UTC (in milliseconds)
+type Window struct {
+	From int64
+	To   int64
+}
+
+// returns the interval of upcoming reservations (moments) related to the window;
+// reservations are stored as moments, so the interval is extended to cover all time zones
+// and the neighboring days of schedules which encompass midnight
+func (w Window) slots(now int64) (from, to int64) {
+	from = w.From - 2*dayMilli
+	if from < now {
+		from = now
+	}
+
+	return from, w.To + 2*dayMilli
+}
+
+// returns the bounds of schedules which can have occurrences in the window,
+// the schedule of the previous day can encompass midnight
+func (w Window) schedules() (from, to int64, origFrom, origTo string) {
+	from = w.From - dayMilli
+	origFrom = time.UnixMilli(from).UTC().Format("2006-01-02")
+	origTo = time.UnixMilli(w.To).UTC().Format("2006-01-02")
+
+	return from, w.To, origFrom, origTo
+}
+
+// checks the schedule by the same conditions as the SQL filter of schedules
+func (w Window) includes(sch DoctorSchedule) bool {
+	from, to, origFrom, origTo := w.schedules()
+
+	return (sch.Rrule != "" && sch.Date < to) ||
+		(sch.Date >= from && sch.Date < to) ||
+		(sch.RecurringEventID != "" && sch.OriginalStart >= origFrom && sch.OriginalStart < origTo)
 }
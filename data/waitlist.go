@@ -0,0 +1,150 @@
+package data
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+var ErrOfferClosed = errors.New("offer is claimed or has expired")
+
+type waitlistDAO struct {
+	db    *gorm.DB
+	clock Clock
+}
+
+func newWaitlistDAO(db *gorm.DB, clock Clock) *waitlistDAO {
+	return &waitlistDAO{db, clock}
+}
+
+func (d *waitlistDAO) GetOne(id int) (WaitlistEntry, error) {
+	entry := WaitlistEntry{}
+	err := d.db.Find(&entry, id).Error
+	return entry, err
+}
+
+// returns entries of the doctor in the order of registration, 0 returns entries of all doctors
+func (d *waitlistDAO) GetAll(doctorID int) ([]WaitlistEntry, error) {
+	entries := make([]WaitlistEntry, 0)
+	query := d.db.Order("id")
+	if doctorID != 0 {
+		query = query.Where("doctor_id = ?", doctorID)
+	}
+	err := query.Find(&entries).Error
+	return entries, err
+}
+
+// returns entries whose offers have expired before the moment in the order of registration
+func (d *waitlistDAO) GetExpiredOffers(now int64) ([]WaitlistEntry, error) {
+	entries := make([]WaitlistEntry, 0)
+	err := d.db.
+		Where("status = ? AND offer_until < ?", WaitlistOffered, now).
+		Order("id").
+		Find(&entries).Error
+	return entries, err
+}
+
+func (d *waitlistDAO) GetByOffer(token string) (WaitlistEntry, error) {
+	entry := WaitlistEntry{}
+	err := d.db.
+		Limit(1).
+		Find(&entry, "offer_token = ?", token).Error
+	return entry, err
+}
+
+func (d *waitlistDAO) Add(entry *WaitlistEntry) (int, error) {
+	err := d.db.Create(entry).Error
+	return entry.ID, err
+}
+
+// offers the held slot to the waiting patient, false is returned if the entry isn't waiting anymore
+func (d *waitlistDAO) Offer(id int, token string, date, until int64) (bool, error) {
+	res := d.db.Model(&WaitlistEntry{}).
+		Where("id = ? AND status = ?", id, WaitlistWaiting).
+		Updates(map[string]interface{}{
+			"status":      WaitlistOffered,
+			"offer_token": token,
+			"offer_date":  date,
+			"offer_until": until,
+		})
+	return res.RowsAffected > 0, res.Error
+}
+
+// closes the offer with the status, false is returned if the entry has no offer
+func (d *waitlistDAO) Close(id int, status string, reservationID int) (bool, error) {
+	res := d.db.Model(&WaitlistEntry{}).
+		Where("id = ? AND status = ?", id, WaitlistOffered).
+		Updates(map[string]interface{}{"status": status, "reservation_id": reservationID})
+	return res.RowsAffected > 0, res.Error
+}
+
+// closes waiting entries of the doctor whose requested time has passed before the moment (wall clock),
+// returns their number
+func (d *waitlistDAO) ExpireWaiting(doctorID int, wall int64) (int64, error) {
+	res := d.db.Model(&WaitlistEntry{}).
+		Where("doctor_id = ? AND status = ? AND end_date < ?", doctorID, WaitlistWaiting, wall).
+		Update("status", WaitlistExpired)
+	return res.RowsAffected, res.Error
+}
+
+// closes the offer as claimed and turns its hold into the reservation of the patient,
+// the message is added to the outbox in the same transaction
+func (d *waitlistDAO) Claim(id int, msg *OutboxMessage) (int, error) {
+	slot := OccupiedSlot{}
+	err := d.db.Transaction(func(tx *gorm.DB) error {
+		entry := WaitlistEntry{}
+		if err := tx.Find(&entry, id).Error; err != nil {
+			return err
+		}
+
+		// the offer can expire concurrently
+		res := tx.Model(&WaitlistEntry{}).
+			Where("id = ? AND status = ?", id, WaitlistOffered).
+			Update("status", WaitlistClaimed)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrOfferClosed
+		}
+
+		err := tx.
+			Limit(1).
+			Find(&slot, "hold_token = ? AND hold_until >= ?", entry.OfferToken, d.clock.Now().UnixMilli()).Error
+		if err != nil {
+			return err
+		}
+		if slot.ID == 0 {
+			return ErrHoldNotFound
+		}
+
+		err = tx.Model(&OccupiedSlot{}).
+			Where("id = ?", slot.ID).
+			Updates(map[string]interface{}{
+				"client_name":    entry.ClientName,
+				"client_email":   entry.ClientEmail,
+				"client_details": entry.ClientDetails,
+				"hold_token":     "",
+				"hold_until":     0,
+			}).Error
+		if err != nil {
+			return err
+		}
+
+		err = tx.Model(&WaitlistEntry{}).Where("id = ?", id).Update("reservation_id", slot.ID).Error
+		if err != nil {
+			return err
+		}
+
+		return enqueue(tx, msg)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return slot.ID, nil
+}
+
+func (d *waitlistDAO) Delete(id int) error {
+	return d.db.Delete(&WaitlistEntry{}, id).Error
+}
@@ -0,0 +1,143 @@
+package data
+
+import (
+	"testing"
+)
+
+func testWaitlist(t *testing.T, repo Repositories) {
+	doctor := addDoctor(t, repo, 30)
+
+	entries := []WaitlistEntry{
+		{DoctorID: doctor.ID, ClientEmail: "first@scheduler.booking", Status: WaitlistWaiting},
+		{DoctorID: doctor.ID + 1, ClientEmail: "other@scheduler.booking", Status: WaitlistWaiting},
+		{DoctorID: doctor.ID, ClientEmail: "second@scheduler.booking", Status: WaitlistWaiting},
+	}
+	for i := range entries {
+		if _, err := repo.Waitlist.Add(&entries[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	all, err := repo.Waitlist.GetAll(doctor.ID)
+	if err != nil || len(all) != 2 || all[0].ID != entries[0].ID || all[1].ID != entries[2].ID {
+		t.Fatalf("expected entries of the doctor in order, got %+v (%v)", all, err)
+	}
+
+	first := entries[0].ID
+	if ok, err := repo.Waitlist.Offer(first, "token", 1, 2); err != nil || !ok {
+		t.Fatalf("expected the offer, got %v (%v)", ok, err)
+	}
+	if ok, err := repo.Waitlist.Offer(first, "again", 1, 2); err != nil || ok {
+		t.Fatalf("expected the entry with the offer to be skipped, got %v (%v)", ok, err)
+	}
+	if entry, err := repo.Waitlist.GetByOffer("token"); err != nil || entry.ID != first || entry.Status != WaitlistOffered || entry.OfferUntil != 2 {
+		t.Fatalf("expected the offered entry, got %+v (%v)", entry, err)
+	}
+
+	if ok, err := repo.Waitlist.Close(first, WaitlistClaimed, 10); err != nil || !ok {
+		t.Fatalf("expected the claim, got %v (%v)", ok, err)
+	}
+	if ok, err := repo.Waitlist.Close(first, WaitlistExpired, 0); err != nil || ok {
+		t.Fatalf("expected the claimed offer to be kept, got %v (%v)", ok, err)
+	}
+	if entry, err := repo.Waitlist.GetOne(first); err != nil || entry.Status != WaitlistClaimed || entry.ReservationID != 10 {
+		t.Fatalf("expected the claimed entry, got %+v (%v)", entry, err)
+	}
+
+	if err := repo.Doctors.Delete(doctor.ID, false, "admin", nil); err != nil {
+		t.Fatal(err)
+	}
+	if all, err := repo.Waitlist.GetAll(0); err != nil || len(all) != 1 {
+		t.Fatalf("expected entries of the deleted doctor to be deleted, got %+v (%v)", all, err)
+	}
+}
+
+func testWaitlistClaim(t *testing.T, repo Repositories) {
+	doctor := addDoctor(t, repo, 30)
+
+	add := func(email, token string, date, until int64) int {
+		t.Helper()
+		entry := WaitlistEntry{DoctorID: doctor.ID, ClientName: "Client", ClientEmail: email, Status: WaitlistWaiting}
+		if _, err := repo.Waitlist.Add(&entry); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := repo.OccupiedSlots.Create(&OccupiedSlot{DoctorID: doctor.ID, Date: date, HoldToken: token, HoldUntil: until}, nil); err != nil {
+			t.Fatal(err)
+		}
+		if ok, err := repo.Waitlist.Offer(entry.ID, token, date, until); err != nil || !ok {
+			t.Fatalf("expected the offer, got %v (%v)", ok, err)
+		}
+		return entry.ID
+	}
+	msg := func() *OutboxMessage {
+		return &OutboxMessage{Event: "booked", Recipient: "client@scheduler.booking", Status: OutboxPending, NextAttempt: 10}
+	}
+
+	active := add("client@scheduler.booking", "active", at(7, 10, 0), at(31, 0, 0))
+	stale := add("stale@scheduler.booking", "stale", at(7, 11, 0), 1)
+
+	// nothing is changed if the hold has expired
+	if _, err := repo.Waitlist.Claim(stale, msg()); err != ErrHoldNotFound {
+		t.Fatalf("expected ErrHoldNotFound, got %v", err)
+	}
+	if entry, err := repo.Waitlist.GetOne(stale); err != nil || entry.Status != WaitlistOffered {
+		t.Fatalf("expected the entry to keep the offer, got %+v (%v)", entry, err)
+	}
+
+	id, err := repo.Waitlist.Claim(active, msg())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if slot, err := repo.OccupiedSlots.GetOne(id); err != nil || slot.ClientEmail != "client@scheduler.booking" || slot.HoldUntil != 0 {
+		t.Fatalf("expected the reservation of the patient, got %+v (%v)", slot, err)
+	}
+	if entry, err := repo.Waitlist.GetOne(active); err != nil || entry.Status != WaitlistClaimed || entry.ReservationID != id {
+		t.Fatalf("expected the claimed entry, got %+v (%v)", entry, err)
+	}
+	if due, err := repo.Outbox.GetDue(10, 10); err != nil || len(due) != 1 {
+		t.Fatalf("expected the message of the claim only, got %+v (%v)", due, err)
+	}
+
+	// closed offers can't be claimed
+	if _, err := repo.Waitlist.Claim(active, nil); err != ErrOfferClosed {
+		t.Fatalf("expected ErrOfferClosed for the claimed offer, got %v", err)
+	}
+	if ok, err := repo.Waitlist.Close(stale, WaitlistExpired, 0); err != nil || !ok {
+		t.Fatalf("expected the offer to expire, got %v (%v)", ok, err)
+	}
+	if _, err := repo.Waitlist.Claim(stale, nil); err != ErrOfferClosed {
+		t.Fatalf("expected ErrOfferClosed for the expired offer, got %v", err)
+	}
+}
+
+func testWaitlistExpiration(t *testing.T, repo Repositories) {
+	doctor := addDoctor(t, repo, 30)
+
+	entries := []WaitlistEntry{
+		{DoctorID: doctor.ID, StartDate: at(7, 10, 0), EndDate: at(7, 10, 0), Status: WaitlistOffered, OfferUntil: 10},
+		{DoctorID: doctor.ID, StartDate: at(7, 10, 0), EndDate: at(7, 10, 0), Status: WaitlistOffered, OfferUntil: 30},
+		{DoctorID: doctor.ID, StartDate: at(7, 9, 0), EndDate: at(7, 12, 0), Status: WaitlistWaiting},
+		{DoctorID: doctor.ID, StartDate: at(8, 9, 0), EndDate: at(8, 9, 0), Status: WaitlistWaiting},
+		{DoctorID: doctor.ID + 1, StartDate: at(7, 9, 0), EndDate: at(7, 9, 0), Status: WaitlistWaiting},
+		{DoctorID: doctor.ID, StartDate: at(7, 9, 0), EndDate: at(7, 9, 0), Status: WaitlistClaimed},
+	}
+	for i := range entries {
+		if _, err := repo.Waitlist.Add(&entries[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expired, err := repo.Waitlist.GetExpiredOffers(20)
+	if err != nil || len(expired) != 1 || expired[0].ID != entries[0].ID {
+		t.Fatalf("expected the expired offer, got %+v (%v)", expired, err)
+	}
+
+	// only waiting entries of the doctor whose times have passed
+	if count, err := repo.Waitlist.ExpireWaiting(doctor.ID, at(7, 12, 1)); err != nil || count != 1 {
+		t.Fatalf("expected the closed entry, got %d (%v)", count, err)
+	}
+	for i, status := range []string{WaitlistOffered, WaitlistOffered, WaitlistExpired, WaitlistWaiting, WaitlistWaiting, WaitlistClaimed} {
+		if entry, err := repo.Waitlist.GetOne(entries[i].ID); err != nil || entry.Status != status {
+			t.Fatalf("expected the %s entry, got %+v (%v)", status, entry, err)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package jobs
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"scheduler-booking/data"
+	"sync"
+	"time"
+)
+
+// background job which runs periodically
+type Job struct {
+	Name     string
+	Interval time.Duration
+	Aligned  bool // runs start at multiples of the interval (UTC), e.g. at whole hours
+	Run      func() error
+}
+
+// runs jobs in the background, replicas which share the database take turns by leases,
+// so each run of the job happens on one replica only
+type Runner struct {
+	leases data.LeasesRepository
+	clock  data.Clock
+	owner  string // the replica
+	jobs   []Job
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+func NewRunner(repo data.Repositories) *Runner {
+	return &Runner{leases: repo.Leases, clock: repo.Clock, owner: newOwner(), stop: make(chan struct{})}
+}
+
+func (r *Runner) Add(job Job) {
+	r.jobs = append(r.jobs, job)
+}
+
+// starts jobs in the background, the first run of each job happens after its interval
+func (r *Runner) Start() {
+	for _, job := range r.jobs {
+		r.wg.Add(1)
+		go r.loop(job)
+	}
+}
+
+// stops jobs and waits for the running ones
+func (r *Runner) Stop() {
+	close(r.stop)
+	r.wg.Wait()
+}
+
+func (r *Runner) loop(job Job) {
+	defer r.wg.Done()
+
+	delay := job.Interval
+	if job.Aligned {
+		now := r.clock.Now()
+		delay = now.Truncate(job.Interval).Add(job.Interval).Sub(now)
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-timer.C:
+		}
+
+		if _, err := r.RunOnce(job); err != nil {
+			log.Printf("ERROR: job %s: %v", job.Name, err)
+		}
+		timer.Reset(job.Interval)
+	}
+}
+
+// runs the job if the replica holds its lease, false is returned if another replica holds it;
+// the lease lasts for two intervals and it is renewed while the job runs,
+// so another replica takes over the job only when the owner stops
+func (r *Runner) RunOnce(job Job) (bool, error) {
+	ok, err := r.acquire(job)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	done, renewed := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(renewed)
+		r.renew(job, done)
+	}()
+
+	err = job.Run()
+	close(done)
+	<-renewed
+	return true, err
+}
+
+func (r *Runner) acquire(job Job) (bool, error) {
+	now := r.clock.Now()
+	return r.leases.Acquire(job.Name, r.owner, now.UnixMilli(), now.Add(2*job.Interval).UnixMilli())
+}
+
+// extends the lease after each interval until the run is done
+func (r *Runner) renew(job Job, done chan struct{}) {
+	ticker := time.NewTicker(job.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+
+		ok, err := r.acquire(job)
+		if err != nil {
+			log.Printf("WARN: lease of job %s is not renewed: %v", job.Name, err)
+		} else if !ok {
+			log.Printf("WARN: lease of job %s is taken by another replica", job.Name)
+		}
+	}
+}
+
+// returns the unique name of the replica
+func newOwner() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+
+	return fmt.Sprintf("%s-%d-%s", host, os.Getpid(), hex.EncodeToString(b))
+}
@@ -0,0 +1,108 @@
+package jobs
+
+import (
+	"errors"
+	"scheduler-booking/data"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRunOnce(t *testing.T) {
+	now := time.Date(2030, 1, 7, 8, 0, 0, 0, time.UTC)
+	repo := data.NewMemory(func() time.Time { return now })
+
+	// replicas share the storage
+	first, second := NewRunner(repo), NewRunner(repo)
+	runs := 0
+	job := Job{Name: "job", Interval: time.Minute, Run: func() error { runs++; return nil }}
+
+	run := func(r *Runner, expected bool) {
+		t.Helper()
+		ok, err := r.RunOnce(job)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok != expected {
+			t.Fatalf("expected the run %v, got %v at %s", expected, ok, now)
+		}
+	}
+
+	run(first, true)
+	run(second, false)
+	now = now.Add(time.Minute)
+	run(second, false)
+	run(first, true)
+
+	// another replica takes over the job when its owner stops
+	now = now.Add(2 * time.Minute)
+	run(second, true)
+	now = now.Add(time.Minute)
+	run(first, false)
+	if runs != 3 {
+		t.Fatalf("expected 3 runs, got %d", runs)
+	}
+
+	// errors of jobs are returned, the lease is kept
+	failing := Job{Name: "failing", Interval: time.Minute, Run: func() error { return errors.New("failed") }}
+	if ok, err := first.RunOnce(failing); !ok || err == nil {
+		t.Fatalf("expected the error of the job, got %v (%v)", ok, err)
+	}
+	if ok, err := second.RunOnce(failing); ok || err != nil {
+		t.Fatalf("expected the lease of another replica, got %v (%v)", ok, err)
+	}
+}
+
+func TestStart(t *testing.T) {
+	repo := data.NewMemory(data.SystemClock)
+	first, second := NewRunner(repo), NewRunner(repo)
+
+	var runs int32
+	for _, r := range []*Runner{first, second} {
+		r.Add(Job{Name: "job", Interval: 10 * time.Millisecond, Run: func() error {
+			atomic.AddInt32(&runs, 1)
+			return nil
+		}})
+		r.Start()
+	}
+
+	time.Sleep(105 * time.Millisecond)
+	first.Stop()
+	second.Stop()
+
+	// ticks of both replicas, but the job runs once per interval
+	if count := atomic.LoadInt32(&runs); count == 0 || count > 11 {
+		t.Fatalf("expected at most 11 runs, got %d", count)
+	}
+}
+
+func TestRenewal(t *testing.T) {
+	repo := data.NewMemory(data.SystemClock)
+	first, second := NewRunner(repo), NewRunner(repo)
+
+	// the run is longer than the lease of two intervals
+	started := make(chan struct{}, 2)
+	job := Job{Name: "job", Interval: 20 * time.Millisecond, Run: func() error {
+		started <- struct{}{}
+		time.Sleep(150 * time.Millisecond)
+		return nil
+	}}
+
+	result := make(chan bool)
+	go func() {
+		ok, err := first.RunOnce(job)
+		if err != nil {
+			t.Error(err)
+		}
+		result <- ok
+	}()
+
+	<-started
+	time.Sleep(100 * time.Millisecond)
+	if ok, err := second.RunOnce(job); ok || err != nil {
+		t.Fatalf("expected the renewed lease of the running replica, got %v (%v)", ok, err)
+	}
+	if ok := <-result; !ok {
+		t.Fatal("expected the run of the first replica")
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"scheduler-booking/data"
+	"strconv"
+	"time"
+)
+
+const migrateUsage = `usage: scheduler-booking migrate <command>
+
+commands:
+  up [version]   apply pending migrations (up to the version)
+  down [steps]   revert the last applied migrations (1 by default)
+  status         list migrations`
+
+// runs the migrate subcommand and returns the exit code
+func migrate(args []string) int {
+	if len(args) == 0 || len(args) > 2 {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	number := 0
+	if len(args) == 2 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 0 {
+			fmt.Fprintf(os.Stderr, "invalid number %q\n\n%s\n", args[1], migrateUsage)
+			return 2
+		}
+		number = n
+	}
+
+	m, err := data.NewMigrator(Config.DB)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	switch args[0] {
+	case "up":
+		done, err := m.Up(number)
+		for _, v := range done {
+			fmt.Printf("applied %d\n", v)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if len(done) == 0 {
+			fmt.Println("no pending migrations")
+		}
+	case "down":
+		if number == 0 {
+			number = 1
+		}
+		done, err := m.Down(number)
+		for _, v := range done {
+			fmt.Printf("reverted %d\n", v)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	case "status":
+		status, err := m.Status()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		for _, s := range status {
+			applied := "pending"
+			if s.Applied {
+				applied = "applied " + time.UnixMilli(s.AppliedAt).UTC().Format(time.RFC3339)
+			}
+			fmt.Printf("%4d  %-30s %s\n", s.Version, s.Name, applied)
+		}
+	default:
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	return 0
+}
@@ -0,0 +1,103 @@
+package notify
+
+import (
+	"encoding/json"
+	"log"
+	"scheduler-booking/data"
+	"time"
+)
+
+const (
+	batchSize  = 50              // messages of one dispatch
+	maxBackoff = 24 * time.Hour  // the longest delay between attempts
+	claimTime  = 5 * time.Minute // another replica retries the message if the sending one stops for longer
+)
+
+// sends messages of the outbox through the notifier
+type Dispatcher struct {
+	repo     data.OutboxRepository
+	notifier Notifier
+	config   Config
+	clock    data.Clock
+}
+
+func NewDispatcher(repo data.Repositories, notifier Notifier, config Config) *Dispatcher {
+	return &Dispatcher{repo: repo.Outbox, notifier: notifier, config: config, clock: repo.Clock}
+}
+
+// sends due messages of the outbox and returns the number of sent ones,
+// failed messages are retried with the growing delay until attempts are over;
+// each message is claimed before sending, so replicas which dispatch at once don't send it twice
+func (d *Dispatcher) Dispatch() (int, error) {
+	now := d.clock.Now()
+	messages, err := d.repo.GetDue(now.UnixMilli(), batchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, msg := range messages {
+		claimed := d.clock.Now()
+		ok, err := d.repo.Claim(msg.ID, claimed.UnixMilli(), claimed.Add(claimTime).UnixMilli())
+		if err != nil {
+			return sent, err
+		}
+		if !ok {
+			// another replica sends it
+			continue
+		}
+
+		msg.Attempts++
+		msg.LockedUntil = 0
+		if err := d.send(msg); err != nil {
+			msg.LastError = err.Error()
+			if d.config.MaxAttempts > 0 && msg.Attempts >= d.config.MaxAttempts {
+				msg.Status = data.OutboxFailed
+				log.Printf("WARN: %s message %d to %s is not sent after %d attempts: %v", msg.Event, msg.ID, msg.Recipient, msg.Attempts, err)
+			} else {
+				msg.Status = data.OutboxPending
+				msg.NextAttempt = now.Add(d.backoff(msg.Attempts)).UnixMilli()
+			}
+		} else {
+			msg.Status = data.OutboxSent
+			msg.SentAt = now.UnixMilli()
+			msg.LastError = ""
+			sent++
+		}
+
+		if err := d.repo.Update(msg); err != nil {
+			return sent, err
+		}
+	}
+
+	return sent, nil
+}
+
+func (d *Dispatcher) send(msg data.OutboxMessage) error {
+	payload := Payload{}
+	if err := json.Unmarshal([]byte(msg.Payload), &payload); err != nil {
+		return err
+	}
+	payload.URL = d.config.URL
+
+	m, err := Render(msg.Event, payload)
+	if err != nil {
+		return err
+	}
+	m.To = msg.Recipient
+
+	return d.notifier.Send(m)
+}
+
+// returns the delay after the number of failed attempts, it doubles after each of them
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	delay := time.Duration(d.config.Backoff) * time.Minute
+	for i := 1; i < attempts && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxBackoff {
+		delay = maxBackoff
+	}
+
+	return delay
+}
@@ -0,0 +1,17 @@
+package notify
+
+import (
+	"log"
+)
+
+// writes messages to the log instead of sending them, e.g. for development
+type logNotifier struct{}
+
+func NewLog() Notifier {
+	return logNotifier{}
+}
+
+func (logNotifier) Send(msg Message) error {
+	log.Printf("Notification to %s: %s\n%s", msg.To, msg.Subject, msg.Text)
+	return nil
+}
@@ -0,0 +1,102 @@
+package notify
+
+import (
+	"embed"
+	"fmt"
+	htemplate "html/template"
+	"strings"
+	ttemplate "text/template"
+)
+
+// events of reservations
+const (
+	EventBooked      = "booked"
+	EventCancelled   = "cancelled"
+	EventRescheduled = "rescheduled"
+	EventOffered     = "offered"  // the freed slot is offered to the waitlist
+	EventReminder    = "reminder" // the reservation starts soon
+)
+
+// channels of messages
+const (
+	ChannelSMTP = "smtp"
+	ChannelLog  = "log" // messages are written to the log
+)
+
+type Config struct {
+	Enabled     bool
+	Channel     string `default:"smtp"`
+	From        string // sender of emails, e.g. "Clinic <booking@clinic.example>"
+	URL         string // base of links in messages, server.url by default
+	SMTP        SMTPConfig
+	MaxAttempts int `yaml:"maxAttempts" default:"5"`
+	Backoff     int `default:"1"`  // in minutes, the delay doubles after each failed attempt
+	Interval    int `default:"10"` // in seconds between checks of the outbox
+}
+
+// message to the client
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// sends messages, e.g. by email
+type Notifier interface {
+	Send(msg Message) error
+}
+
+// returns the notifier of the configured channel
+func New(config Config) (Notifier, error) {
+	switch config.Channel {
+	case ChannelSMTP:
+		return NewSMTP(config.SMTP, config.From), nil
+	case ChannelLog:
+		return NewLog(), nil
+	}
+
+	return nil, fmt.Errorf("unknown channel %q, expected %s or %s", config.Channel, ChannelSMTP, ChannelLog)
+}
+
+// data of templates, dates are set in the wall clock of the doctor's time zone
+type Payload struct {
+	ClientName   string `json:"client_name"`
+	DoctorName   string `json:"doctor_name"`
+	Service      string `json:"service,omitempty"`
+	Date         string `json:"date"`
+	TimeZone     string `json:"timezone"`
+	PreviousDate string `json:"previous_date,omitempty"` // of the rescheduled reservation
+	Claim        string `json:"claim,omitempty"`         // path of the claim link of the offer
+	Expires      string `json:"expires,omitempty"`       // expiration of the offer
+	URL          string `json:"-"`                       // base of links, it is set on sending
+}
+
+//go:embed templates
+var files embed.FS
+
+// each event has text and HTML templates, the subject is defined in the text one as "<event>.subject"
+var (
+	textTemplates = ttemplate.Must(ttemplate.ParseFS(files, "templates/*.txt"))
+	htmlTemplates = htemplate.Must(htemplate.ParseFS(files, "templates/*.html"))
+)
+
+// renders the message of the event without the recipient
+func Render(event string, payload Payload) (Message, error) {
+	if textTemplates.Lookup(event+".txt") == nil || htmlTemplates.Lookup(event+".html") == nil {
+		return Message{}, fmt.Errorf("unknown event %q", event)
+	}
+
+	var subject, text, html strings.Builder
+	if err := textTemplates.ExecuteTemplate(&subject, event+".subject", payload); err != nil {
+		return Message{}, err
+	}
+	if err := textTemplates.ExecuteTemplate(&text, event+".txt", payload); err != nil {
+		return Message{}, err
+	}
+	if err := htmlTemplates.ExecuteTemplate(&html, event+".html", payload); err != nil {
+		return Message{}, err
+	}
+
+	return Message{Subject: strings.TrimSpace(subject.String()), Text: text.String(), HTML: html.String()}, nil
+}
@@ -0,0 +1,371 @@
+package notify
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"path/filepath"
+	"scheduler-booking/data"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// received email of the SMTP sink
+type email struct {
+	from string
+	to   []string
+	data string
+}
+
+// starts the local SMTP server which accepts all emails
+func startSink(t *testing.T) (SMTPConfig, <-chan email) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	emails := make(chan email, 10)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go serveSMTP(conn, emails)
+		}
+	}()
+
+	addr := l.Addr().(*net.TCPAddr)
+	return SMTPConfig{Host: addr.IP.String(), Port: addr.Port}, emails
+}
+
+func serveSMTP(conn net.Conn, emails chan<- email) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { fmt.Fprintf(conn, "%s\r\n", line) }
+
+	reply("220 sink ready")
+	msg := email{}
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		command := strings.ToUpper(line)
+
+		switch {
+		case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+			reply("250 sink")
+		case strings.HasPrefix(command, "MAIL FROM:"):
+			msg = email{from: strings.Trim(line[len("MAIL FROM:"):], "<>")}
+			reply("250 OK")
+		case strings.HasPrefix(command, "RCPT TO:"):
+			msg.to = append(msg.to, strings.Trim(line[len("RCPT TO:"):], "<>"))
+			reply("250 OK")
+		case command == "DATA":
+			reply("354 end data with <CR><LF>.<CR><LF>")
+			var body strings.Builder
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				body.WriteString(strings.TrimPrefix(line, "."))
+			}
+			msg.data = body.String()
+			emails <- msg
+			reply("250 OK")
+		case command == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	payload := Payload{
+		ClientName:   "Client <script>",
+		DoctorName:   "Dr. Render",
+		Service:      "Checkup",
+		Date:         "Mon, 07 Jan 2030 10:00",
+		TimeZone:     "Europe/Berlin",
+		PreviousDate: "Mon, 07 Jan 2030 09:00",
+		Claim:        "/waitlist/claim/token",
+		Expires:      "Mon, 07 Jan 2030 09:30",
+		URL:          "http://localhost:3000",
+	}
+
+	cases := []struct {
+		event    string
+		contains []string
+	}{
+		{EventBooked, []string{"Dr. Render", "Checkup", "Mon, 07 Jan 2030 10:00"}},
+		{EventCancelled, []string{"Dr. Render", "Mon, 07 Jan 2030 10:00"}},
+		{EventRescheduled, []string{"Mon, 07 Jan 2030 09:00", "Mon, 07 Jan 2030 10:00"}},
+		{EventOffered, []string{"Mon, 07 Jan 2030 09:30", "http://localhost:3000/waitlist/claim/token"}},
+		{EventReminder, []string{"Dr. Render", "Checkup", "Mon, 07 Jan 2030 10:00"}},
+	}
+	for _, c := range cases {
+		msg, err := Render(c.event, payload)
+		if err != nil {
+			t.Fatalf("%s: %v", c.event, err)
+		}
+		if msg.Subject == "" || strings.Contains(msg.Subject, "\n") {
+			t.Fatalf("%s: invalid subject %q", c.event, msg.Subject)
+		}
+		for _, s := range c.contains {
+			if !strings.Contains(msg.Text, s) || !strings.Contains(msg.HTML, s) {
+				t.Fatalf("%s: expected %q in\n%s\n%s", c.event, s, msg.Text, msg.HTML)
+			}
+		}
+		if strings.Contains(msg.HTML, "<script>") {
+			t.Fatalf("%s: expected escaped HTML, got %s", c.event, msg.HTML)
+		}
+	}
+
+	if _, err := Render("unknown", payload); err == nil {
+		t.Fatal("expected the error of the unknown event")
+	}
+}
+
+func TestSMTP(t *testing.T) {
+	config, emails := startSink(t)
+	n := NewSMTP(config, "Clinic <booking@scheduler.booking>")
+
+	err := n.Send(Message{To: "client@scheduler.booking", Subject: "Appointment — confirmed", Text: "Hello, Client", HTML: "<p>Hello, Client</p>"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var e email
+	select {
+	case e = <-emails:
+	case <-time.After(5 * time.Second):
+		t.Fatal("email is not received")
+	}
+	if e.from != "booking@scheduler.booking" || len(e.to) != 1 || e.to[0] != "client@scheduler.booking" {
+		t.Fatalf("invalid envelope %+v", e)
+	}
+
+	msg, err := mail.ReadMessage(strings.NewReader(e.data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil || subject != "Appointment — confirmed" {
+		t.Fatalf("invalid subject %q (%v)", subject, err)
+	}
+
+	_, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := multipart.NewReader(msg.Body, params["boundary"])
+	for _, expected := range []string{"Hello, Client", "<p>Hello, Client</p>"} {
+		part, err := parts.NextPart()
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(part)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(body) != expected {
+			t.Fatalf("expected %q, got %q", expected, body)
+		}
+	}
+
+	if err := n.Send(Message{To: "invalid"}); err == nil {
+		t.Fatal("expected the error of the invalid recipient")
+	}
+}
+
+func TestSMTPTimeout(t *testing.T) {
+	// the server accepts connections and never replies
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		conns := make([]net.Conn, 0)
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				break
+			}
+			conns = append(conns, conn)
+		}
+		for _, conn := range conns {
+			conn.Close()
+		}
+	}()
+
+	addr := l.Addr().(*net.TCPAddr)
+	n := NewSMTP(SMTPConfig{Host: addr.IP.String(), Port: addr.Port, Timeout: 1}, "Clinic <booking@scheduler.booking>")
+
+	start := time.Now()
+	if err := n.Send(Message{To: "client@scheduler.booking", Text: "Hello"}); err == nil {
+		t.Fatal("expected the timeout error")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("expected the send to stop after the timeout, took %v", elapsed)
+	}
+}
+
+// fails the configured number of sends
+type flakyNotifier struct {
+	failures int
+	sent     []Message
+}
+
+func (n *flakyNotifier) Send(msg Message) error {
+	if n.failures > 0 {
+		n.failures--
+		return errors.New("connection refused")
+	}
+	n.sent = append(n.sent, msg)
+	return nil
+}
+
+func TestDispatcher(t *testing.T) {
+	now := time.Date(2030, 1, 7, 8, 0, 0, 0, time.UTC)
+	repo := data.NewMemory(func() time.Time { return now })
+
+	config := Config{URL: "http://localhost:3000", MaxAttempts: 3, Backoff: 1}
+	notifier := &flakyNotifier{failures: 1}
+	d := NewDispatcher(repo, notifier, config)
+
+	add := func(recipient string) int {
+		id, err := repo.Outbox.Add(&data.OutboxMessage{
+			Event:       EventOffered,
+			Recipient:   recipient,
+			Payload:     `{"client_name":"Client","doctor_name":"Dr. Outbox","date":"Mon, 07 Jan 2030 10:00","claim":"/waitlist/claim/token"}`,
+			Status:      data.OutboxPending,
+			NextAttempt: now.UnixMilli(),
+			CreatedAt:   now.UnixMilli(),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+	dispatch := func(expected int) {
+		t.Helper()
+		if count, err := d.Dispatch(); err != nil || count != expected {
+			t.Fatalf("expected %d sent messages, got %d (%v)", expected, count, err)
+		}
+	}
+
+	// the failed message is retried after the delay
+	add("client@scheduler.booking")
+	dispatch(0)
+	dispatch(0)
+	now = now.Add(time.Minute)
+	dispatch(1)
+	if len(notifier.sent) != 1 || notifier.sent[0].To != "client@scheduler.booking" || !strings.Contains(notifier.sent[0].Text, "http://localhost:3000/waitlist/claim/token") {
+		t.Fatalf("invalid sent messages %+v", notifier.sent)
+	}
+	dispatch(0)
+
+	// the delay doubles and the message fails after the last attempt
+	notifier.failures = 3
+	add("failed@scheduler.booking")
+	dispatch(0)
+	now = now.Add(time.Minute)
+	dispatch(0)
+	now = now.Add(time.Minute)
+	dispatch(0) // the second delay is 2 minutes
+	now = now.Add(time.Minute)
+	dispatch(0)
+	if due, err := repo.Outbox.GetDue(now.Add(24*time.Hour).UnixMilli(), 10); err != nil || len(due) != 0 {
+		t.Fatalf("expected the failed message, got %+v (%v)", due, err)
+	}
+	if notifier.failures != 0 {
+		t.Fatalf("expected 3 attempts, %d failures are left", notifier.failures)
+	}
+}
+
+// counts sent messages of recipients
+type countingNotifier struct {
+	mu   sync.Mutex
+	sent map[string]int
+}
+
+func (n *countingNotifier) Send(msg Message) error {
+	// slow sends let replicas dispatch at once
+	time.Sleep(time.Millisecond)
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.sent[msg.To]++
+	return nil
+}
+
+func TestConcurrentDispatchers(t *testing.T) {
+	// replicas share the database
+	path := filepath.Join(t.TempDir(), "db.sqlite")
+	replicas := []data.Repositories{
+		data.NewDAO(data.DBConfig{Path: path}).Repositories,
+		data.NewDAO(data.DBConfig{Path: path}).Repositories,
+	}
+
+	now := time.Now().UnixMilli()
+	for i := 0; i < 20; i++ {
+		_, err := replicas[0].Outbox.Add(&data.OutboxMessage{
+			Event:       EventCancelled,
+			Recipient:   fmt.Sprintf("client%d@scheduler.booking", i),
+			Payload:     `{"client_name":"Client","doctor_name":"Dr. Outbox","date":"Mon, 07 Jan 2030 10:00"}`,
+			Status:      data.OutboxPending,
+			NextAttempt: now,
+			CreatedAt:   now,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	notifier := &countingNotifier{sent: make(map[string]int)}
+	counts := make(chan int, len(replicas))
+	var wg sync.WaitGroup
+	for _, repo := range replicas {
+		wg.Add(1)
+		go func(d *Dispatcher) {
+			defer wg.Done()
+			count, err := d.Dispatch()
+			if err != nil {
+				t.Error(err)
+			}
+			counts <- count
+		}(NewDispatcher(repo, notifier, Config{MaxAttempts: 3, Backoff: 1}))
+	}
+	wg.Wait()
+	close(counts)
+
+	total := 0
+	for count := range counts {
+		total += count
+	}
+	if total != 20 || len(notifier.sent) != 20 {
+		t.Fatalf("expected 20 sent messages, got %d to %d recipients", total, len(notifier.sent))
+	}
+	for recipient, count := range notifier.sent {
+		if count != 1 {
+			t.Fatalf("expected one message to %s, got %d", recipient, count)
+		}
+	}
+}
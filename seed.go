@@ -0,0 +1,44 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"scheduler-booking/data"
+	"scheduler-booking/seed"
+)
+
+// runs the seed subcommand and returns the exit code
+func seedData(args []string) int {
+	opts := Config.Demo
+
+	flags := flag.NewFlagSet("seed", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: scheduler-booking seed [options]\n\nreplaces all data with demo data\n\noptions:")
+		flags.PrintDefaults()
+	}
+	flags.IntVar(&opts.Doctors, "doctors", opts.Doctors, "number of doctors")
+	flags.IntVar(&opts.Days, "days", opts.Days, "span of reservations in days from today")
+	flags.Int64Var(&opts.Seed, "seed", opts.Seed, "seed of random data, 0 for a random seed")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() > 0 {
+		flags.Usage()
+		return 2
+	}
+
+	if Config.Mode != ModeDemo {
+		fmt.Fprintf(os.Stderr, "seed is available in %s mode only\n", ModeDemo)
+		return 1
+	}
+
+	dao := data.NewDAO(Config.DB)
+	if err := seed.Run(dao, opts); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	fmt.Printf("seeded %d doctors\n", opts.Doctors)
+	return 0
+}
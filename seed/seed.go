@@ -0,0 +1,376 @@
+package seed
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"scheduler-booking/data"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type Options struct {
+	Doctors int   `default:"5"`
+	Days    int   `default:"14"` // span of generated reservations from today
+	Seed    int64 // seed of random data, 0 for a random seed
+}
+
+func (o Options) validate() error {
+	if o.Doctors < 1 {
+		return errors.New("number of doctors must be positive")
+	}
+	if o.Days < 1 {
+		return errors.New("number of days must be positive")
+	}
+
+	return nil
+}
+
+// deletes all data and generates demo doctors, schedules, reservations and reviews,
+// dates of data are relative to the clock of the DAO
+func Run(dao *data.DAO, opts Options) error {
+	if err := opts.validate(); err != nil {
+		return err
+	}
+	if opts.Seed == 0 {
+		opts.Seed = time.Now().UnixNano()
+	}
+
+	return dao.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := Clear(tx); err != nil {
+			return err
+		}
+		return generate(tx, dao.Clock, opts)
+	})
+}
+
+// deletes all data
+func Clear(tx *gorm.DB) error {
+	tx = tx.Session(&gorm.Session{AllowGlobalUpdate: true})
+	for _, model := range []interface{}{&data.Doctor{}, &data.Review{}, &data.ReviewTotal{}, &data.DoctorSchedule{}, &data.OccupiedSlot{}, &data.ReservationLog{}, &data.Closure{}, &data.TimeOff{}, &data.ServiceType{}, &data.WaitlistEntry{}, &data.OutboxMessage{}, &data.Reminder{}} {
+		if err := tx.Delete(model).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+var (
+	firstNames = []string{
+		"Emma",
+		"Olivia",
+		"James",
+		"Mia",
+		"Amelia",
+		"Alexander",
+		"Harper",
+		"William",
+		"Abigail",
+		"Lily",
+	}
+
+	lastNames = []string{
+		"Johnson",
+		"Smith",
+		"Brown",
+		"Wilson",
+		"Jackson",
+		"King",
+		"Scott",
+		"Green",
+		"Adams",
+		"Baker",
+	}
+
+	comments = []string{
+		"Very attentive and friendly doctor.",
+		"Everything was explained clearly.",
+		"Had to wait a bit, but the consultation was great.",
+		"Professional and polite.",
+		"",
+	}
+)
+
+const (
+	nameFormat  = "%s %s"
+	emailFormat = "%s.%s@scheduler.booking"
+)
+
+// weekly working hours
+type block struct {
+	days string // "MO,TU"
+	from int    // in minutes
+	to   int    // in minutes, can be greater than 24 hours
+}
+
+// one-time working hours on the days from the next weekday
+type routine struct {
+	weekday time.Weekday
+	from    int // in minutes
+	to      int // in minutes
+	days    int
+}
+
+type profile struct {
+	doctor   data.Doctor
+	blocks   []block
+	routines []routine
+	stars    []int // stars of past reviews
+}
+
+var profiles = []profile{
+	{
+		doctor: data.Doctor{
+			Name:     "Dr. Conrad Hubbard",
+			Category: "Psychiatrist",
+			Subtitle: "2 years of experience",
+			Details:  "Desert Springs Hospital (Schroeders Avenue 90, Fannett, Ethiopia)",
+			SlotSize: 20,
+			Price:    "$45",
+			ImageURL: "https://snippet.dhtmlx.com/codebase/data/booking/01/img/11.jpg",
+			Gap:      20,
+		},
+		// every week day 9:00-17:00 (except sun, sat - holidays)
+		blocks: []block{{"MO,TU,WE,TH,FR", 9 * 60, 17 * 60}},
+		// next tue, wed, thu 2:00-6:00
+		routines: []routine{{time.Tuesday, 2 * 60, 6 * 60, 3}},
+		stars:    []int{5, 4, 4, 3, 5, 4},
+	},
+	{
+		doctor: data.Doctor{
+			Name:     "Dr. Debra Weeks",
+			Category: "Allergist",
+			Subtitle: "7 years of experience",
+			Details:  "Silverstone Medical Center (Vanderbilt Avenue 13, Chestnut, New Zealand)",
+			SlotSize: 45,
+			Price:    "$120",
+			ImageURL: "https://snippet.dhtmlx.com/codebase/data/booking/01/img/03.jpg",
+			Gap:      5,
+		},
+		blocks: []block{
+			{"MO,WE", 7 * 60, 15 * 60},  // mon, wed 7:00-15:00
+			{"TU,TH", 12 * 60, 20 * 60}, // tue, thu 12:00-20:00
+			{"SA", 20 * 60, 28 * 60},    // sat-sun 20:00-4:00
+		},
+		// next wed 18:00-22:00
+		routines: []routine{{time.Wednesday, 18 * 60, 22 * 60, 1}},
+		stars:    []int{4, 5, 4, 4, 3},
+	},
+	{
+		doctor: data.Doctor{
+			Name:     "Dr. Barnett Mueller",
+			Category: "Ophthalmologist",
+			Subtitle: "6 years of experience",
+			Details:  "Navy Street 1, Kiskimere, United States",
+			SlotSize: 25,
+			Price:    "$35",
+			ImageURL: "https://snippet.dhtmlx.com/codebase/data/booking/01/img/02.jpg",
+			Gap:      0,
+		},
+		blocks: []block{
+			{"MO,WE,FR", 9 * 60, 17 * 60}, // mon, wed, fri 9:00-17:00
+			{"SA,SU", 15 * 60, 19 * 60},   // sat, sun 15:00-19:00
+		},
+		stars: []int{3, 2, 4, 3},
+	},
+	{
+		doctor: data.Doctor{
+			Name:     "Dr. Myrtle Wise",
+			Category: "Ophthalmologist",
+			Subtitle: "4 years of experience",
+			Details:  "Prescott Place 5, Freeburn, Bulgaria",
+			SlotSize: 25,
+			Price:    "$40",
+			ImageURL: "https://snippet.dhtmlx.com/codebase/data/booking/01/img/01.jpg",
+			Gap:      5,
+		},
+		blocks: []block{
+			{"TU,TH", 7 * 60, 15 * 60},  // tue, thu 7:00-15:00
+			{"SA,SU", 11 * 60, 15 * 60}, // sat, sun 11:00-15:00
+		},
+		// next fri, sat 4:00-8:00
+		routines: []routine{{time.Friday, 4 * 60, 8 * 60, 2}},
+		stars:    []int{5, 5, 4, 5},
+	},
+	{
+		doctor: data.Doctor{
+			Name:     "Dr. Browning Peck",
+			Category: "Dentist",
+			Subtitle: "11 years of experience",
+			SlotSize: 60,
+			Details:  "Seacoast Terrace 174, Belvoir, Mauritania",
+			Price:    "$175",
+			ImageURL: "https://snippet.dhtmlx.com/codebase/data/booking/01/img/12.jpg",
+			Gap:      10,
+		},
+		// thu, fri, sat, sun 9:00-17:00
+		blocks: []block{{"TH,FR,SA,SU", 9 * 60, 17 * 60}},
+		stars:  []int{5, 5, 5, 4, 5},
+	},
+}
+
+var weekdays = map[string]time.Weekday{
+	"SU": time.Sunday,
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+}
+
+type generator struct {
+	rnd   *rand.Rand
+	now   time.Time
+	today time.Time // date only
+}
+
+func generate(tx *gorm.DB, clock data.Clock, opts Options) error {
+	g := generator{rnd: rand.New(rand.NewSource(opts.Seed)), now: clock.Now(), today: clock.Today()}
+
+	for i := 0; i < opts.Doctors; i++ {
+		p := profiles[i%len(profiles)]
+		doctor := p.doctor
+		if i >= len(profiles) {
+			// more doctors of the same profiles
+			doctor.Name = "Dr. " + g.name()
+			p.stars = g.stars()
+		}
+
+		for _, b := range p.blocks {
+			doctor.DoctorSchedule = append(doctor.DoctorSchedule, data.DoctorSchedule{
+				From:     b.from,
+				To:       b.to,
+				Date:     g.today.UnixMilli(),
+				Rrule:    "INTERVAL=1;FREQ=WEEKLY;BYDAY=" + b.days,
+				Duration: (b.to - b.from) * 60,
+			})
+		}
+		for _, r := range p.routines {
+			start := g.nextWeekDay(r.weekday)
+			for d := 0; d < r.days; d++ {
+				doctor.DoctorSchedule = append(doctor.DoctorSchedule, data.DoctorSchedule{
+					From: r.from,
+					To:   r.to,
+					Date: start.AddDate(0, 0, d).UnixMilli(),
+				})
+			}
+		}
+		doctor.OccupiedSlots = g.reservations(doctor, p, opts.Days)
+
+		if err := tx.Create(&doctor).Error; err != nil {
+			return err
+		}
+		if err := g.reviews(tx, doctor, p.stars); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// reservations in the working hours of the next days
+func (g *generator) reservations(doctor data.Doctor, p profile, days int) []data.OccupiedSlot {
+	routines := make(map[int64][]block)
+	for _, r := range p.routines {
+		start := g.nextWeekDay(r.weekday)
+		for d := 0; d < r.days; d++ {
+			day := start.AddDate(0, 0, d).UnixMilli()
+			routines[day] = append(routines[day], block{from: r.from, to: r.to})
+		}
+	}
+
+	now := g.now.UnixMilli()
+	used := make(map[int64]bool)
+	slots := make([]data.OccupiedSlot, 0)
+	for d := 0; d < days; d++ {
+		date := g.today.AddDate(0, 0, d)
+
+		blocks := append([]block{}, routines[date.UnixMilli()]...)
+		for _, b := range p.blocks {
+			for _, day := range strings.Split(b.days, ",") {
+				if weekdays[day] == date.Weekday() {
+					blocks = append(blocks, b)
+				}
+			}
+		}
+
+		for _, b := range blocks {
+			count := (b.to - b.from + doctor.Gap) / (doctor.SlotSize + doctor.Gap)
+			if count < 1 || g.rnd.Intn(2) == 0 {
+				continue
+			}
+
+			start := b.from + g.rnd.Intn(count)*(doctor.SlotSize+doctor.Gap)
+			slot := g.slot(date.UnixMilli(), start)
+			if slot.Date <= now || used[slot.Date] {
+				continue
+			}
+
+			used[slot.Date] = true
+			slots = append(slots, slot)
+		}
+	}
+
+	return slots
+}
+
+// past appointments with reviews
+func (g *generator) reviews(tx *gorm.DB, doctor data.Doctor, stars []int) error {
+	for j, s := range stars {
+		date := g.today.AddDate(0, 0, -7*(j+1)).UnixMilli()
+
+		slot := g.slot(date, 10*60) // 10:00 of the past weeks
+		slot.DoctorID = doctor.ID
+		if err := tx.Create(&slot).Error; err != nil {
+			return err
+		}
+
+		review := data.Review{
+			DoctorID:      doctor.ID,
+			ReservationID: slot.ID,
+			Stars:         s,
+			Comment:       comments[g.rnd.Intn(len(comments))],
+			ClientName:    slot.ClientName,
+			CreatedAt:     date + 24*60*60*1000,
+		}
+		if err := tx.Create(&review).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (g *generator) slot(date int64, minutes int) data.OccupiedSlot {
+	first := firstNames[g.rnd.Intn(len(firstNames))]
+	last := lastNames[g.rnd.Intn(len(lastNames))]
+
+	return data.OccupiedSlot{
+		Date:        date + int64(minutes)*60*1000,
+		ClientName:  fmt.Sprintf(nameFormat, first, last),
+		ClientEmail: fmt.Sprintf(emailFormat, strings.ToLower(first), strings.ToLower(last)),
+	}
+}
+
+func (g *generator) name() string {
+	return fmt.Sprintf(nameFormat, firstNames[g.rnd.Intn(len(firstNames))], lastNames[g.rnd.Intn(len(lastNames))])
+}
+
+func (g *generator) stars() []int {
+	stars := make([]int, 3+g.rnd.Intn(4))
+	for i := range stars {
+		stars[i] = 3 + g.rnd.Intn(3)
+	}
+
+	return stars
+}
+
+// returns the date of the next weekday, today is included
+func (g *generator) nextWeekDay(day time.Weekday) time.Time {
+	next := (7 + int(day) - int(g.today.Weekday())) % 7
+	return g.today.AddDate(0, 0, next)
+}
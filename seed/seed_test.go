@@ -0,0 +1,72 @@
+package seed
+
+import (
+	"path/filepath"
+	"scheduler-booking/data"
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	dao := data.NewDAO(data.DBConfig{Path: filepath.Join(t.TempDir(), "db.sqlite")})
+	db := dao.GetDB()
+
+	slots := func() []data.OccupiedSlot {
+		out := make([]data.OccupiedSlot, 0)
+		if err := db.Order("id").Find(&out).Error; err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+
+	opts := Options{Doctors: 7, Days: 14, Seed: 42}
+	if err := Run(dao, opts); err != nil {
+		t.Fatal(err)
+	}
+	first := slots()
+
+	doctors, err := dao.Doctors.GetAll()
+	if err != nil || len(doctors) != 7 {
+		t.Fatalf("expected 7 doctors, got %d (%v)", len(doctors), err)
+	}
+
+	summaries, err := dao.Reviews.GetSummaries()
+	if err != nil || len(summaries) != 7 {
+		t.Fatalf("expected reviews of 7 doctors, got %d (%v)", len(summaries), err)
+	}
+
+	now := data.SystemClock.Now().UnixMilli()
+	end := data.SystemClock.Today().AddDate(0, 0, 15).UnixMilli() // the last day can end on the next one
+	upcoming := 0
+	for _, slot := range first {
+		if slot.Date > now {
+			upcoming++
+			if slot.Date >= end {
+				t.Fatalf("reservation %s is after the span", time.UnixMilli(slot.Date).UTC())
+			}
+		}
+	}
+	if upcoming == 0 {
+		t.Fatal("expected upcoming reservations")
+	}
+
+	// the same seed gives the same data, the previous data is deleted
+	if err := Run(dao, opts); err != nil {
+		t.Fatal(err)
+	}
+	second := slots()
+	if len(first) != len(second) {
+		t.Fatalf("expected %d reservations, got %d", len(first), len(second))
+	}
+	for i := range first {
+		if first[i].Date != second[i].Date || first[i].ClientName != second[i].ClientName {
+			t.Fatalf("expected the same reservations, got %+v and %+v", first[i], second[i])
+		}
+	}
+
+	for _, opts := range []Options{{Doctors: 0, Days: 14}, {Doctors: 5, Days: 0}} {
+		if err := Run(dao, opts); err == nil {
+			t.Fatalf("expected an error for %+v", opts)
+		}
+	}
+}
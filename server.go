@@ -4,10 +4,15 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"os"
 	"scheduler-booking/api"
 	"scheduler-booking/data"
+	"scheduler-booking/jobs"
+	"scheduler-booking/notify"
+	"scheduler-booking/seed"
 	"scheduler-booking/service"
 	"time"
+	_ "time/tzdata" // time zones of doctors without system tzdata
 
 	"github.com/go-chi/chi"
 	"github.com/go-chi/chi/middleware"
@@ -20,6 +25,19 @@ var Config AppConfig
 func main() {
 	configor.New(&configor.Config{ENVPrefix: "APP", Silent: true}).Load(&Config, "config.yml")
 
+	if err := Config.validate(); err != nil {
+		log.Fatal(err)
+	}
+
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "migrate":
+			os.Exit(migrate(os.Args[2:]))
+		case "seed":
+			os.Exit(seedData(os.Args[2:]))
+		}
+	}
+
 	r := chi.NewRouter()
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
@@ -29,7 +47,7 @@ func main() {
 		c := cors.New(cors.Options{
 			AllowedOrigins:   Config.Server.Cors,
 			AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-			AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "Remote-Token", "X-Requested-With"},
+			AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "Remote-Token", "X-Requested-With", "X-Actor", "X-API-Key"},
 			AllowCredentials: true,
 			MaxAge:           300,
 		})
@@ -37,33 +55,107 @@ func main() {
 	}
 
 	dao := data.NewDAO(Config.DB)
-	service := service.NewService(dao)
-	api := api.NewAPI(service)
+	if Config.DB.ResetOnStart {
+		resetData(dao)
+	}
+	Config.Booking.Notify = Config.Notify.Enabled
+	service := service.NewService(dao.Repositories, Config.Booking)
+	api := api.NewAPI(service, Config.Auth)
 
 	api.InitRoutes(r)
 
-	if Config.Server.ResetFrequence > 0 {
-		go func() {
-			now := time.Now().UTC()
-			freq := time.Duration(Config.Server.ResetFrequence) * time.Minute
+	runner := jobs.NewRunner(dao.Repositories)
+	addJobs(runner, dao, service)
+	runner.Start()
 
-			next := now.Truncate(freq).Add(freq).Sub(now)
-			time.Sleep(next)
+	log.Printf("Starting webserver at port " + Config.Server.Port)
+	err := http.ListenAndServe(Config.Server.Port, r)
+	if err != nil {
+		log.Println(err.Error())
+	}
+}
 
-			log.Println("Reset data...")
-			dao.RestartData()
+// replaces data with demo data
+func resetData(dao *data.DAO) {
+	log.Println("Reset data...")
+	if err := seed.Run(dao, Config.Demo); err != nil {
+		log.Printf("ERROR: reset of data: %v", err)
+	}
+}
 
-			ticker := time.NewTicker(freq)
-			for range ticker.C {
-				log.Println("Reset data...")
-				dao.RestartData()
+// adds background jobs of the server, each job runs on one replica at a time
+func addJobs(runner *jobs.Runner, dao *data.DAO, s *service.ServiceAll) {
+	if Config.Server.ResetFrequence > 0 {
+		runner.Add(jobs.Job{
+			Name:     "reset data",
+			Interval: time.Duration(Config.Server.ResetFrequence) * time.Minute,
+			Aligned:  true,
+			Run: func() error {
+				resetData(dao)
+				return nil
+			},
+		})
+	}
+
+	runner.Add(jobs.Job{
+		Name:     "expired holds",
+		Interval: time.Minute,
+		Run: func() error {
+			// slots of expired offers go to the next patients of the waitlist before holds are deleted
+			if count, err := s.Waitlist.ExpireOffers(); err != nil {
+				return err
+			} else if count > 0 {
+				log.Printf("Expired %d waitlist offers", count)
+			}
+			if count, err := s.Waitlist.ExpireWaiting(); err != nil {
+				return err
+			} else if count > 0 {
+				log.Printf("Closed %d waitlist entries of past times", count)
 			}
-		}()
+
+			count, err := s.Reservations.DeleteExpiredHolds()
+			if err != nil {
+				return err
+			} else if count > 0 {
+				log.Printf("Deleted %d expired holds", count)
+			}
+			return nil
+		},
+	})
+
+	if !Config.Notify.Enabled {
+		return
 	}
 
-	log.Printf("Starting webserver at port " + Config.Server.Port)
-	err := http.ListenAndServe(Config.Server.Port, r)
+	if Config.Notify.URL == "" {
+		Config.Notify.URL = Config.Server.URL
+	}
+	notifier, err := notify.New(Config.Notify)
 	if err != nil {
-		log.Println(err.Error())
+		log.Fatal(err)
 	}
+	dispatcher := notify.NewDispatcher(dao.Repositories, notifier, Config.Notify)
+
+	runner.Add(jobs.Job{
+		Name:     "reminders",
+		Interval: time.Minute,
+		Run: func() error {
+			count, err := s.Reminders.Send()
+			if err == nil && count > 0 {
+				log.Printf("Queued %d reminders", count)
+			}
+			return err
+		},
+	})
+	runner.Add(jobs.Job{
+		Name:     "notifications",
+		Interval: time.Duration(Config.Notify.Interval) * time.Second,
+		Run: func() error {
+			count, err := dispatcher.Dispatch()
+			if count > 0 {
+				log.Printf("Sent %d notifications", count)
+			}
+			return err
+		},
+	})
 }
@@ -0,0 +1,157 @@
+package service
+
+import (
+	"scheduler-booking/common"
+	"scheduler-booking/data"
+	"strings"
+	"time"
+)
+
+type closuresService struct {
+	repo   data.Repositories
+	config Config
+	clock  data.Clock
+}
+
+// closure is set in the wall clock and applied in the time zone of each doctor
+type ClosureForm struct {
+	StartDate *common.JDate `json:"start_date"`
+	EndDate   *common.JDate `json:"end_date"`
+	Location  string        `json:"location"` // (optional) clinic location of doctors, all doctors by default
+	Category  string        `json:"category"` // (optional) category of doctors, all doctors by default
+	Reason    string        `json:"reason"`
+}
+
+type ClosureStr struct {
+	ID        int    `json:"id"`
+	StartDate string `json:"start_date"`
+	EndDate   string `json:"end_date"`
+	Location  string `json:"location,omitempty"`
+	Category  string `json:"category,omitempty"`
+	Reason    string `json:"reason"`
+}
+
+// returns closures which overlap the [from, to) interval,
+// the default interval is set by the config
+func (s *closuresService) GetAll(from, to int64) ([]ClosureStr, error) {
+	window, err := s.config.window(s.clock, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	closures, err := s.repo.Closures.GetAll(window)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]ClosureStr, 0, len(closures))
+	for _, c := range closures {
+		out = append(out, ClosureStr{
+			ID:        c.ID,
+			StartDate: time.UnixMilli(c.StartDate).UTC().Format(strFormat),
+			EndDate:   time.UnixMilli(c.EndDate).UTC().Format(strFormat),
+			Location:  c.Location,
+			Category:  c.Category,
+			Reason:    c.Reason,
+		})
+	}
+
+	return out, nil
+}
+
+func (s *closuresService) Add(form ClosureForm) (int, error) {
+	if err := form.validate(); err != nil {
+		return 0, err
+	}
+
+	closure := form.toClosure()
+	return s.repo.Closures.Add(&closure)
+}
+
+func (s *closuresService) Update(id int, form ClosureForm) error {
+	if _, err := s.GetOne(id); err != nil {
+		return err
+	}
+
+	if err := form.validate(); err != nil {
+		return err
+	}
+
+	closure := form.toClosure()
+	closure.ID = id
+	return s.repo.Closures.Update(closure)
+}
+
+func (s *closuresService) Delete(id int) error {
+	if _, err := s.GetOne(id); err != nil {
+		return err
+	}
+
+	return s.repo.Closures.Delete(id)
+}
+
+func (s *closuresService) GetOne(id int) (data.Closure, error) {
+	closure, err := s.repo.Closures.GetOne(id)
+	if err != nil {
+		return closure, err
+	}
+	if closure.ID == 0 {
+		return closure, notFound("closure_not_found", "closure with id %d not found", id)
+	}
+
+	return closure, nil
+}
+
+func (f *ClosureForm) validate() error {
+	if f.StartDate == nil || f.EndDate == nil {
+		return invalidField("start_date", "start and end dates are required")
+	}
+
+	f.Location = strings.TrimSpace(f.Location)
+	f.Category = strings.TrimSpace(f.Category)
+	f.Reason = strings.TrimSpace(f.Reason)
+
+	fields := make([]FieldError, 0)
+	if f.StartDate.UnixMilli() >= f.EndDate.UnixMilli() {
+		fields = append(fields, FieldError{Field: "end_date", Message: "invalid time interval"})
+	}
+
+	return invalid(fields...)
+}
+
+func (f ClosureForm) toClosure() data.Closure {
+	return data.Closure{
+		StartDate: f.StartDate.UnixMilli(),
+		EndDate:   f.EndDate.UnixMilli(),
+		Location:  f.Location,
+		Category:  f.Category,
+		Reason:    f.Reason,
+	}
+}
+
+// returns closures applied to the doctor
+func closuresOf(doctor data.Doctor, closures []data.Closure) []data.Closure {
+	out := make([]data.Closure, 0)
+	for _, c := range closures {
+		if c.Location != "" && !strings.EqualFold(c.Location, doctor.Site) {
+			continue
+		}
+		if c.Category != "" && !strings.EqualFold(c.Category, doctor.Category) {
+			continue
+		}
+		out = append(out, c)
+	}
+
+	return out
+}
+
+// returns the closure which overlaps the slot starting at the time (wall clock), nil if there is no such closure
+func closureAt(closures []data.Closure, wall int64, size int) *data.Closure {
+	for i, c := range closures {
+		if (absence{c.StartDate, c.EndDate}).overlaps(wall, size) {
+			return &closures[i]
+		}
+	}
+
+	return nil
+}
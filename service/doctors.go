@@ -1,14 +1,188 @@
 package service
 
 import (
+	"fmt"
+	"regexp"
 	"scheduler-booking/data"
+	"scheduler-booking/notify"
+	"strings"
 )
 
+// returned when the doctor can't be deleted because of upcoming reservations
+var ErrDoctorHasReservations = &Error{
+	Kind:    KindConflict,
+	Code:    "doctor_has_reservations",
+	Message: data.ErrDoctorHasReservations.Error(),
+	Err:     data.ErrDoctorHasReservations,
+}
+
 type doctorsService struct {
-	dao *data.DAO
+	repo         data.Repositories
+	reservations *reservationsService
+}
+
+type DoctorForm struct {
+	Name     string `json:"name"`
+	Subtitle string `json:"subtitle"`
+	Details  string `json:"details"`
+	Category string `json:"category"`
+	Price    string `json:"price"`
+	Gap      int    `json:"gap"`       // in minutes
+	SlotSize int    `json:"slot_size"` // in minutes
+	TimeZone string `json:"timezone"`
+	Location string `json:"location"` // (optional) clinic location
+	Preview  string `json:"preview"`
+
+	// booking policy, 0 means no limit
+	MinNotice     int `json:"min_notice"`      // in minutes before the start of the slot
+	MaxAdvance    int `json:"max_advance"`     // in days from now
+	SameDayCutoff int `json:"same_day_cutoff"` // in minutes of the day, same-day bookings are closed after it
+}
+
+type DoctorDetails struct {
+	data.Doctor
+	Review data.ReviewSummary `json:"review"`
 }
 
+var priceFormat = regexp.MustCompile(`^\$?\d+(\.\d{1,2})?$`)
+
 func (s *doctorsService) GetDoctorsList() ([]data.Doctor, error) {
-	doctors, err := s.dao.Doctors.GetAll(false)
+	doctors, err := s.repo.Doctors.GetAll()
 	return doctors, err
 }
+
+// returns the doctor with the review summary
+func (s *doctorsService) GetOne(id int) (DoctorDetails, error) {
+	doctor, err := s.repo.Doctors.GetOne(id)
+	if err != nil {
+		return DoctorDetails{}, err
+	}
+	if doctor.ID == 0 {
+		return DoctorDetails{}, doctorNotFound(id)
+	}
+
+	summaries, err := s.repo.Reviews.GetSummaries()
+	if err != nil {
+		return DoctorDetails{}, err
+	}
+
+	return DoctorDetails{Doctor: doctor, Review: summaries[id]}, nil
+}
+
+func (s *doctorsService) Add(form DoctorForm) (int, error) {
+	if err := form.validate(); err != nil {
+		return 0, err
+	}
+
+	doctor := form.toDoctor()
+	return s.repo.Doctors.Add(&doctor)
+}
+
+func (s *doctorsService) Update(id int, form DoctorForm) error {
+	doctor, err := s.repo.Doctors.GetOne(id)
+	if err != nil {
+		return err
+	}
+	if doctor.ID == 0 {
+		return doctorNotFound(id)
+	}
+
+	if err := form.validate(); err != nil {
+		return err
+	}
+
+	doctor = form.toDoctor()
+	doctor.ID = id
+	return s.repo.Doctors.Update(doctor)
+}
+
+// deletes the doctor with schedules, upcoming reservations are deleted only if force is set,
+// their clients get cancellation messages
+func (s *doctorsService) Delete(id int, force bool, actor string) error {
+	doctor, err := s.repo.Doctors.GetOne(id)
+	if err != nil {
+		return err
+	}
+	if doctor.ID == 0 {
+		return doctorNotFound(id)
+	}
+
+	var messages []data.OutboxMessage
+	if force {
+		slots, err := s.repo.OccupiedSlots.GetAll()
+		if err != nil {
+			return err
+		}
+		now := s.reservations.clock.Now().UnixMilli()
+		for _, slot := range slots {
+			if slot.DoctorID != id || slot.Date < now {
+				continue
+			}
+			if msg := s.reservations.notice(notify.EventCancelled, slot, nil); msg != nil {
+				messages = append(messages, *msg)
+			}
+		}
+	}
+
+	return domainError(s.repo.Doctors.Delete(id, force, actor, messages))
+}
+
+func (f *DoctorForm) validate() error {
+	f.Name = strings.TrimSpace(f.Name)
+	f.Category = strings.TrimSpace(f.Category)
+	f.Price = strings.TrimSpace(f.Price)
+	f.Location = strings.TrimSpace(f.Location)
+
+	fields := make([]FieldError, 0)
+	if f.Name == "" {
+		fields = append(fields, FieldError{Field: "name", Message: "name is required"})
+	}
+	if f.Category == "" {
+		fields = append(fields, FieldError{Field: "category", Message: "category is required"})
+	}
+	if f.SlotSize <= 0 || f.SlotSize > allDay {
+		fields = append(fields, FieldError{Field: "slot_size", Message: fmt.Sprintf("slot size must be between 1 and %d minutes", allDay)})
+	}
+	if f.Gap < 0 || f.Gap > allDay {
+		fields = append(fields, FieldError{Field: "gap", Message: fmt.Sprintf("gap must be between 0 and %d minutes", allDay)})
+	}
+	if !priceFormat.MatchString(f.Price) {
+		fields = append(fields, FieldError{Field: "price", Message: fmt.Sprintf("invalid price %q, expected format is $45 or 45.50", f.Price)})
+	}
+	if f.MinNotice < 0 || f.MinNotice > maxNotice {
+		fields = append(fields, FieldError{Field: "min_notice", Message: fmt.Sprintf("minimum notice must be between 0 and %d minutes", maxNotice)})
+	}
+	if f.MaxAdvance < 0 || f.MaxAdvance > maxAdvance {
+		fields = append(fields, FieldError{Field: "max_advance", Message: fmt.Sprintf("maximum advance must be between 0 and %d days", maxAdvance)})
+	}
+	if f.SameDayCutoff < 0 || f.SameDayCutoff >= allDay {
+		fields = append(fields, FieldError{Field: "same_day_cutoff", Message: fmt.Sprintf("same-day cut-off must be between 0 and %d minutes", allDay-1)})
+	}
+	if f.TimeZone == "" {
+		f.TimeZone = "UTC"
+	}
+	if _, err := data.LoadLocation(f.TimeZone); err != nil {
+		fields = append(fields, FieldError{Field: "timezone", Message: fmt.Sprintf("invalid time zone %q", f.TimeZone)})
+	}
+
+	return invalid(fields...)
+}
+
+func (f DoctorForm) toDoctor() data.Doctor {
+	return data.Doctor{
+		Name:     f.Name,
+		Subtitle: f.Subtitle,
+		Details:  f.Details,
+		Category: f.Category,
+		Price:    f.Price,
+		Gap:      f.Gap,
+		SlotSize: f.SlotSize,
+		TimeZone: f.TimeZone,
+		Site:     f.Location,
+		ImageURL: f.Preview,
+
+		MinNotice:     f.MinNotice,
+		MaxAdvance:    f.MaxAdvance,
+		SameDayCutoff: f.SameDayCutoff,
+	}
+}
@@ -0,0 +1,124 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+type ErrorKind int
+
+const (
+	KindInternal   ErrorKind = iota
+	KindBadRequest           // malformed request
+	KindValidation           // invalid values of the request
+	KindNotFound
+	KindConflict
+	KindExpired // the time of the action is over
+	KindUnauthorized
+	KindForbidden
+)
+
+// field-level details of the validation error
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// domain error with a stable machine-readable code
+type Error struct {
+	Kind    ErrorKind
+	Code    string
+	Message string
+	Fields  []FieldError
+	Err     error // (optional) the cause
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// errors with the same code are equal, so errors.Is works for errors with details
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// returns the domain error of the chain, errors of other types are internal
+func AsError(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+
+	return &Error{Kind: KindInternal, Code: "internal_error", Message: "internal server error", Err: err}
+}
+
+func NewError(kind ErrorKind, code, format string, args ...any) *Error {
+	return &Error{Kind: kind, Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+func notFound(code, format string, args ...any) error {
+	return NewError(KindNotFound, code, format, args...)
+}
+
+func conflict(code, format string, args ...any) error {
+	return NewError(KindConflict, code, format, args...)
+}
+
+func expired(code, format string, args ...any) error {
+	return NewError(KindExpired, code, format, args...)
+}
+
+// returns the validation error with details of the fields, nil if there are no fields
+func invalid(fields ...FieldError) error {
+	if len(fields) == 0 {
+		return nil
+	}
+
+	messages := make([]string, len(fields))
+	for i, f := range fields {
+		messages[i] = f.Message
+	}
+
+	return &Error{
+		Kind:    KindValidation,
+		Code:    "validation_failed",
+		Message: strings.Join(messages, "; "),
+		Fields:  fields,
+	}
+}
+
+func invalidField(field, format string, args ...any) error {
+	return invalid(FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// domain errors which are returned by the data layer
+var dataErrors = []*Error{ErrSlotTaken, ErrHoldNotFound, ErrDoctorHasReservations, ErrReviewExists}
+
+// converts sentinel errors of the data layer into domain errors
+func domainError(err error) error {
+	for _, e := range dataErrors {
+		if errors.Is(err, e.Err) {
+			return e
+		}
+	}
+
+	return err
+}
+
+func doctorNotFound(id int) error {
+	return notFound("doctor_not_found", "doctor with id %d not found", id)
+}
+
+func reservationNotFound(id int) error {
+	return notFound("reservation_not_found", "reservation with id %d not found", id)
+}
+
+func serviceNotFound(id int) error {
+	return notFound("service_not_found", "service with id %d not found", id)
+}
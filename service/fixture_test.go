@@ -0,0 +1,97 @@
+package service
+
+import (
+	"path/filepath"
+	"scheduler-booking/data"
+	"testing"
+	"time"
+)
+
+// opens empty repositories which get the current time from the clock
+type openFunc = func(t *testing.T, clock data.Clock) data.Repositories
+
+// runs the test against the SQL and the memory storages
+func runStorages(t *testing.T, test func(t *testing.T, open openFunc)) {
+	storages := map[string]openFunc{
+		"sqlite": func(t *testing.T, clock data.Clock) data.Repositories {
+			return data.NewDAOWithClock(data.DBConfig{Path: filepath.Join(t.TempDir(), "db.sqlite")}, clock).Repositories
+		},
+		"memory": func(t *testing.T, clock data.Clock) data.Repositories {
+			return data.NewMemory(clock)
+		},
+	}
+
+	for name, open := range storages {
+		open := open
+		t.Run(name, func(t *testing.T) { test(t, open) })
+	}
+}
+
+// services on the empty storage, the current time is changed by setting now
+type fixture struct {
+	t    *testing.T
+	now  time.Time
+	repo data.Repositories
+	s    *ServiceAll
+}
+
+// the current time of the fixture is monday, 2030-01-07 8:00 UTC
+func newFixture(t *testing.T, open openFunc, config Config) *fixture {
+	f := &fixture{t: t, now: time.Date(2030, 1, 7, 8, 0, 0, 0, time.UTC)}
+	f.repo = open(t, func() time.Time { return f.now })
+	f.s = NewService(f.repo, config)
+	return f
+}
+
+// adds the doctor who works every day from the start to the end of the work time (in minutes)
+func (f *fixture) addDoctor(doctor data.Doctor, from, to int) data.Doctor {
+	f.t.Helper()
+	if to > from {
+		doctor.DoctorSchedule = []data.DoctorSchedule{{From: from, To: to, Date: at(6, 0, 0), Rrule: "FREQ=DAILY", Duration: (to - from) * 60}}
+	}
+	if _, err := f.repo.Doctors.Add(&doctor); err != nil {
+		f.t.Fatal(err)
+	}
+
+	return doctor
+}
+
+// books the slot and returns the id of the reservation or the code of the error
+func (f *fixture) book(r Reservation) (int, string) {
+	if r.Form.Name == "" {
+		r.Form.Name = "Client"
+	}
+	id, err := f.s.Reservations.Add(r)
+	return id, errorCode(err)
+}
+
+// returns the unit of the doctor with slots of the service on the date
+func (f *fixture) available(doctorID, day, serviceID int) Unit {
+	f.t.Helper()
+	units, err := f.s.Units.GetAvailableFor(at(day, 0, 0), at(day+1, 0, 0), serviceID)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	for _, u := range units {
+		if u.ID == doctorID {
+			return u
+		}
+	}
+
+	f.t.Fatalf("unit %d not found", doctorID)
+	return Unit{}
+}
+
+// returns the moment of January 2030 (in milliseconds), it is also the wall clock of any doctor
+func at(day, h, m int) int64 {
+	return time.Date(2030, 1, day, h, m, 0, 0, time.UTC).UnixMilli()
+}
+
+// returns the code of the typed error, "" if there is no error
+func errorCode(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	return AsError(err).Code
+}
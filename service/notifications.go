@@ -0,0 +1,107 @@
+package service
+
+import (
+	"encoding/json"
+	"log"
+	"scheduler-booking/data"
+	"scheduler-booking/notify"
+	"time"
+)
+
+// format of dates in messages
+const messageDate = "Mon, 02 Jan 2006 15:04"
+
+// adds the message of the event to the outbox, it is sent in the background,
+// failures don't affect the change of the reservation
+func (s *reservationsService) enqueue(event, recipient string, payload notify.Payload) {
+	if !s.config.Notify || recipient == "" {
+		return
+	}
+
+	msg, err := s.message(event, recipient, payload)
+	if err == nil {
+		_, err = s.repo.Outbox.Add(&msg)
+	}
+	if err != nil {
+		log.Printf("WARN: %s message to %s is not queued: %v", event, recipient, err)
+	}
+}
+
+// returns the pending message of the outbox which is due now
+func (s *reservationsService) message(event, recipient string, payload notify.Payload) (data.OutboxMessage, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return data.OutboxMessage{}, err
+	}
+
+	now := s.clock.Now().UnixMilli()
+	return data.OutboxMessage{
+		Event:       event,
+		Recipient:   recipient,
+		Payload:     string(body),
+		Status:      data.OutboxPending,
+		NextAttempt: now,
+		CreatedAt:   now,
+	}, nil
+}
+
+// returns the message of the event to the client of the reservation, it is queued
+// in the transaction of the change, so the change and its message are saved together,
+// nil is returned if notifications are disabled or the message can't be composed,
+// previous is the reservation before rescheduling
+func (s *reservationsService) notice(event string, slot data.OccupiedSlot, previous *data.OccupiedSlot) *data.OutboxMessage {
+	if !s.config.Notify || slot.ClientEmail == "" {
+		return nil
+	}
+
+	doctor, err := s.repo.Doctors.GetOne(slot.DoctorID)
+	if err != nil {
+		log.Printf("WARN: %s message of reservation %d is not queued: %v", event, slot.ID, err)
+		return nil
+	}
+	payload, err := s.payload(doctor, slot.ServiceID, slot.Date)
+	if err != nil {
+		log.Printf("WARN: %s message of reservation %d is not queued: %v", event, slot.ID, err)
+		return nil
+	}
+	payload.ClientName = slot.ClientName
+	if previous != nil {
+		if previous.DoctorID != doctor.ID {
+			if doctor, err = s.repo.Doctors.GetOne(previous.DoctorID); err != nil {
+				log.Printf("WARN: %s message of reservation %d is not queued: %v", event, slot.ID, err)
+				return nil
+			}
+		}
+		payload.PreviousDate = formatDate(previous.Date, doctor.Location())
+	}
+
+	msg, err := s.message(event, slot.ClientEmail, payload)
+	if err != nil {
+		log.Printf("WARN: %s message of reservation %d is not queued: %v", event, slot.ID, err)
+		return nil
+	}
+	return &msg
+}
+
+// returns the payload of the appointment starting at the moment (in milliseconds)
+func (s *reservationsService) payload(doctor data.Doctor, serviceID int, date int64) (notify.Payload, error) {
+	payload := notify.Payload{
+		DoctorName: doctor.Name,
+		Date:       formatDate(date, doctor.Location()),
+		TimeZone:   doctor.Location().String(),
+	}
+	if serviceID != 0 {
+		service, err := s.repo.Services.GetOne(serviceID)
+		if err != nil {
+			return payload, err
+		}
+		payload.Service = service.Name
+	}
+
+	return payload, nil
+}
+
+// returns the moment (in milliseconds) in the time zone
+func formatDate(date int64, loc *time.Location) string {
+	return time.UnixMilli(date).In(loc).Format(messageDate)
+}
@@ -0,0 +1,99 @@
+package service
+
+import (
+	"encoding/json"
+	"scheduler-booking/data"
+	"scheduler-booking/notify"
+	"strings"
+	"testing"
+)
+
+// checks that changes of reservations queue messages to their clients
+func TestNotifications(t *testing.T) {
+	runStorages(t, testNotifications)
+}
+
+func testNotifications(t *testing.T, open openFunc) {
+	f := newFixture(t, open, Config{HoldTime: 10, ClaimTime: 30, Window: 60, Notify: true})
+	s := f.s
+	doctor := f.addDoctor(data.Doctor{Name: "Dr. Notify", SlotSize: 60, TimeZone: "Europe/Berlin"}, 9*60, 12*60)
+
+	id, err := s.Reservations.Add(Reservation{DoctorID: doctor.ID, Date: at(7, 9, 0), Form: ReservationForm{Name: "Client", Email: "client@scheduler.booking"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Reservations.Reschedule(id, Rescheduling{Date: at(7, 10, 0)}, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Waitlist.Add(WaitlistForm{DoctorID: doctor.ID, Date: at(7, 10, 0), Form: ReservationForm{Name: "Patient", Email: "patient@scheduler.booking"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Reservations.Cancel(id, "test"); err != nil {
+		t.Fatal(err)
+	}
+	// reservations without emails don't get messages
+	if _, err := s.Reservations.Add(Reservation{DoctorID: doctor.ID, Date: at(7, 11, 0), Form: ReservationForm{Name: "Anonymous"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	messages, err := f.repo.Outbox.GetDue(f.now.UnixMilli(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []struct {
+		event, recipient string
+		payload          notify.Payload
+	}{
+		{notify.EventBooked, "client@scheduler.booking", notify.Payload{ClientName: "Client", DoctorName: "Dr. Notify", Date: "Mon, 07 Jan 2030 09:00", TimeZone: "Europe/Berlin"}},
+		{notify.EventRescheduled, "client@scheduler.booking", notify.Payload{ClientName: "Client", DoctorName: "Dr. Notify", Date: "Mon, 07 Jan 2030 10:00", TimeZone: "Europe/Berlin", PreviousDate: "Mon, 07 Jan 2030 09:00"}},
+		{notify.EventCancelled, "client@scheduler.booking", notify.Payload{ClientName: "Client", DoctorName: "Dr. Notify", Date: "Mon, 07 Jan 2030 10:00", TimeZone: "Europe/Berlin"}},
+		{notify.EventOffered, "patient@scheduler.booking", notify.Payload{ClientName: "Patient", DoctorName: "Dr. Notify", Date: "Mon, 07 Jan 2030 10:00", TimeZone: "Europe/Berlin", Expires: "Mon, 07 Jan 2030 09:30"}},
+	}
+	if len(messages) != len(expected) {
+		t.Fatalf("expected %d messages, got %+v", len(expected), messages)
+	}
+	for i, e := range expected {
+		msg := messages[i]
+		payload := notify.Payload{}
+		if err := json.Unmarshal([]byte(msg.Payload), &payload); err != nil {
+			t.Fatal(err)
+		}
+		if e.event == notify.EventOffered {
+			if !strings.HasPrefix(payload.Claim, claimPath) {
+				t.Fatalf("expected the claim link, got %q", payload.Claim)
+			}
+			payload.Claim = ""
+		}
+		if msg.Event != e.event || msg.Recipient != e.recipient || msg.Status != data.OutboxPending || payload != e.payload {
+			t.Fatalf("message %d: expected %s to %s %+v, got %+v %+v", i, e.event, e.recipient, e.payload, msg, payload)
+		}
+	}
+}
+
+// checks that the forced deletion of the doctor cancels upcoming reservations with messages
+func TestDoctorDeletionNotifications(t *testing.T) {
+	runStorages(t, func(t *testing.T, open openFunc) {
+		f := newFixture(t, open, Config{HoldTime: 10, Window: 60, Notify: true})
+		doctor := f.addDoctor(data.Doctor{Name: "Dr. Leaving", SlotSize: 60}, 9*60, 12*60)
+
+		id, err := f.s.Reservations.Add(Reservation{DoctorID: doctor.ID, Date: at(7, 9, 0), Form: ReservationForm{Name: "Client", Email: "client@scheduler.booking"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := f.s.Doctors.Delete(doctor.ID, false, "admin"); errorCode(err) != "doctor_has_reservations" {
+			t.Fatalf("expected doctor_has_reservations, got %v", err)
+		}
+		if err := f.s.Doctors.Delete(doctor.ID, true, "admin"); err != nil {
+			t.Fatal(err)
+		}
+
+		messages, err := f.repo.Outbox.GetDue(f.now.UnixMilli(), 10)
+		if err != nil || len(messages) != 2 || messages[1].Event != notify.EventCancelled || messages[1].Recipient != "client@scheduler.booking" {
+			t.Fatalf("expected the booking and the cancellation messages, got %+v (%v)", messages, err)
+		}
+		if logs, err := f.s.Reservations.GetHistory(id); err != nil || len(logs) != 1 || logs[0].Actor != "admin" {
+			t.Fatalf("expected the cancellation by the admin, got %+v (%v)", logs, err)
+		}
+	})
+}
@@ -0,0 +1,79 @@
+package service
+
+import (
+	"scheduler-booking/data"
+	"time"
+)
+
+const (
+	maxNotice  = 30 * allDay // in minutes
+	maxAdvance = 2 * 366     // in days
+)
+
+// booking rules of the doctor at the current moment,
+// times are set in the wall clock of the doctor's time zone encoded in UTC (in milliseconds)
+type bookingPolicy struct {
+	now      int64
+	earliest int64 // slots start from this time, 0 if there is no limit
+	latest   int64 // slots start before this time, 0 if there is no limit
+	closed   bool  // same-day bookings are closed
+	doctor   data.Doctor
+}
+
+func newBookingPolicy(doctor data.Doctor, loc *time.Location, now time.Time) bookingPolicy {
+	p := bookingPolicy{now: data.ToWall(now.UnixMilli(), loc), doctor: doctor}
+
+	if doctor.MinNotice > 0 {
+		p.earliest = p.now + int64(doctor.MinNotice)*minuteMilli
+	}
+	if doctor.SameDayCutoff > 0 && p.now%allDayMilli >= int64(doctor.SameDayCutoff)*minuteMilli {
+		p.closed = true
+		if tomorrow := p.today() + allDayMilli; tomorrow > p.earliest {
+			p.earliest = tomorrow
+		}
+	}
+	if doctor.MaxAdvance > 0 {
+		p.latest = p.now + int64(doctor.MaxAdvance)*allDayMilli
+	}
+
+	return p
+}
+
+func (p bookingPolicy) today() int64 {
+	return p.now - p.now%allDayMilli
+}
+
+// returns the error if the slot starting at the time can't be booked now
+func (p bookingPolicy) check(wall int64) error {
+	if p.closed && wall-wall%allDayMilli == p.today() {
+		return NewError(KindValidation, "same_day_closed", "same-day bookings are closed after %s", time.UnixMilli(int64(p.doctor.SameDayCutoff)*minuteMilli).UTC().Format("15:04"))
+	}
+	if p.earliest != 0 && wall < p.earliest {
+		return NewError(KindValidation, "booking_too_soon", "booking requires at least %d minutes notice", p.doctor.MinNotice)
+	}
+	if p.latest != 0 && wall >= p.latest {
+		return NewError(KindValidation, "booking_too_far", "booking is available up to %d days in advance", p.doctor.MaxAdvance)
+	}
+
+	return nil
+}
+
+// returns starts of the unit's slots in the [from, to) interval which can't be booked because of the policy,
+// the dates between the earliest and the latest times are skipped
+func (p bookingPolicy) blockedSlots(u *Unit, from, to int64) []int64 {
+	blocked := make([]int64, 0)
+	for date := from - from%allDayMilli; date < to; date += allDayMilli {
+		if (p.earliest == 0 || date >= p.earliest) && (p.latest == 0 || date+allDayMilli <= p.latest) {
+			continue
+		}
+
+		for _, start := range u.slotsOn(date) {
+			stamp := newStamp(date, start)
+			if stamp >= p.now && p.check(stamp) != nil {
+				blocked = append(blocked, stamp)
+			}
+		}
+	}
+
+	return blocked
+}
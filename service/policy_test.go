@@ -0,0 +1,62 @@
+package service
+
+import (
+	"reflect"
+	"scheduler-booking/data"
+	"testing"
+)
+
+// checks that the booking policy of the doctor limits both the available slots and new reservations
+func TestBookingPolicy(t *testing.T) {
+	runStorages(t, testBookingPolicy)
+}
+
+func testBookingPolicy(t *testing.T, open openFunc) {
+	f := newFixture(t, open, Config{HoldTime: 10, Window: 60})
+	doctor := f.addDoctor(data.Doctor{Name: "Dr. Policy", SlotSize: 60, MinNotice: 90, MaxAdvance: 3}, 9*60, 12*60)
+
+	available := func() []int64 {
+		units, err := f.s.Units.GetAvailable(0, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return units[0].AvailableSlots
+	}
+	book := func(date int64) string {
+		_, code := f.book(Reservation{DoctorID: doctor.ID, Date: date})
+		return code
+	}
+
+	// 9:00 is within the notice, the horizon ends on thursday 8:00
+	expected := []int64{at(7, 10, 0), at(7, 11, 0), at(8, 9, 0), at(8, 10, 0), at(8, 11, 0), at(9, 9, 0), at(9, 10, 0), at(9, 11, 0)}
+	if slots := available(); !reflect.DeepEqual(slots, expected) {
+		t.Fatalf("expected slots %v, got %v", expected, slots)
+	}
+	if code := book(at(7, 9, 0)); code != "booking_too_soon" {
+		t.Fatalf("expected booking_too_soon, got %q", code)
+	}
+	if code := book(at(10, 9, 0)); code != "booking_too_far" {
+		t.Fatalf("expected booking_too_far, got %q", code)
+	}
+
+	// same-day bookings are closed after 7:00
+	form := DoctorForm{Name: doctor.Name, Category: "Test", Price: "$10", SlotSize: 60, MinNotice: 90, MaxAdvance: 3, SameDayCutoff: 7 * 60}
+	if err := f.s.Doctors.Update(doctor.ID, form); err != nil {
+		t.Fatal(err)
+	}
+	expected = expected[2:]
+	if slots := available(); !reflect.DeepEqual(slots, expected) {
+		t.Fatalf("expected slots %v, got %v", expected, slots)
+	}
+	if code := book(at(7, 11, 0)); code != "same_day_closed" {
+		t.Fatalf("expected same_day_closed, got %q", code)
+	}
+	if code := book(at(8, 9, 0)); code != "" {
+		t.Fatalf("expected the reservation for tomorrow, got %q", code)
+	}
+
+	form.MinNotice = -1
+	if err := f.s.Doctors.Update(doctor.ID, form); AsError(err).Fields[0].Field != "min_notice" {
+		t.Fatalf("expected min_notice validation error, got %v", err)
+	}
+}
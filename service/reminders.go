@@ -0,0 +1,80 @@
+package service
+
+import (
+	"scheduler-booking/data"
+	"scheduler-booking/notify"
+	"sort"
+)
+
+type remindersService struct {
+	repo         data.Repositories
+	config       Config
+	clock        data.Clock
+	reservations *reservationsService
+}
+
+// queues reminders of upcoming reservations and returns their number,
+// a reservation gets only the closest reminder which is due, e.g. the reservation booked
+// 30 minutes before its start doesn't get the reminder of the day before;
+// recorded reminders are not repeated after restarts or by other replicas
+func (s *remindersService) Send() (int, error) {
+	if !s.config.Notify || len(s.config.Reminders) == 0 {
+		return 0, nil
+	}
+
+	before := append([]int{}, s.config.Reminders...)
+	sort.Ints(before)
+
+	now := s.clock.Now().UnixMilli()
+	slots, err := s.repo.OccupiedSlots.GetUpcoming(now, now+int64(before[len(before)-1])*minuteMilli)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	doctors := make(map[int]data.Doctor)
+	for _, slot := range slots {
+		if slot.ClientEmail == "" {
+			continue
+		}
+
+		minutes := 0
+		for _, b := range before {
+			if slot.Date-now <= int64(b)*minuteMilli {
+				minutes = b
+				break
+			}
+		}
+
+		doctor, ok := doctors[slot.DoctorID]
+		if !ok {
+			if doctor, err = s.repo.Doctors.GetOne(slot.DoctorID); err != nil {
+				return count, err
+			}
+			doctors[slot.DoctorID] = doctor
+		}
+
+		payload, err := s.reservations.payload(doctor, slot.ServiceID, slot.Date)
+		if err != nil {
+			return count, err
+		}
+		payload.ClientName = slot.ClientName
+
+		msg, err := s.reservations.message(notify.EventReminder, slot.ClientEmail, payload)
+		if err != nil {
+			return count, err
+		}
+		msg.ReservationID = slot.ID
+
+		reminder := data.Reminder{ReservationID: slot.ID, Date: slot.Date, MinutesBefore: minutes, CreatedAt: now}
+		recorded, err := s.repo.Reminders.Record(&reminder, &msg)
+		if err != nil {
+			return count, err
+		}
+		if recorded {
+			count++
+		}
+	}
+
+	return count, nil
+}
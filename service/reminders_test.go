@@ -0,0 +1,77 @@
+package service
+
+import (
+	"reflect"
+	"scheduler-booking/data"
+	"scheduler-booking/notify"
+	"testing"
+	"time"
+)
+
+// checks that reservations get each reminder once
+func TestReminders(t *testing.T) {
+	runStorages(t, testReminders)
+}
+
+func testReminders(t *testing.T, open openFunc) {
+	f := newFixture(t, open, Config{HoldTime: 10, Window: 60, Notify: true, Reminders: []int{60, 24 * 60}})
+	f.now = time.Date(2030, 1, 6, 8, 0, 0, 0, time.UTC) // sunday
+	doctor := f.addDoctor(data.Doctor{Name: "Dr. Reminder", SlotSize: 60}, 9*60, 12*60)
+
+	add := func(date int64, email string) int {
+		t.Helper()
+		id, code := f.book(Reservation{DoctorID: doctor.ID, Date: date, Form: ReservationForm{Name: "Client", Email: email}})
+		if code != "" {
+			t.Fatal(code)
+		}
+		return id
+	}
+	send := func(expected int) {
+		t.Helper()
+		if count, err := f.s.Reminders.Send(); err != nil || count != expected {
+			t.Fatalf("expected %d reminders at %s, got %d (%v)", expected, f.now, count, err)
+		}
+	}
+
+	add(at(6, 9, 0), "soon@scheduler.booking")
+	add(at(7, 9, 0), "tomorrow@scheduler.booking")
+	later := add(at(7, 11, 0), "later@scheduler.booking")
+	add(at(7, 10, 0), "") // without email
+	next := add(at(8, 9, 0), "next@scheduler.booking")
+
+	// the reservation in an hour gets only the last reminder
+	send(1)
+	send(0)
+	f.now = time.Date(2030, 1, 6, 11, 30, 0, 0, time.UTC)
+	send(2)
+
+	// the rescheduled reservation gets reminders of the new date, the pending one of the old date is dropped
+	if err := f.s.Reservations.Reschedule(later, Rescheduling{Date: at(8, 10, 0)}, "test"); err != nil {
+		t.Fatal(err)
+	}
+	f.now = time.Date(2030, 1, 7, 8, 0, 0, 0, time.UTC)
+	send(1)
+	f.now = time.Date(2030, 1, 7, 10, 0, 0, 0, time.UTC)
+	send(2)
+	send(0)
+
+	// the cancelled reservation doesn't get pending reminders
+	if err := f.s.Reservations.Cancel(next, "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	messages, err := f.repo.Outbox.GetDue(f.now.UnixMilli(), 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reminders := make(map[string]int)
+	for _, msg := range messages {
+		if msg.Event == notify.EventReminder {
+			reminders[msg.Recipient]++
+		}
+	}
+	expected := map[string]int{"soon@scheduler.booking": 1, "tomorrow@scheduler.booking": 2, "later@scheduler.booking": 1}
+	if !reflect.DeepEqual(reminders, expected) {
+		t.Fatalf("expected reminders %v, got %v", expected, reminders)
+	}
+}
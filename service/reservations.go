@@ -1,12 +1,26 @@
 package service
 
 import (
-	"fmt"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
 	"scheduler-booking/data"
+	"scheduler-booking/notify"
+	"sort"
+	"time"
 )
 
+// returned when the slot is booked by another client
+var ErrSlotTaken = &Error{Kind: KindConflict, Code: "slot_taken", Message: data.ErrSlotTaken.Error(), Err: data.ErrSlotTaken}
+
+// returned when the hold has expired or doesn't exist
+var ErrHoldNotFound = &Error{Kind: KindNotFound, Code: "hold_not_found", Message: data.ErrHoldNotFound.Error(), Err: data.ErrHoldNotFound}
+
 type reservationsService struct {
-	dao *data.DAO
+	repo     data.Repositories
+	config   Config
+	clock    data.Clock
+	waitlist *waitlistService // (optional) gets freed slots
 }
 
 type ReservationForm struct {
@@ -16,35 +30,80 @@ type ReservationForm struct {
 }
 
 type Reservation struct {
-	DoctorID int             `json:"doctor"`
-	Date     int64           `json:"date"`
-	Form     ReservationForm `json:"form"`
+	DoctorID  int             `json:"doctor"`
+	Date      int64           `json:"date"`              // wall clock of the doctor's time zone encoded in UTC
+	ServiceID int             `json:"service,omitempty"` // (optional) service of the doctor, one slot by default
+	Form      ReservationForm `json:"form"`
+	Hold      string          `json:"hold,omitempty"` // (optional) token of the hold to be confirmed
+}
+
+type Hold struct {
+	DoctorID  int   `json:"doctor"`
+	Date      int64 `json:"date"`              // wall clock of the doctor's time zone encoded in UTC
+	ServiceID int   `json:"service,omitempty"` // (optional) service of the doctor, one slot by default
+}
+
+type HoldInfo struct {
+	Token   string `json:"token"`
+	Expires int64  `json:"expires"`
+}
+
+type Rescheduling struct {
+	DoctorID int   `json:"doctor"` // (optional) the current doctor by default
+	Date     int64 `json:"date"`   // wall clock of the doctor's time zone encoded in UTC
 }
 
 func (s *reservationsService) GetAll() ([]data.OccupiedSlot, error) {
-	records, err := s.dao.OccupiedSlots.GetAll()
+	records, err := s.repo.OccupiedSlots.GetAll()
 	if err != nil {
 		return nil, err
 	}
 
-	doctors, err := s.dao.Doctors.GetAll(true)
+	// the interval covers upcoming reservations in all time zones
+	window := data.Window{From: s.clock.Today().Add(-oneDay).UnixMilli()}
+	for _, record := range records {
+		if record.Date > window.To {
+			window.To = record.Date
+		}
+	}
+	window = dateWindow(window.From, window.To+allDayMilli)
+
+	doctors, err := s.repo.Doctors.GetAllWithSchedule(window)
 	if err != nil {
 		return nil, err
 	}
 
-	mapRecords := make(map[int64]data.OccupiedSlot)
+	locations := make(map[int]*time.Location, len(doctors))
+	for _, doctor := range doctors {
+		locations[doctor.ID] = doctor.Location()
+	}
+
+	mapRecords := make(map[int]map[int64][]data.OccupiedSlot) // doctorID -> wall clock -> records of the session
 	for _, record := range records {
-		mapRecords[record.Date] = record
+		loc, ok := locations[record.DoctorID]
+		if !ok {
+			continue
+		}
+
+		if mapRecords[record.DoctorID] == nil {
+			mapRecords[record.DoctorID] = make(map[int64][]data.OccupiedSlot)
+		}
+		wall := data.ToWall(record.Date, loc)
+		mapRecords[record.DoctorID][wall] = append(mapRecords[record.DoctorID][wall], record)
 	}
 
 	availableSlots := []data.OccupiedSlot{}
-	units := createUnits(doctors, false)
+	units := createUnits(doctors, absences{}, window, false, s.clock)
 	for _, unit := range units {
-		for _, uslots := range unit.UsedSlots {
-			record := mapRecords[uslots]
-			if record.DoctorID == unit.ID {
-				availableSlots = append(availableSlots, record)
-			}
+		// group sessions with free seats are not used slots
+		booked := append([]int64{}, unit.UsedSlots...)
+		for slot := range unit.Seats {
+			booked = append(booked, slot)
+		}
+		sort.Slice(booked, func(i, j int) bool { return booked[i] < booked[j] })
+
+		for _, uslots := range booked {
+			availableSlots = append(availableSlots, mapRecords[unit.ID][uslots]...)
 		}
 	}
 
@@ -52,34 +111,297 @@ func (s *reservationsService) GetAll() ([]data.OccupiedSlot, error) {
 }
 
 func (s *reservationsService) Add(r Reservation) (int, error) {
+	if r.Hold != "" {
+		return s.confirmHold(r)
+	}
+
+	a, err := getAppointment(s.repo, r.DoctorID, r.ServiceID)
+	if err != nil {
+		return 0, err
+	}
+
 	// check if reservation time is available and has not expired yet
-	err := s.checkIfReservationIsAvailable(r.DoctorID, r.Date)
+	date, err := s.checkIfReservationIsAvailable(r.DoctorID, r.Date, a, 0)
 	if err != nil {
 		return 0, err
 	}
 
-	id, err := s.dao.OccupiedSlots.Add(
-		r.DoctorID,
-		r.Date,
-		r.Form.Name,
-		r.Form.Email,
-		r.Form.Details,
-	)
+	slot := data.OccupiedSlot{
+		DoctorID:      r.DoctorID,
+		Date:          date,
+		ClientName:    r.Form.Name,
+		ClientEmail:   r.Form.Email,
+		ClientDetails: r.Form.Details,
+		ServiceID:     a.serviceID,
+		Duration:      a.duration,
+		Buffer:        a.buffer,
+		Capacity:      a.capacity,
+	}
+	id, err := s.repo.OccupiedSlots.Create(&slot, s.notice(notify.EventBooked, slot, nil))
+	if err != nil {
+		return 0, domainError(err)
+	}
+
+	return id, nil
+}
+
+// temporarily reserves the slot while the client fills the booking form
+func (s *reservationsService) Hold(h Hold) (HoldInfo, error) {
+	until := s.clock.Now().Add(time.Duration(s.config.HoldTime) * time.Minute).UnixMilli()
+	token, err := s.hold(h, until)
+	if err != nil {
+		return HoldInfo{}, err
+	}
+
+	return HoldInfo{Token: token, Expires: until}, nil
+}
+
+// holds the slot until the moment and returns the token of the hold
+func (s *reservationsService) hold(h Hold, until int64) (string, error) {
+	a, err := getAppointment(s.repo, h.DoctorID, h.ServiceID)
+	if err != nil {
+		return "", err
+	}
+
+	date, err := s.checkIfReservationIsAvailable(h.DoctorID, h.Date, a, 0)
+	if err != nil {
+		return "", err
+	}
+
+	token, err := newToken()
+	if err != nil {
+		return "", err
+	}
 
-	return id, err
+	_, err = s.repo.OccupiedSlots.Create(&data.OccupiedSlot{
+		DoctorID:  h.DoctorID,
+		Date:      date,
+		ServiceID: a.serviceID,
+		Duration:  a.duration,
+		Buffer:    a.buffer,
+		Capacity:  a.capacity,
+		HoldToken: token,
+		HoldUntil: until,
+	}, nil)
+	if err != nil {
+		return "", domainError(err)
+	}
+
+	return token, nil
 }
 
-func (s *reservationsService) checkIfReservationIsAvailable(doctorId int, date int64) error {
-	slot, err := s.dao.OccupiedSlots.GetUsedSlot(doctorId, date)
+// releases the hold, so its slot becomes available again
+func (s *reservationsService) ReleaseHold(token string) error {
+	return domainError(s.repo.OccupiedSlots.DeleteHold(token))
+}
+
+// deletes holds which were not confirmed in time
+func (s *reservationsService) DeleteExpiredHolds() (int64, error) {
+	return s.repo.OccupiedSlots.DeleteExpiredHolds()
+}
+
+func (s *reservationsService) confirmHold(r Reservation) (int, error) {
+	hold, err := s.repo.OccupiedSlots.GetHold(r.Hold)
+	if err != nil {
+		return 0, domainError(err)
+	}
+
+	if r.DoctorID != 0 && r.DoctorID != hold.DoctorID {
+		return 0, conflict("hold_mismatch", "hold is made for another doctor")
+	}
+	if r.Date != 0 {
+		doctor, err := s.repo.Doctors.GetOne(hold.DoctorID)
+		if err != nil {
+			return 0, err
+		}
+		if data.FromWall(r.Date, doctor.Location()) != hold.Date {
+			return 0, conflict("hold_mismatch", "hold is made for another time")
+		}
+	}
+
+	hold.ClientName, hold.ClientEmail = r.Form.Name, r.Form.Email
+	id, err := s.repo.OccupiedSlots.ConfirmHold(r.Hold, r.Form.Name, r.Form.Email, r.Form.Details, s.notice(notify.EventBooked, hold, nil))
+	if err != nil {
+		return 0, domainError(err)
+	}
+
+	return id, nil
+}
+
+func newToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// cancels the reservation, so its slot becomes available again
+func (s *reservationsService) Cancel(id int, actor string) error {
+	slot, err := s.GetOne(id)
 	if err != nil {
 		return err
 	}
-	if slot.ID != 0 {
-		return fmt.Errorf("this time is already booked")
+	if slot.Date < s.clock.Now().UnixMilli() {
+		return expired("reservation_expired", "cannot cancel past reservation")
+	}
+
+	if err := s.repo.OccupiedSlots.Delete(id, actor, s.notice(notify.EventCancelled, slot, nil)); err != nil {
+		return domainError(err)
+	}
+
+	s.free(slot)
+	return nil
+}
+
+// moves the reservation to another date or doctor
+func (s *reservationsService) Reschedule(id int, r Rescheduling, actor string) error {
+	slot, err := s.GetOne(id)
+	if err != nil {
+		return err
+	}
+	if slot.Date < s.clock.Now().UnixMilli() {
+		return expired("reservation_expired", "cannot reschedule past reservation")
+	}
+
+	if r.DoctorID == 0 {
+		r.DoctorID = slot.DoctorID
+	}
+
+	doctor, err := s.repo.Doctors.GetOne(r.DoctorID)
+	if err != nil {
+		return err
+	}
+	if slot.DoctorID == doctor.ID && slot.Date == data.FromWall(r.Date, doctor.Location()) {
+		// nothing to change
+		return nil
+	}
+
+	// the reservation keeps its duration and the capacity of its session
+	a := appointment{serviceID: slot.ServiceID, duration: slot.Duration, buffer: slot.Buffer, capacity: slot.Capacity}
+	date, err := s.checkIfReservationIsAvailable(r.DoctorID, r.Date, a, slot.ID)
+	if err != nil {
+		return err
+	}
+
+	moved := slot
+	moved.DoctorID, moved.Date = r.DoctorID, date
+	if err := s.repo.OccupiedSlots.Move(id, r.DoctorID, date, actor, s.notice(notify.EventRescheduled, moved, &slot)); err != nil {
+		return domainError(err)
+	}
+
+	s.free(slot)
+	return nil
+}
+
+// offers the freed slot of the reservation to the waitlist,
+// failures don't affect the change of the reservation
+func (s *reservationsService) free(slot data.OccupiedSlot) {
+	if s.waitlist == nil {
+		return
+	}
+
+	doctor, err := s.repo.Doctors.GetOne(slot.DoctorID)
+	if err == nil && doctor.ID != 0 {
+		err = s.waitlist.offer(doctor.ID, data.ToWall(slot.Date, doctor.Location()))
+	}
+	if err != nil {
+		log.Printf("WARN: offer of the freed slot of reservation %d: %v", slot.ID, err)
+	}
+}
+
+// returns the history of reservation changes
+func (s *reservationsService) GetHistory(id int) ([]data.ReservationLog, error) {
+	return s.repo.OccupiedSlots.GetLogs(id)
+}
+
+// returns the confirmed reservation
+func (s *reservationsService) GetOne(id int) (data.OccupiedSlot, error) {
+	slot, err := s.repo.OccupiedSlots.GetOne(id)
+	if err != nil {
+		return slot, err
+	}
+	if slot.ID == 0 || slot.HoldUntil != 0 {
+		return slot, reservationNotFound(id)
+	}
+
+	return slot, nil
+}
+
+// checks that the reservation time (wall clock of the doctor) is the start of free slots of the appointment
+// or of the group session with free seats and returns the moment of the reservation,
+// the moved reservation (if any) doesn't block its own time
+func (s *reservationsService) checkIfReservationIsAvailable(doctorID int, wall int64, a appointment, moved int) (int64, error) {
+	window := dateWindow(wall, wall+int64(a.length(0))*minuteMilli+1)
+	doctor, err := s.repo.Doctors.GetOneWithSchedule(doctorID, window)
+	if err != nil {
+		return 0, err
+	}
+	if doctor.ID == 0 {
+		return 0, doctorNotFound(doctorID)
+	}
+	if moved != 0 {
+		slots := make([]data.OccupiedSlot, 0, len(doctor.OccupiedSlots))
+		for _, slot := range doctor.OccupiedSlots {
+			if slot.ID != moved {
+				slots = append(slots, slot)
+			}
+		}
+		doctor.OccupiedSlots = slots
+	}
+
+	date := data.FromWall(wall, doctor.Location())
+	if date < s.clock.Now().UnixMilli() {
+		return 0, expired("booking_expired", "booking time has expired")
+	}
+	if err := newBookingPolicy(doctor, doctor.Location(), s.clock.Now()).check(wall); err != nil {
+		return 0, err
+	}
+
+	length := a.length(doctor.SlotSize)
+	absences, err := getAbsences(s.repo, data.Window{From: wall, To: wall + int64(length)*minuteMilli})
+	if err != nil {
+		return 0, err
+	}
+	if closure := closureAt(closuresOf(doctor, absences.closures), wall, length); closure != nil {
+		return 0, NewError(KindValidation, "clinic_closed", "the clinic is closed from %s to %s", time.UnixMilli(closure.StartDate).UTC().Format(strFormat), time.UnixMilli(closure.EndDate).UTC().Format(strFormat))
+	}
+	if timeOff := timeOffOf(doctor, absences.timeOff); len(timeOff) > 0 {
+		return 0, NewError(KindValidation, "doctor_time_off", "doctor %d is off from %s to %s", doctorID, time.UnixMilli(timeOff[0].StartDate).UTC().Format(strFormat), time.UnixMilli(timeOff[0].EndDate).UTC().Format(strFormat))
+	}
+
+	unit := createUnits([]data.Doctor{doctor}, absences, window, true, s.clock)[0]
+	if !unit.hasSlot(wall) {
+		return 0, NewError(KindValidation, "slot_not_found", "doctor %d has no slot starting at %s", doctorID, time.UnixMilli(wall).UTC().Format(strFormat))
+	}
+	if a.duration > 0 && !unit.fits(wall, a.duration) {
+		return 0, NewError(KindValidation, "slot_not_found", "doctor %d has no %d minutes for the service starting at %s", doctorID, a.duration, time.UnixMilli(wall).UTC().Format(strFormat))
+	}
+
+	records, err := s.repo.OccupiedSlots.GetUsedSlots(doctorID, date)
+	if err != nil {
+		return 0, err
+	}
+	session := make([]data.OccupiedSlot, 0, len(records))
+	for _, record := range records {
+		if record.ID != moved {
+			session = append(session, record)
+		}
+	}
+	if len(session) > 0 {
+		// the reservation takes a seat of the group session, its time is already checked
+		if !a.joins(session) {
+			return 0, ErrSlotTaken
+		}
+		return date, nil
+	}
+	if containsStamp(unit.UsedSlots, wall) {
+		return 0, ErrSlotTaken
 	}
-	if date < data.Now().UnixMilli() {
-		return fmt.Errorf("booking time has expired")
+	if a.duration > 0 && !unit.isFree(wall, wall+int64(length)*minuteMilli) {
+		return 0, ErrSlotTaken
 	}
 
-	return err
+	return date, nil
 }
@@ -0,0 +1,80 @@
+package service
+
+import (
+	"scheduler-booking/data"
+	"strings"
+	"time"
+)
+
+// returned when the appointment already has a review
+var ErrReviewExists = &Error{Kind: KindConflict, Code: "review_exists", Message: data.ErrReviewExists.Error(), Err: data.ErrReviewExists}
+
+type reviewsService struct {
+	repo  data.Repositories
+	clock data.Clock
+}
+
+type ReviewForm struct {
+	Stars   int    `json:"stars"` // from 1 to 5
+	Comment string `json:"comment"`
+	Email   string `json:"email"` // email of the reservation
+}
+
+// returns reviews of the doctor, the newest first
+func (s *reviewsService) GetAll(doctorID int) ([]data.Review, error) {
+	return s.repo.Reviews.GetAll(doctorID)
+}
+
+// adds the review of the completed appointment
+func (s *reviewsService) Add(reservationID int, form ReviewForm) (int, error) {
+	slot, err := s.repo.OccupiedSlots.GetOne(reservationID)
+	if err != nil {
+		return 0, err
+	}
+	if slot.ID == 0 || slot.HoldUntil != 0 {
+		return 0, reservationNotFound(reservationID)
+	}
+
+	fields := make([]FieldError, 0)
+	if !strings.EqualFold(strings.TrimSpace(form.Email), slot.ClientEmail) {
+		fields = append(fields, FieldError{Field: "email", Message: "email doesn't match the reservation"})
+	}
+	if form.Stars < 1 || form.Stars > 5 {
+		fields = append(fields, FieldError{Field: "stars", Message: "stars must be between 1 and 5"})
+	}
+	if err := invalid(fields...); err != nil {
+		return 0, err
+	}
+
+	doctor, err := s.repo.Doctors.GetOne(slot.DoctorID)
+	if err != nil {
+		return 0, err
+	}
+
+	// reservations of services last for their durations
+	length := doctor.SlotSize
+	if slot.Duration > 0 {
+		length = slot.Duration
+	}
+	end := time.UnixMilli(slot.Date).Add(time.Duration(length) * time.Minute)
+	if end.After(s.clock.Now()) {
+		return 0, conflict("appointment_not_completed", "appointment is not completed yet")
+	}
+
+	id, err := s.repo.Reviews.Add(&data.Review{
+		DoctorID:      slot.DoctorID,
+		ReservationID: slot.ID,
+		Stars:         form.Stars,
+		Comment:       strings.TrimSpace(form.Comment),
+		ClientName:    slot.ClientName,
+		CreatedAt:     s.clock.Now().UnixMilli(),
+	})
+
+	return id, domainError(err)
+}
+
+// returns the review summary of the doctor
+func (s *reviewsService) GetSummary(doctorID int) (data.ReviewSummary, error) {
+	summaries, err := s.repo.Reviews.GetSummaries()
+	return summaries[doctorID], err
+}
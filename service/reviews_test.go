@@ -0,0 +1,42 @@
+package service
+
+import (
+	"scheduler-booking/data"
+	"testing"
+	"time"
+)
+
+// checks that the appointment can be reviewed after its end
+func TestReviewAfterAppointment(t *testing.T) {
+	runStorages(t, testReviewAfterAppointment)
+}
+
+func testReviewAfterAppointment(t *testing.T, open openFunc) {
+	f := newFixture(t, open, Config{HoldTime: 10, Window: 60})
+	doctor := f.addDoctor(data.Doctor{Name: "Dr. Reviews", SlotSize: 20}, 9*60, 12*60)
+	therapy, err := f.s.ServiceTypes.Add(ServiceTypeForm{DoctorID: doctor.ID, Name: "Therapy", Duration: 90, Buffer: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, code := f.book(Reservation{DoctorID: doctor.ID, Date: at(7, 9, 0), ServiceID: therapy, Form: ReservationForm{Email: "client@scheduler.booking"}})
+	if code != "" {
+		t.Fatalf("expected the reservation, got %q", code)
+	}
+
+	cases := []struct {
+		now  time.Time
+		code string
+	}{
+		{now: time.UnixMilli(at(7, 9, 30)), code: "appointment_not_completed"}, // after the slot of the doctor
+		{now: time.UnixMilli(at(7, 10, 29)), code: "appointment_not_completed"},
+		{now: time.UnixMilli(at(7, 10, 30)), code: ""},
+	}
+	for _, c := range cases {
+		f.now = c.now
+		_, err := f.s.Reviews.Add(id, ReviewForm{Stars: 5, Email: "client@scheduler.booking"})
+		if code := errorCode(err); code != c.code {
+			t.Fatalf("%s: expected %q, got %q", c.now.UTC(), c.code, code)
+		}
+	}
+}
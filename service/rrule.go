@@ -0,0 +1,489 @@
+package service
+
+import (
+	"fmt"
+	"scheduler-booking/data"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// recurrence rules (RFC 5545) of doctor's worktime
+
+type frequency int
+
+const (
+	freqDaily frequency = iota
+	freqWeekly
+	freqMonthly
+	freqYearly
+)
+
+var frequencies = map[string]frequency{
+	"DAILY":   freqDaily,
+	"WEEKLY":  freqWeekly,
+	"MONTHLY": freqMonthly,
+	"YEARLY":  freqYearly,
+}
+
+type weekdayNum struct {
+	N   int // 0 - every weekday of the period
+	Day time.Weekday
+}
+
+type rrule struct {
+	Freq       frequency
+	Interval   int
+	Count      int
+	Until      time.Time // zero if not defined
+	untilUTC   bool
+	ByDay      []weekdayNum
+	ByMonthDay []int
+	ByMonth    []int
+	ByYearDay  []int
+	ByWeekNo   []int
+	BySetPos   []int
+	WeekStart  time.Weekday
+}
+
+const untilLayout = "20060102T150405"
+
+func parseRule(str string) (*rrule, error) {
+	rule := &rrule{Interval: 1, WeekStart: time.Monday}
+	freq := false
+
+	for _, part := range strings.Split(strings.TrimPrefix(str, "RRULE:"), ";") {
+		if part == "" {
+			continue
+		}
+
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid rrule part %q", part)
+		}
+
+		name, value := strings.ToUpper(kv[0]), strings.ToUpper(kv[1])
+		var err error
+		switch name {
+		case "FREQ":
+			f, ok := frequencies[value]
+			if !ok {
+				return nil, fmt.Errorf("unsupported frequency %q", value)
+			}
+			rule.Freq = f
+			freq = true
+		case "INTERVAL":
+			rule.Interval, err = strconv.Atoi(value)
+			if err == nil && rule.Interval < 1 {
+				err = fmt.Errorf("must be positive")
+			}
+		case "COUNT":
+			rule.Count, err = strconv.Atoi(value)
+			if err == nil && rule.Count < 1 {
+				err = fmt.Errorf("must be positive")
+			}
+		case "UNTIL":
+			rule.Until, err = parseUntil(value)
+			rule.untilUTC = strings.HasSuffix(value, "Z")
+		case "BYDAY":
+			rule.ByDay, err = parseWeekdays(value)
+		case "BYMONTHDAY":
+			rule.ByMonthDay, err = parseNumbers(value, 1, 31, true)
+		case "BYMONTH":
+			rule.ByMonth, err = parseNumbers(value, 1, 12, false)
+		case "BYYEARDAY":
+			rule.ByYearDay, err = parseNumbers(value, 1, 366, true)
+		case "BYWEEKNO":
+			rule.ByWeekNo, err = parseNumbers(value, 1, 53, true)
+		case "BYSETPOS":
+			rule.BySetPos, err = parseNumbers(value, 1, 366, true)
+		case "WKST":
+			day, ok := week[value]
+			if !ok {
+				err = fmt.Errorf("invalid day abbreviation")
+			}
+			rule.WeekStart = time.Weekday(day)
+		default:
+			// BYHOUR, BYMINUTE, BYSECOND and others can't be applied to the day schedule
+			return nil, fmt.Errorf("unsupported rrule part %q", name)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s value %q: %w", name, value, err)
+		}
+	}
+
+	if !freq {
+		return nil, fmt.Errorf("rrule must contain FREQ")
+	}
+	if rule.Count != 0 && !rule.Until.IsZero() {
+		return nil, fmt.Errorf("rrule can't contain both COUNT and UNTIL")
+	}
+	if len(rule.ByWeekNo) > 0 && rule.Freq != freqYearly {
+		return nil, fmt.Errorf("BYWEEKNO is allowed only for YEARLY rules")
+	}
+	if len(rule.ByYearDay) > 0 && rule.Freq != freqYearly && rule.Freq != freqDaily {
+		return nil, fmt.Errorf("BYYEARDAY is not allowed for WEEKLY and MONTHLY rules")
+	}
+	if len(rule.ByMonthDay) > 0 && rule.Freq == freqWeekly {
+		return nil, fmt.Errorf("BYMONTHDAY is not allowed for WEEKLY rules")
+	}
+
+	return rule, nil
+}
+
+func parseUntil(value string) (time.Time, error) {
+	value = strings.TrimSuffix(value, "Z")
+	if len(value) == len("20060102") {
+		// date only, the whole day is included
+		t, err := time.Parse("20060102", value)
+		return t.Add(oneDay - time.Second), err
+	}
+
+	return time.Parse(untilLayout, value)
+}
+
+func parseWeekdays(value string) ([]weekdayNum, error) {
+	days := make([]weekdayNum, 0, 7)
+	for _, str := range strings.Split(value, ",") {
+		if len(str) < 2 {
+			return nil, fmt.Errorf("invalid weekday %q", str)
+		}
+
+		day, ok := week[str[len(str)-2:]]
+		if !ok {
+			return nil, fmt.Errorf("invalid day abbreviation %q", str)
+		}
+
+		n := 0
+		if num := str[:len(str)-2]; num != "" {
+			var err error
+			n, err = strconv.Atoi(num)
+			if err != nil || n == 0 || n < -53 || n > 53 {
+				return nil, fmt.Errorf("invalid weekday %q", str)
+			}
+		}
+
+		days = append(days, weekdayNum{N: n, Day: time.Weekday(day)})
+	}
+
+	return days, nil
+}
+
+func parseNumbers(value string, min, max int, negative bool) ([]int, error) {
+	strs := strings.Split(value, ",")
+	nums := make([]int, 0, len(strs))
+	for _, str := range strs {
+		num, err := strconv.Atoi(str)
+		if err != nil {
+			return nil, err
+		}
+
+		abs := num
+		if negative && num < 0 {
+			abs = -num
+		}
+		if abs < min || abs > max {
+			return nil, fmt.Errorf("%d is out of range", num)
+		}
+
+		nums = append(nums, num)
+	}
+
+	return nums, nil
+}
+
+// converts UNTIL set in UTC to the wall clock of the location
+func (r *rrule) in(loc *time.Location) *rrule {
+	if !r.untilUTC {
+		return r
+	}
+
+	rule := *r
+	rule.Until = time.UnixMilli(data.ToWall(r.Until.UnixMilli(), loc)).UTC()
+	rule.untilUTC = false
+	return &rule
+}
+
+// simple rules can be presented as days of the week for the booking
+func (r *rrule) isWeekly() bool {
+	if r.Freq != freqWeekly || r.Interval != 1 || r.Count != 0 || !r.Until.IsZero() {
+		return false
+	}
+	if len(r.ByDay) == 0 || len(r.ByMonth) > 0 || len(r.BySetPos) > 0 {
+		return false
+	}
+
+	return true
+}
+
+// returns occurrences of the rule started at dtstart in the [from, to) interval
+func (r *rrule) between(dtstart, from, to time.Time) []time.Time {
+	out := make([]time.Time, 0)
+	r.iterate(dtstart, to, func(occ time.Time) {
+		if !occ.Before(from) {
+			out = append(out, occ)
+		}
+	})
+
+	return out
+}
+
+// checks if the rule started at dtstart has an occurrence at the given time
+func (r *rrule) occursAt(dtstart, t time.Time) bool {
+	occurs := r.between(dtstart, t, t.Add(time.Second))
+	return len(occurs) > 0
+}
+
+// in years, the calendar repeats every 400 years, so sparse rules like February 29 fit in it
+const countHorizon = 400
+
+// returns the last occurrence of the rule if it is limited by COUNT or UNTIL
+func (r *rrule) last(dtstart time.Time) (time.Time, bool) {
+	if r.Count == 0 && r.Until.IsZero() {
+		return time.Time{}, false
+	}
+
+	// the iteration stops after COUNT occurrences, the horizon only limits rules which never occur
+	end := r.Until
+	if end.IsZero() {
+		end = dtstart.AddDate(countHorizon*r.Interval, 0, 0)
+	}
+
+	var last time.Time
+	r.iterate(dtstart, end.Add(time.Second), func(occ time.Time) {
+		last = occ
+	})
+
+	return last, !last.IsZero()
+}
+
+// calls fn for every occurrence before the "to" moment
+func (r *rrule) iterate(dtstart, to time.Time, fn func(time.Time)) {
+	rule := r.withDefaults(dtstart)
+	hour, min, sec := dtstart.Clock()
+
+	count := 0
+	for period := rule.periodStart(dtstart); period.Before(to); period = rule.nextPeriod(period) {
+		for _, day := range rule.setPos(rule.dayset(period)) {
+			occ := time.Date(day.Year(), day.Month(), day.Day(), hour, min, sec, 0, dtstart.Location())
+			if occ.Before(dtstart) {
+				continue
+			}
+			if !rule.Until.IsZero() && occ.After(rule.Until) {
+				return
+			}
+			if !occ.Before(to) {
+				return
+			}
+
+			fn(occ)
+
+			count++
+			if rule.Count > 0 && count == rule.Count {
+				return
+			}
+		}
+	}
+}
+
+// fills rule parts which are defined by the start date
+func (r *rrule) withDefaults(dtstart time.Time) rrule {
+	rule := *r
+	if len(r.ByWeekNo) > 0 || len(r.ByYearDay) > 0 || len(r.ByMonthDay) > 0 || len(r.ByDay) > 0 {
+		return rule
+	}
+
+	switch r.Freq {
+	case freqWeekly:
+		rule.ByDay = []weekdayNum{{Day: dtstart.Weekday()}}
+	case freqMonthly:
+		rule.ByMonthDay = []int{dtstart.Day()}
+	case freqYearly:
+		if len(r.ByMonth) == 0 {
+			rule.ByMonth = []int{int(dtstart.Month())}
+		}
+		rule.ByMonthDay = []int{dtstart.Day()}
+	}
+
+	return rule
+}
+
+func (r *rrule) periodStart(dtstart time.Time) time.Time {
+	y, m, d := dtstart.Date()
+	loc := dtstart.Location()
+
+	switch r.Freq {
+	case freqWeekly:
+		diff := (7 + int(dtstart.Weekday()) - int(r.WeekStart)) % 7
+		return time.Date(y, m, d-diff, 0, 0, 0, 0, loc)
+	case freqMonthly:
+		return time.Date(y, m, 1, 0, 0, 0, 0, loc)
+	case freqYearly:
+		return time.Date(y, 1, 1, 0, 0, 0, 0, loc)
+	}
+
+	return time.Date(y, m, d, 0, 0, 0, 0, loc)
+}
+
+func (r *rrule) nextPeriod(period time.Time) time.Time {
+	switch r.Freq {
+	case freqWeekly:
+		return period.AddDate(0, 0, 7*r.Interval)
+	case freqMonthly:
+		return period.AddDate(0, r.Interval, 0)
+	case freqYearly:
+		return period.AddDate(r.Interval, 0, 0)
+	}
+
+	return period.AddDate(0, 0, r.Interval)
+}
+
+// returns the filtered days of the period
+func (r *rrule) dayset(period time.Time) []time.Time {
+	first, last := period, period
+	switch r.Freq {
+	case freqWeekly:
+		last = period.AddDate(0, 0, 6)
+	case freqMonthly:
+		last = period.AddDate(0, 1, -1)
+	case freqYearly:
+		last = period.AddDate(1, 0, -1)
+		if len(r.ByWeekNo) > 0 {
+			// the first and the last weeks can contain days of the adjacent years
+			first = first.AddDate(0, 0, -7)
+			last = last.AddDate(0, 0, 7)
+		}
+	}
+
+	days := make([]time.Time, 0, 7)
+	for day := first; !day.After(last); day = day.AddDate(0, 0, 1) {
+		if r.matches(day, period.Year()) {
+			days = append(days, day)
+		}
+	}
+
+	return days
+}
+
+func (r *rrule) matches(day time.Time, year int) bool {
+	if len(r.ByMonth) > 0 && !contains(r.ByMonth, int(day.Month())) {
+		return false
+	}
+
+	if len(r.ByWeekNo) > 0 {
+		wYear, wNum, total := weekNo(day, r.WeekStart)
+		if wYear != year || !containsOrdinal(r.ByWeekNo, wNum, total) {
+			return false
+		}
+	}
+
+	if len(r.ByYearDay) > 0 && !containsOrdinal(r.ByYearDay, day.YearDay(), yearDays(day.Year())) {
+		return false
+	}
+
+	mDays := monthDays(day.Year(), day.Month())
+	if len(r.ByMonthDay) > 0 && !containsOrdinal(r.ByMonthDay, day.Day(), mDays) {
+		return false
+	}
+
+	if len(r.ByDay) > 0 {
+		inMonth := r.Freq == freqMonthly || (r.Freq == freqYearly && len(r.ByMonth) > 0)
+		matched := false
+		for _, wd := range r.ByDay {
+			if wd.Day != day.Weekday() {
+				continue
+			}
+
+			if wd.N == 0 || r.Freq == freqDaily || r.Freq == freqWeekly {
+				matched = true
+			} else if inMonth {
+				matched = nthWeekday(wd.N, day.Day(), mDays)
+			} else {
+				matched = nthWeekday(wd.N, day.YearDay(), yearDays(day.Year()))
+			}
+
+			if matched {
+				break
+			}
+		}
+
+		if !matched {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (r *rrule) setPos(days []time.Time) []time.Time {
+	if len(r.BySetPos) == 0 || len(days) == 0 {
+		return days
+	}
+
+	indexes := make([]int, 0, len(r.BySetPos))
+	for _, pos := range r.BySetPos {
+		i := pos - 1
+		if pos < 0 {
+			i = len(days) + pos
+		}
+		if i >= 0 && i < len(days) && !contains(indexes, i) {
+			indexes = append(indexes, i)
+		}
+	}
+	sort.Ints(indexes)
+
+	out := make([]time.Time, len(indexes))
+	for i, index := range indexes {
+		out[i] = days[index]
+	}
+
+	return out
+}
+
+// returns the week-numbering year, the week number and the number of weeks in that year
+func weekNo(day time.Time, wkst time.Weekday) (int, int, int) {
+	mid := weekMiddle(day, wkst)
+	year := mid.Year()
+
+	last := weekMiddle(time.Date(year, 12, 28, 0, 0, 0, 0, day.Location()), wkst)
+	return year, (mid.YearDay()-1)/7 + 1, (last.YearDay()-1)/7 + 1
+}
+
+// the week belongs to the year which contains at least 4 days of it
+func weekMiddle(day time.Time, wkst time.Weekday) time.Time {
+	diff := (7 + int(day.Weekday()) - int(wkst)) % 7
+	return day.AddDate(0, 0, 3-diff)
+}
+
+// checks if the position is the n-th (or the n-th from the end) occurrence of the weekday
+func nthWeekday(n, pos, total int) bool {
+	if n > 0 {
+		return (pos-1)/7+1 == n
+	}
+
+	return -((total-pos)/7 + 1) == n
+}
+
+func containsOrdinal(list []int, pos, total int) bool {
+	return contains(list, pos) || contains(list, pos-total-1)
+}
+
+func contains(list []int, value int) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+func monthDays(year int, month time.Month) int {
+	return time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
+
+func yearDays(year int) int {
+	return time.Date(year, 12, 31, 0, 0, 0, 0, time.UTC).YearDay()
+}
@@ -0,0 +1,210 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseRule(t *testing.T) {
+	cases := []struct {
+		rrule  string
+		weekly bool
+		err    bool
+	}{
+		{rrule: "FREQ=WEEKLY;INTERVAL=1;BYDAY=MO,WE,FR", weekly: true},
+		{rrule: "BYDAY=SA,SU;FREQ=WEEKLY;INTERVAL=1", weekly: true},
+		{rrule: "freq=weekly;byday=mo", weekly: true},
+		{rrule: "FREQ=WEEKLY;INTERVAL=2;BYDAY=TU"},
+		{rrule: "FREQ=WEEKLY;BYDAY=TU;COUNT=10"},
+		{rrule: "FREQ=WEEKLY;BYDAY=TU;UNTIL=20250101T000000Z"},
+		{rrule: "FREQ=MONTHLY;BYDAY=1MO"},
+		{rrule: "FREQ=MONTHLY;BYDAY=MO,TU,WE,TH,FR;BYSETPOS=-1"},
+		{rrule: "FREQ=YEARLY;BYWEEKNO=20;BYDAY=MO"},
+		{rrule: "FREQ=DAILY"},
+		{rrule: "INTERVAL=1;BYDAY=MO", err: true},
+		{rrule: "FREQ=HOURLY", err: true},
+		{rrule: "FREQ=DAILY;BYHOUR=9", err: true},
+		{rrule: "FREQ=DAILY;INTERVAL=0", err: true},
+		{rrule: "FREQ=WEEKLY;BYDAY=XX", err: true},
+		{rrule: "FREQ=WEEKLY;BYMONTHDAY=1", err: true},
+		{rrule: "FREQ=MONTHLY;BYWEEKNO=1", err: true},
+		{rrule: "FREQ=DAILY;COUNT=2;UNTIL=20250101", err: true},
+		{rrule: "FREQ=MONTHLY;BYMONTHDAY=32", err: true},
+	}
+
+	for _, c := range cases {
+		rule, err := parseRule(c.rrule)
+		if c.err {
+			if err == nil {
+				t.Fatalf("%s: expected error", c.rrule)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", c.rrule, err)
+		}
+		if rule.isWeekly() != c.weekly {
+			t.Fatalf("%s: expected weekly %v", c.rrule, c.weekly)
+		}
+	}
+}
+
+func TestRuleBetween(t *testing.T) {
+	date := func(y int, m time.Month, d int) time.Time {
+		return time.Date(y, m, d, 9, 0, 0, 0, time.UTC)
+	}
+
+	cases := []struct {
+		rrule   string
+		dtstart time.Time
+		from    time.Time
+		to      time.Time
+		dates   []time.Time
+	}{
+		// every other Tuesday
+		{
+			rrule:   "FREQ=WEEKLY;INTERVAL=2;BYDAY=TU",
+			dtstart: date(2025, 1, 7),
+			from:    date(2025, 1, 1),
+			to:      date(2025, 2, 10),
+			dates:   []time.Time{date(2025, 1, 7), date(2025, 1, 21), date(2025, 2, 4)},
+		},
+		// the first Monday of the month
+		{
+			rrule:   "FREQ=MONTHLY;BYDAY=1MO",
+			dtstart: date(2025, 1, 1),
+			from:    date(2025, 1, 1),
+			to:      date(2025, 4, 1),
+			dates:   []time.Time{date(2025, 1, 6), date(2025, 2, 3), date(2025, 3, 3)},
+		},
+		// the last working day of the month
+		{
+			rrule:   "FREQ=MONTHLY;BYDAY=MO,TU,WE,TH,FR;BYSETPOS=-1",
+			dtstart: date(2025, 1, 1),
+			from:    date(2025, 1, 1),
+			to:      date(2025, 4, 1),
+			dates:   []time.Time{date(2025, 1, 31), date(2025, 2, 28), date(2025, 3, 31)},
+		},
+		// the last day of the month
+		{
+			rrule:   "FREQ=MONTHLY;BYMONTHDAY=-1",
+			dtstart: date(2024, 1, 1),
+			from:    date(2024, 1, 1),
+			to:      date(2024, 4, 1),
+			dates:   []time.Time{date(2024, 1, 31), date(2024, 2, 29), date(2024, 3, 31)},
+		},
+		// the 31st is skipped in short months
+		{
+			rrule:   "FREQ=MONTHLY",
+			dtstart: date(2025, 1, 31),
+			from:    date(2025, 1, 1),
+			to:      date(2025, 6, 1),
+			dates:   []time.Time{date(2025, 1, 31), date(2025, 3, 31), date(2025, 5, 31)},
+		},
+		// COUNT is calculated from the start
+		{
+			rrule:   "FREQ=DAILY;COUNT=5",
+			dtstart: date(2025, 1, 1),
+			from:    date(2025, 1, 3),
+			to:      date(2025, 2, 1),
+			dates:   []time.Time{date(2025, 1, 3), date(2025, 1, 4), date(2025, 1, 5)},
+		},
+		// UNTIL is inclusive
+		{
+			rrule:   "FREQ=WEEKLY;BYDAY=MO,FR;UNTIL=20250113T090000Z",
+			dtstart: date(2025, 1, 1),
+			from:    date(2025, 1, 1),
+			to:      date(2025, 2, 1),
+			dates:   []time.Time{date(2025, 1, 3), date(2025, 1, 6), date(2025, 1, 10), date(2025, 1, 13)},
+		},
+		// every 3 days
+		{
+			rrule:   "FREQ=DAILY;INTERVAL=3",
+			dtstart: date(2025, 1, 30),
+			from:    date(2025, 1, 1),
+			to:      date(2025, 2, 6),
+			dates:   []time.Time{date(2025, 1, 30), date(2025, 2, 2), date(2025, 2, 5)},
+		},
+		// weekly without BYDAY uses the weekday of the start
+		{
+			rrule:   "FREQ=WEEKLY",
+			dtstart: date(2025, 1, 8),
+			from:    date(2025, 1, 1),
+			to:      date(2025, 1, 23),
+			dates:   []time.Time{date(2025, 1, 8), date(2025, 1, 15), date(2025, 1, 22)},
+		},
+		// Thanksgiving
+		{
+			rrule:   "FREQ=YEARLY;BYMONTH=11;BYDAY=4TH",
+			dtstart: date(2024, 1, 1),
+			from:    date(2024, 1, 1),
+			to:      date(2027, 1, 1),
+			dates:   []time.Time{date(2024, 11, 28), date(2025, 11, 27), date(2026, 11, 26)},
+		},
+		// Monday of the first week (ISO)
+		{
+			rrule:   "FREQ=YEARLY;BYWEEKNO=1;BYDAY=MO",
+			dtstart: date(2024, 1, 1),
+			from:    date(2024, 1, 1),
+			to:      date(2027, 1, 1),
+			dates:   []time.Time{date(2024, 1, 1), date(2024, 12, 30), date(2025, 12, 29)},
+		},
+		// the 100th day of the year
+		{
+			rrule:   "FREQ=YEARLY;BYYEARDAY=100",
+			dtstart: date(2024, 1, 1),
+			from:    date(2024, 1, 1),
+			to:      date(2026, 1, 1),
+			dates:   []time.Time{date(2024, 4, 9), date(2025, 4, 10)},
+		},
+		// every other week with the week starting on Sunday
+		{
+			rrule:   "FREQ=WEEKLY;INTERVAL=2;BYDAY=SU,MO;WKST=SU",
+			dtstart: date(2025, 1, 5),
+			from:    date(2025, 1, 1),
+			to:      date(2025, 1, 21),
+			dates:   []time.Time{date(2025, 1, 5), date(2025, 1, 6), date(2025, 1, 19), date(2025, 1, 20)},
+		},
+	}
+
+	for _, c := range cases {
+		rule, err := parseRule(c.rrule)
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", c.rrule, err)
+		}
+
+		dates := rule.between(c.dtstart, c.from, c.to)
+		if !reflect.DeepEqual(c.dates, dates) {
+			t.Fatalf("%s: expected %v, got %v", c.rrule, c.dates, dates)
+		}
+	}
+}
+
+func TestRuleLast(t *testing.T) {
+	dtstart := time.Date(2025, 1, 7, 9, 0, 0, 0, time.UTC)
+
+	rule, _ := parseRule("FREQ=WEEKLY;INTERVAL=2;BYDAY=TU;COUNT=3")
+	last, ok := rule.last(dtstart)
+	if !ok || !last.Equal(time.Date(2025, 2, 4, 9, 0, 0, 0, time.UTC)) {
+		t.Fatalf("expected 2025-02-04 09:00, got %v", last)
+	}
+
+	// sparse occurrences are counted beyond COUNT years
+	rule, _ = parseRule("FREQ=YEARLY;BYMONTH=2;BYMONTHDAY=29;COUNT=3")
+	last, ok = rule.last(dtstart)
+	if !ok || !last.Equal(time.Date(2036, 2, 29, 9, 0, 0, 0, time.UTC)) {
+		t.Fatalf("expected 2036-02-29 09:00, got %v", last)
+	}
+
+	rule, _ = parseRule("FREQ=YEARLY;BYMONTH=2;BYMONTHDAY=30;COUNT=3")
+	if _, ok := rule.last(dtstart); ok {
+		t.Fatalf("rule without occurrences can't have the last occurrence")
+	}
+
+	rule, _ = parseRule("FREQ=WEEKLY;BYDAY=TU")
+	if _, ok := rule.last(dtstart); ok {
+		t.Fatalf("endless rule can't have the last occurrence")
+	}
+}
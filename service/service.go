@@ -1,19 +1,87 @@
 package service
 
-import "scheduler-booking/data"
+import (
+	"scheduler-booking/data"
+)
+
+type Config struct {
+	HoldTime  int   `yaml:"holdTime" default:"10"`  // in minutes
+	ClaimTime int   `yaml:"claimTime" default:"60"` // in minutes, offers of freed slots to the waitlist expire after it
+	Window    int   `yaml:"window" default:"60"`    // in days, the default interval of units and worktime
+	Notify    bool  `yaml:"-"`                      // messages of reservations are queued to the outbox
+	Reminders []int `yaml:"reminders"`              // in minutes before reservations, e.g. [1440, 60], they are sent if Notify is set
+}
 
 type ServiceAll struct {
+	Clock data.Clock
+
 	Doctors      *doctorsService
 	Worktime     *worktimeService
 	Reservations *reservationsService
 	Units        *unitsService
+	Reviews      *reviewsService
+	Closures     *closuresService
+	TimeOff      *timeOffService
+	ServiceTypes *serviceTypesService
+	Waitlist     *waitlistService
+	Reminders    *remindersService
 }
 
-func NewService(dao *data.DAO) *ServiceAll {
+// services work with any storage, e.g. the DAO or data.NewMemory(),
+// and get the current time from its clock
+func NewService(repo data.Repositories, config Config) *ServiceAll {
+	clock := repo.Clock
+	reservations := &reservationsService{repo: repo, config: config, clock: clock}
+	reservations.waitlist = &waitlistService{repo: repo, config: config, clock: clock, reservations: reservations}
 	return &ServiceAll{
-		Doctors:      &doctorsService{dao},
-		Reservations: &reservationsService{dao},
-		Worktime:     &worktimeService{dao},
-		Units:        &unitsService{dao},
+		Clock:        clock,
+		Doctors:      &doctorsService{repo: repo, reservations: reservations},
+		Reservations: reservations,
+		Worktime:     &worktimeService{repo: repo, config: config, clock: clock},
+		Units:        &unitsService{repo: repo, config: config, clock: clock},
+		Reviews:      &reviewsService{repo: repo, clock: clock},
+		Closures:     &closuresService{repo: repo, config: config, clock: clock},
+		TimeOff:      &timeOffService{repo: repo, config: config, clock: clock},
+		ServiceTypes: &serviceTypesService{repo},
+		Waitlist:     reservations.waitlist,
+		Reminders:    &remindersService{repo: repo, config: config, clock: clock, reservations: reservations},
+	}
+}
+
+const maxWindow = 366 * allDayMilli // in milliseconds
+
+// returns the interval of whole dates which includes [from, to) (in milliseconds),
+// by default it starts yesterday to cover the current date in all time zones
+// and lasts for the configured number of days
+func (c Config) window(clock data.Clock, from, to int64) (data.Window, error) {
+	today := clock.Today().UnixMilli()
+	if to == 0 {
+		start := from
+		if start == 0 {
+			start = today
+		}
+		to = start + int64(c.Window)*allDayMilli
+	}
+	if from == 0 {
+		from = today - allDayMilli
 	}
+
+	if to <= from {
+		return data.Window{}, invalidField("to", "invalid time interval")
+	}
+	if to-from > maxWindow {
+		return data.Window{}, invalidField("to", "time interval can't be longer than %d days", maxWindow/allDayMilli)
+	}
+
+	return dateWindow(from, to), nil
+}
+
+// returns the interval of whole dates which includes [from, to)
+func dateWindow(from, to int64) data.Window {
+	from -= from % allDayMilli
+	if rem := to % allDayMilli; rem != 0 {
+		to += allDayMilli - rem
+	}
+
+	return data.Window{From: from, To: to}
 }
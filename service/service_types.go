@@ -0,0 +1,177 @@
+package service
+
+import (
+	"fmt"
+	"scheduler-booking/data"
+	"strings"
+)
+
+// patients of the group session
+const maxCapacity = 100
+
+type serviceTypesService struct {
+	repo data.Repositories
+}
+
+type ServiceTypeForm struct {
+	DoctorID int    `json:"doctor_id"`
+	Name     string `json:"name"`
+	Duration int    `json:"duration"` // in minutes
+	Buffer   int    `json:"buffer"`   // in minutes after the appointment
+	Price    string `json:"price"`
+	Capacity int    `json:"capacity"` // patients of the group session, 1 by default
+}
+
+// returns services of the doctor
+func (s *serviceTypesService) GetAll(doctorID int) ([]data.ServiceType, error) {
+	doctor, err := s.repo.Doctors.GetOne(doctorID)
+	if err != nil {
+		return nil, err
+	}
+	if doctor.ID == 0 {
+		return nil, doctorNotFound(doctorID)
+	}
+
+	return s.repo.Services.GetAll(doctorID)
+}
+
+func (s *serviceTypesService) GetOne(id int) (data.ServiceType, error) {
+	service, err := s.repo.Services.GetOne(id)
+	if err != nil {
+		return service, err
+	}
+	if service.ID == 0 {
+		return service, serviceNotFound(id)
+	}
+
+	return service, nil
+}
+
+func (s *serviceTypesService) Add(form ServiceTypeForm) (int, error) {
+	if err := s.validate(&form); err != nil {
+		return 0, err
+	}
+
+	service := form.toServiceType()
+	return s.repo.Services.Add(&service)
+}
+
+func (s *serviceTypesService) Update(id int, form ServiceTypeForm) error {
+	if _, err := s.GetOne(id); err != nil {
+		return err
+	}
+
+	if err := s.validate(&form); err != nil {
+		return err
+	}
+
+	service := form.toServiceType()
+	service.ID = id
+	return s.repo.Services.Update(service)
+}
+
+// deletes the service, its reservations keep their durations
+func (s *serviceTypesService) Delete(id int) error {
+	if _, err := s.GetOne(id); err != nil {
+		return err
+	}
+
+	return s.repo.Services.Delete(id)
+}
+
+func (s *serviceTypesService) validate(f *ServiceTypeForm) error {
+	doctor, err := s.repo.Doctors.GetOne(f.DoctorID)
+	if err != nil {
+		return err
+	}
+	if doctor.ID == 0 {
+		return doctorNotFound(f.DoctorID)
+	}
+
+	f.Name = strings.TrimSpace(f.Name)
+	f.Price = strings.TrimSpace(f.Price)
+
+	fields := make([]FieldError, 0)
+	if f.Name == "" {
+		fields = append(fields, FieldError{Field: "name", Message: "name is required"})
+	}
+	if f.Duration <= 0 || f.Duration > allDay {
+		fields = append(fields, FieldError{Field: "duration", Message: fmt.Sprintf("duration must be between 1 and %d minutes", allDay)})
+	}
+	if f.Buffer < 0 || f.Buffer > allDay {
+		fields = append(fields, FieldError{Field: "buffer", Message: fmt.Sprintf("buffer must be between 0 and %d minutes", allDay)})
+	}
+	if f.Capacity == 0 {
+		f.Capacity = 1
+	}
+	if f.Capacity < 0 || f.Capacity > maxCapacity {
+		fields = append(fields, FieldError{Field: "capacity", Message: fmt.Sprintf("capacity must be between 1 and %d", maxCapacity)})
+	}
+	if f.Price == "" {
+		f.Price = doctor.Price
+	} else if !priceFormat.MatchString(f.Price) {
+		fields = append(fields, FieldError{Field: "price", Message: fmt.Sprintf("invalid price %q, expected format is $45 or 45.50", f.Price)})
+	}
+
+	return invalid(fields...)
+}
+
+func (f ServiceTypeForm) toServiceType() data.ServiceType {
+	return data.ServiceType{
+		DoctorID: f.DoctorID,
+		Name:     f.Name,
+		Duration: f.Duration,
+		Buffer:   f.Buffer,
+		Price:    f.Price,
+		Capacity: f.Capacity,
+	}
+}
+
+// booked time of the reservation, zero durations mean one slot of the doctor
+type appointment struct {
+	serviceID int
+	duration  int // in minutes
+	buffer    int // in minutes
+	capacity  int // seats of the group session, 0 means the only one
+}
+
+// returns the booked time of the service of the doctor, 0 means one slot of the doctor
+func getAppointment(repo data.Repositories, doctorID, serviceID int) (appointment, error) {
+	if serviceID == 0 {
+		return appointment{}, nil
+	}
+
+	service, err := repo.Services.GetOne(serviceID)
+	if err != nil {
+		return appointment{}, err
+	}
+	if service.ID == 0 || service.DoctorID != doctorID {
+		return appointment{}, serviceNotFound(serviceID)
+	}
+
+	return appointment{serviceID: service.ID, duration: service.Duration, buffer: service.Buffer, capacity: service.Capacity}, nil
+}
+
+// returns the occupied time (in minutes) of the appointment with the slot size of the doctor
+func (a appointment) length(size int) int {
+	if a.duration == 0 {
+		return size
+	}
+
+	return a.duration + a.buffer
+}
+
+// checks if the appointment can take a seat of the group session with the reservations
+func (a appointment) joins(session []data.OccupiedSlot) bool {
+	capacity := data.OccupiedSlot{Capacity: a.capacity}.Seats()
+	for _, record := range session {
+		if record.ServiceID != a.serviceID {
+			return false
+		}
+		if seats := record.Seats(); seats < capacity {
+			capacity = seats
+		}
+	}
+
+	return len(session) < capacity
+}
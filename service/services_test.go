@@ -0,0 +1,163 @@
+package service
+
+import (
+	"reflect"
+	"scheduler-booking/data"
+	"testing"
+	"time"
+)
+
+// checks that reservations of services occupy consecutive slots of the doctor
+func TestServiceTypes(t *testing.T) {
+	runStorages(t, testServiceTypes)
+}
+
+func testServiceTypes(t *testing.T, open openFunc) {
+	f := newFixture(t, open, Config{HoldTime: 10, Window: 60})
+	s := f.s
+	doctor := f.addDoctor(data.Doctor{Name: "Dr. Services", SlotSize: 20, Price: "$30"}, 9*60, 12*60)
+	other := f.addDoctor(data.Doctor{Name: "Dr. Other", SlotSize: 30}, 0, 0)
+
+	intake, err := s.ServiceTypes.Add(ServiceTypeForm{DoctorID: doctor.ID, Name: "Intake", Duration: 60, Buffer: 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	foreign, err := s.ServiceTypes.Add(ServiceTypeForm{DoctorID: other.ID, Name: "Follow-up", Duration: 30, Price: "$20"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if services, err := s.ServiceTypes.GetAll(doctor.ID); err != nil || len(services) != 1 || services[0].Price != "$30" {
+		t.Fatalf("expected the intake with the price of the doctor, got %+v (%v)", services, err)
+	}
+
+	available := func(service int) []int64 {
+		return f.available(doctor.ID, 7, service).AvailableSlots
+	}
+	book := func(date int64, service int) (int, string) {
+		return f.book(Reservation{DoctorID: doctor.ID, Date: date, ServiceID: service})
+	}
+
+	if _, code := book(at(7, 11, 0), 0); code != "" {
+		t.Fatalf("expected the reservation of one slot, got %q", code)
+	}
+
+	// the intake with its buffer takes 80 minutes and must end before 11:00
+	expected := []int64{at(7, 9, 0), at(7, 9, 20), at(7, 9, 40)}
+	if slots := available(intake); !reflect.DeepEqual(slots, expected) {
+		t.Fatalf("expected intake slots %v, got %v", expected, slots)
+	}
+
+	id, code := book(at(7, 9, 0), intake)
+	if code != "" {
+		t.Fatalf("expected the intake, got %q", code)
+	}
+	expected = []int64{at(7, 10, 20), at(7, 10, 40), at(7, 11, 20), at(7, 11, 40)}
+	if slots := available(0); !reflect.DeepEqual(slots, expected) {
+		t.Fatalf("expected slots %v, got %v", expected, slots)
+	}
+
+	cases := []struct {
+		date    int64
+		service int
+		code    string
+	}{
+		{date: at(7, 10, 0), code: "slot_taken"},                       // buffer of the intake
+		{date: at(7, 10, 20), service: intake, code: "slot_taken"},     // overlaps the reservation at 11:00
+		{date: at(7, 11, 20), service: intake, code: "slot_not_found"}, // the work time ends at 12:00
+		{date: at(7, 10, 20), service: foreign, code: "service_not_found"},
+	}
+	for _, c := range cases {
+		if _, code := book(c.date, c.service); code != c.code {
+			t.Fatalf("%s: expected %q, got %q", time.UnixMilli(c.date).UTC(), c.code, code)
+		}
+	}
+
+	// the moved intake doesn't block its own time
+	if err := s.Reservations.Reschedule(id, Rescheduling{Date: at(7, 9, 20)}, "test"); err != nil {
+		t.Fatalf("expected the intake to be moved, got %v", err)
+	}
+	expected = []int64{at(7, 9, 0), at(7, 10, 40), at(7, 11, 20), at(7, 11, 40)}
+	if slots := available(0); !reflect.DeepEqual(slots, expected) {
+		t.Fatalf("expected slots %v, got %v", expected, slots)
+	}
+}
+
+// checks that group sessions take reservations until they are full
+func TestGroupSessions(t *testing.T) {
+	runStorages(t, testGroupSessions)
+}
+
+func testGroupSessions(t *testing.T, open openFunc) {
+	f := newFixture(t, open, Config{HoldTime: 10, Window: 60})
+	s := f.s
+	doctor := f.addDoctor(data.Doctor{Name: "Dr. Group", SlotSize: 30}, 9*60, 11*60)
+
+	if _, err := s.ServiceTypes.Add(ServiceTypeForm{DoctorID: doctor.ID, Name: "Group", Duration: 60, Capacity: maxCapacity + 1}); AsError(err).Code != "validation_failed" {
+		t.Fatalf("expected validation_failed for the capacity, got %v", err)
+	}
+	group, err := s.ServiceTypes.Add(ServiceTypeForm{DoctorID: doctor.ID, Name: "Group", Duration: 60, Capacity: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	available := func(service int) Unit {
+		return f.available(doctor.ID, 7, service)
+	}
+	book := func(date int64, service int) (int, string) {
+		return f.book(Reservation{DoctorID: doctor.ID, Date: date, ServiceID: service})
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, code := book(at(7, 9, 30), group); code != "" {
+			t.Fatalf("expected the seat of the session, got %q", code)
+		}
+	}
+
+	// the session keeps its start for patients of the service only
+	unit := available(group)
+	expected := []int64{at(7, 9, 30)}
+	if !reflect.DeepEqual(unit.AvailableSlots, expected) || unit.Seats[at(7, 9, 30)] != 1 {
+		t.Fatalf("expected slots %v with the last seat, got %v %v", expected, unit.AvailableSlots, unit.Seats)
+	}
+	expected = []int64{at(7, 9, 0), at(7, 10, 30)}
+	if slots := available(0).AvailableSlots; !reflect.DeepEqual(slots, expected) {
+		t.Fatalf("expected slots %v around the session, got %v", expected, slots)
+	}
+	if _, code := book(at(7, 9, 30), 0); code != "slot_taken" {
+		t.Fatalf("expected slot_taken for another service, got %q", code)
+	}
+
+	units, err := s.Units.GetAll(at(7, 0, 0), at(7, 23, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if containsStamp(units[0].UsedSlots, at(7, 9, 30)) || units[0].Seats[at(7, 9, 30)] != 1 {
+		t.Fatalf("expected the session with the free seat, got %v %v", units[0].UsedSlots, units[0].Seats)
+	}
+
+	last, code := book(at(7, 9, 30), group)
+	if code != "" {
+		t.Fatalf("expected the last seat, got %q", code)
+	}
+	if _, code := book(at(7, 9, 30), group); code != "slot_taken" {
+		t.Fatalf("expected slot_taken for the full session, got %q", code)
+	}
+	units, err = s.Units.GetAll(at(7, 0, 0), at(7, 23, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !containsStamp(units[0].UsedSlots, at(7, 9, 30)) || len(units[0].Seats) != 0 {
+		t.Fatalf("expected the full session to be used, got %v %v", units[0].UsedSlots, units[0].Seats)
+	}
+	if records, err := s.Reservations.GetAll(); err != nil || len(records) != 3 {
+		t.Fatalf("expected reservations of the session, got %+v (%v)", records, err)
+	}
+
+	// the cancelled seat is free again
+	if err := s.Reservations.Cancel(last, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if unit := available(group); unit.Seats[at(7, 9, 30)] != 1 {
+		t.Fatalf("expected the free seat, got %v", unit.Seats)
+	}
+}
@@ -0,0 +1,252 @@
+package service
+
+import (
+	"scheduler-booking/common"
+	"scheduler-booking/data"
+	"strings"
+	"time"
+)
+
+type timeOffService struct {
+	repo   data.Repositories
+	config Config
+	clock  data.Clock
+}
+
+// time off is set in the wall clock of the doctor's time zone
+type TimeOffForm struct {
+	DoctorID  int           `json:"doctor_id"`
+	StartDate *common.JDate `json:"start_date"`
+	EndDate   *common.JDate `json:"end_date"`
+	Reason    string        `json:"reason"`
+}
+
+type TimeOffStr struct {
+	ID        int    `json:"id"`
+	DoctorID  int    `json:"doctor_id"`
+	StartDate string `json:"start_date"`
+	EndDate   string `json:"end_date"`
+	Reason    string `json:"reason"`
+	Conflicts []int  `json:"conflicts"` // upcoming reservations within the time off
+}
+
+// returns time off which overlaps the [from, to) interval with conflicting reservations,
+// the default interval is set by the config
+func (s *timeOffService) GetAll(from, to int64) ([]TimeOffStr, error) {
+	window, err := s.config.window(s.clock, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	timeOff, err := s.repo.TimeOff.GetAll(window)
+	if err != nil {
+		return nil, err
+	}
+
+	conflicts, err := timeOffConflicts(s.repo, s.clock.Now().UnixMilli(), timeOff)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]TimeOffStr, 0, len(timeOff))
+	for _, t := range timeOff {
+		out = append(out, TimeOffStr{
+			ID:        t.ID,
+			DoctorID:  t.DoctorID,
+			StartDate: time.UnixMilli(t.StartDate).UTC().Format(strFormat),
+			EndDate:   time.UnixMilli(t.EndDate).UTC().Format(strFormat),
+			Reason:    t.Reason,
+			Conflicts: conflicts[t.ID],
+		})
+	}
+
+	return out, nil
+}
+
+func (s *timeOffService) GetOne(id int) (data.TimeOff, error) {
+	timeOff, err := s.repo.TimeOff.GetOne(id)
+	if err != nil {
+		return timeOff, err
+	}
+	if timeOff.ID == 0 {
+		return timeOff, notFound("time_off_not_found", "time off with id %d not found", id)
+	}
+
+	return timeOff, nil
+}
+
+func (s *timeOffService) Add(form TimeOffForm) (int, error) {
+	if err := s.validate(&form); err != nil {
+		return 0, err
+	}
+
+	timeOff := form.toTimeOff()
+	return s.repo.TimeOff.Add(&timeOff)
+}
+
+func (s *timeOffService) Update(id int, form TimeOffForm) error {
+	if _, err := s.GetOne(id); err != nil {
+		return err
+	}
+
+	if err := s.validate(&form); err != nil {
+		return err
+	}
+
+	timeOff := form.toTimeOff()
+	timeOff.ID = id
+	return s.repo.TimeOff.Update(timeOff)
+}
+
+func (s *timeOffService) Delete(id int) error {
+	if _, err := s.GetOne(id); err != nil {
+		return err
+	}
+
+	return s.repo.TimeOff.Delete(id)
+}
+
+// returns IDs of upcoming reservations within the time off by its ID
+func timeOffConflicts(repo data.Repositories, now int64, timeOff []data.TimeOff) (map[int][]int, error) {
+	out := make(map[int][]int, len(timeOff))
+	locations := make(map[int]*time.Location)
+	for _, t := range timeOff {
+		out[t.ID] = make([]int, 0)
+
+		loc, ok := locations[t.DoctorID]
+		if !ok {
+			doctor, err := repo.Doctors.GetOne(t.DoctorID)
+			if err != nil {
+				return nil, err
+			}
+			if doctor.ID != 0 {
+				loc = doctor.Location()
+			}
+			locations[t.DoctorID] = loc
+		}
+		if loc == nil {
+			continue
+		}
+
+		reservations, err := repo.OccupiedSlots.GetOverlapping(t.DoctorID, data.FromWall(t.StartDate, loc), data.FromWall(t.EndDate, loc))
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range reservations {
+			if r.Date >= now {
+				out[t.ID] = append(out[t.ID], r.ID)
+			}
+		}
+	}
+
+	return out, nil
+}
+
+func (s *timeOffService) validate(f *TimeOffForm) error {
+	doctor, err := s.repo.Doctors.GetOne(f.DoctorID)
+	if err != nil {
+		return err
+	}
+	if doctor.ID == 0 {
+		return doctorNotFound(f.DoctorID)
+	}
+
+	if f.StartDate == nil || f.EndDate == nil {
+		return invalidField("start_date", "start and end dates are required")
+	}
+
+	f.Reason = strings.TrimSpace(f.Reason)
+	if f.StartDate.UnixMilli() >= f.EndDate.UnixMilli() {
+		return invalidField("end_date", "invalid time interval")
+	}
+
+	return nil
+}
+
+func (f TimeOffForm) toTimeOff() data.TimeOff {
+	return data.TimeOff{
+		DoctorID:  f.DoctorID,
+		StartDate: f.StartDate.UnixMilli(),
+		EndDate:   f.EndDate.UnixMilli(),
+		Reason:    f.Reason,
+	}
+}
+
+// interval of the wall clock when the doctor doesn't accept bookings
+type absence struct {
+	from, to int64
+}
+
+// returns whether the slot starting at the time (wall clock) overlaps the absence
+func (a absence) overlaps(wall int64, size int) bool {
+	return a.from < wall+int64(size)*minuteMilli && wall < a.to
+}
+
+// closures of the clinic and time off of doctors
+type absences struct {
+	closures []data.Closure
+	timeOff  []data.TimeOff
+}
+
+// returns closures and time off which overlap the interval
+func getAbsences(repo data.Repositories, window data.Window) (absences, error) {
+	closures, err := repo.Closures.GetAll(window)
+	if err != nil {
+		return absences{}, err
+	}
+
+	timeOff, err := repo.TimeOff.GetAll(window)
+	if err != nil {
+		return absences{}, err
+	}
+
+	return absences{closures, timeOff}, nil
+}
+
+// returns intervals when the doctor doesn't accept bookings
+func (a absences) of(doctor data.Doctor) []absence {
+	out := make([]absence, 0)
+	for _, c := range closuresOf(doctor, a.closures) {
+		out = append(out, absence{c.StartDate, c.EndDate})
+	}
+	for _, t := range timeOffOf(doctor, a.timeOff) {
+		out = append(out, absence{t.StartDate, t.EndDate})
+	}
+
+	return out
+}
+
+// returns time off of the doctor
+func timeOffOf(doctor data.Doctor, timeOff []data.TimeOff) []data.TimeOff {
+	out := make([]data.TimeOff, 0)
+	for _, t := range timeOff {
+		if t.DoctorID == doctor.ID {
+			out = append(out, t)
+		}
+	}
+
+	return out
+}
+
+// returns starts of the unit's slots in the [from, to) interval which overlap the absences
+func absentSlots(u *Unit, list []absence, size int, from, to int64) []int64 {
+	absent := make([]int64, 0)
+	for _, a := range list {
+		// slots of the previous date can last after midnight
+		start := a.from - a.from%allDayMilli - allDayMilli
+		if start < from-from%allDayMilli {
+			start = from - from%allDayMilli
+		}
+
+		for date := start; date < to && date < a.to; date += allDayMilli {
+			for _, slot := range u.slotsOn(date) {
+				stamp := newStamp(date, slot)
+				if from <= stamp && stamp < to && a.overlaps(stamp, size) {
+					absent = append(absent, stamp)
+				}
+			}
+		}
+	}
+
+	return absent
+}
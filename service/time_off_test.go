@@ -0,0 +1,60 @@
+package service
+
+import (
+	"reflect"
+	"scheduler-booking/data"
+	"testing"
+)
+
+// checks that reservations overlapping time off are reported as conflicts
+func TestTimeOffConflicts(t *testing.T) {
+	runStorages(t, testTimeOffConflicts)
+}
+
+func testTimeOffConflicts(t *testing.T, open openFunc) {
+	f := newFixture(t, open, Config{HoldTime: 10, Window: 60})
+	doctor := f.addDoctor(data.Doctor{Name: "Dr. Away", SlotSize: 30}, 9*60, 13*60)
+
+	intake, err := f.s.ServiceTypes.Add(ServiceTypeForm{DoctorID: doctor.ID, Name: "Intake", Duration: 60})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the intake lasts into the time off, the plain reservation ends at its start
+	long, code := f.book(Reservation{DoctorID: doctor.ID, Date: at(7, 9, 30), ServiceID: intake})
+	if code != "" {
+		t.Fatalf("expected the intake, got %q", code)
+	}
+	if _, code := f.book(Reservation{DoctorID: doctor.ID, Date: at(8, 9, 30)}); code != "" {
+		t.Fatalf("expected the reservation, got %q", code)
+	}
+
+	for _, day := range []int{7, 8} {
+		if _, err := f.repo.TimeOff.Add(&data.TimeOff{DoctorID: doctor.ID, StartDate: at(day, 10, 0), EndDate: at(day, 11, 0)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	timeOff, err := f.s.TimeOff.GetAll(at(7, 0, 0), at(9, 0, 0))
+	if err != nil || len(timeOff) != 2 {
+		t.Fatalf("expected time off of two days, got %+v (%v)", timeOff, err)
+	}
+	if !reflect.DeepEqual(timeOff[0].Conflicts, []int{long}) || len(timeOff[1].Conflicts) != 0 {
+		t.Fatalf("expected the conflict with the intake only, got %+v", timeOff)
+	}
+
+	// time off of the work time is flagged too
+	worktime, err := f.s.Worktime.GetAll(at(7, 0, 0), at(9, 0, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conflicts := make(map[int][]int)
+	for _, w := range worktime {
+		if w.Type == TypeTimeOff {
+			conflicts[w.ID] = w.Conflicts
+		}
+	}
+	if len(conflicts) != 2 || !reflect.DeepEqual(conflicts[timeOff[0].ID], []int{long}) || len(conflicts[timeOff[1].ID]) != 0 {
+		t.Fatalf("expected the conflict with the intake in the work time, got %+v", worktime)
+	}
+}
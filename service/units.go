@@ -5,28 +5,52 @@ import (
 	"regexp"
 	"scheduler-booking/common"
 	"scheduler-booking/data"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 )
 
 type unitsService struct {
-	dao *data.DAO
+	repo   data.Repositories
+	config Config
+	clock  data.Clock
 }
 
 type Unit struct {
-	ID       int         `json:"id"`
-	Title    string      `json:"title"`
-	Category string      `json:"category"`
-	Subtitle string      `json:"subtitle"`
-	Details  string      `json:"details"`
-	Preview  string      `json:"preview"`
-	Price    string      `json:"price"`
-	Review   data.Review `json:"review"`
-
-	Slots          []Schedule `json:"slots"`
-	AvailableSlots []int64    `json:"availableSlots,omitempty"`
-	UsedSlots      []int64    `json:"usedSlots,omitempty"`
+	ID       int                `json:"id"`
+	Title    string             `json:"title"`
+	Category string             `json:"category"`
+	Subtitle string             `json:"subtitle"`
+	Details  string             `json:"details"`
+	Preview  string             `json:"preview"`
+	Price    string             `json:"price"`
+	Review   data.ReviewSummary `json:"review"`
+	TimeZone string             `json:"timezone"`
+	Services []data.ServiceType `json:"services,omitempty"`
+
+	Slots          []Schedule    `json:"slots"`
+	AvailableSlots []int64       `json:"availableSlots,omitempty"`
+	UsedSlots      []int64       `json:"usedSlots,omitempty"`
+	Seats          map[int64]int `json:"seats,omitempty"` // remaining seats of group sessions by their starts
+
+	size, gap int           // slot size and gap of the doctor (in minutes)
+	sessions  map[int64]int // services of group sessions with free seats by their starts
+}
+
+// reservations starting at the same time, several ones share the group session
+type session struct {
+	serviceID int
+	count     int
+	capacity  int
+	end       int64 // wall clock, the end of the service with its buffer
+}
+
+// recurring event which is presented as days of the week
+type weeklyEvent struct {
+	schedule data.DoctorSchedule
+	days     []int
+	dates    map[int64]struct{} // dates of occurrences in the interval
 }
 
 // booking schedule
@@ -49,188 +73,415 @@ const (
 
 var week = map[string]int{"SU": 0, "MO": 1, "TU": 2, "WE": 3, "TH": 4, "FR": 5, "SA": 6}
 
-func (s *unitsService) GetAll() ([]Unit, error) {
-	doctors, err := s.dao.Doctors.GetAll(true)
+const (
+	defaultAvailableWindow = 7 * allDayMilli  // in millisecond
+	maxAvailableWindow     = 92 * allDayMilli // in millisecond
+)
+
+// returns units with schedules expanded into dates of the [from, to) interval
+// (wall clock encoded in UTC), the default interval is set by the config
+func (s *unitsService) GetAll(from, to int64) ([]Unit, error) {
+	window, err := s.config.window(s.clock, from, to)
 	if err != nil {
 		return nil, err
 	}
 
-	return createUnits(doctors, true), nil
+	return s.units(window)
 }
 
-func createUnits(doctors []data.Doctor, replace bool) []Unit {
-	today := data.DateNow() // date only
-	todayMilli := today.UnixMilli()
-	tWeekDay := int(today.Weekday())
+// returns units with start times of free slots in the [from, to) interval instead of schedules,
+// both the interval and the slots are set in the wall clock of doctors encoded in UTC
+func (s *unitsService) GetAvailable(from, to int64) ([]Unit, error) {
+	return s.GetAvailableFor(from, to, 0)
+}
 
-	units := make([]Unit, len(doctors))
-	for i, doctor := range doctors {
-		slotsDays := make(map[int][]time.Time)    // search by days
-		slotsDates := make(map[int64][]time.Time) // search by dates
+// returns available slots as GetAvailable does, if the service is set,
+// only the unit of its doctor is returned with slots where the whole service fits
+func (s *unitsService) GetAvailableFor(from, to int64, serviceID int) ([]Unit, error) {
+	if to == 0 {
+		start := from
+		if start == 0 {
+			start = s.clock.Now().UnixMilli()
+		}
+		to = start + defaultAvailableWindow
+	}
+	if from == 0 {
+		// the interval covers the current date in all time zones,
+		// past slots are skipped by the wall clock of each doctor
+		from = s.clock.Today().Add(-oneDay).UnixMilli()
+	}
+	if to <= from {
+		return nil, invalidField("to", "invalid time interval")
+	}
+	if to-from > maxAvailableWindow {
+		return nil, invalidField("to", "time interval can't be longer than %d days", maxAvailableWindow/allDayMilli)
+	}
 
-		// organization occupied slots
-		for _, occupiedSlot := range doctor.OccupiedSlots {
-			slot := time.UnixMilli(occupiedSlot.Date).UTC()
+	service := data.ServiceType{}
+	if serviceID != 0 {
+		var err error
+		service, err = s.repo.Services.GetOne(serviceID)
+		if err != nil {
+			return nil, err
+		}
+		if service.ID == 0 {
+			return nil, serviceNotFound(serviceID)
+		}
+	}
 
-			slotDay := int(slot.Weekday())
-			slotsDays[slotDay] = append(slotsDays[slotDay], slot)
+	// the service can last after the interval
+	length := int64(service.Duration+service.Buffer) * minuteMilli
+	units, err := s.units(dateWindow(from, to+length))
+	if err != nil {
+		return nil, err
+	}
 
-			slotDate := slot.Truncate(oneDay).UnixMilli()
-			slotsDates[slotDate] = append(slotsDates[slotDate], slot)
+	out := make([]Unit, 0, len(units))
+	for _, unit := range units {
+		if service.ID != 0 && unit.ID != service.DoctorID {
+			continue
 		}
 
-		routines := make([]data.DoctorSchedule, 0, len(doctor.DoctorSchedule))  // []sch
-		recurring := make([]data.DoctorSchedule, 0, len(doctor.DoctorSchedule)) // []sch
-		exceptions := make(map[string][]data.DoctorSchedule)                    // recID -> []sch
-		empty := make(map[string]map[int64]struct{})                            // recID -> map timestamp
-
-		bookedSlots := make(map[int64]struct{})
-		schedules := make([]Schedule, 0)
+		unit.AvailableSlots = unit.availableSlots(from, to, s.clock.Now(), service.ID)
+		if service.ID != 0 {
+			unit.AvailableSlots = unit.fitting(unit.AvailableSlots, service)
+		}
 
-		// separation of events
-		for _, sch := range doctor.DoctorSchedule {
-			if sch.Rrule == "" {
-				if sch.RecurringEventID != "" {
-					exceptions[sch.RecurringEventID] = append(exceptions[sch.RecurringEventID], sch)
-					continue
+		// seats are shown for group sessions of the service only
+		seats := unit.Seats
+		unit.Seats = nil
+		if service.Capacity > 1 {
+			unit.Seats = make(map[int64]int, len(unit.AvailableSlots))
+			for _, slot := range unit.AvailableSlots {
+				if n, ok := seats[slot]; ok {
+					unit.Seats[slot] = n
+				} else {
+					unit.Seats[slot] = service.Capacity
 				}
-
-				routines = append(routines, sch)
-			} else {
-				recurring = append(recurring, sch)
 			}
 		}
+		unit.Slots = []Schedule{}
+		unit.UsedSlots = nil
+		out = append(out, unit)
+	}
 
-		// exception events
-		for _, recSch := range recurring {
-			recID := strconv.Itoa(recSch.ID)
-			recDays := daysFromRules(recSch.Rrule)
+	return out, nil
+}
 
-			// check exceptions
-			empty[recID] = make(map[int64]struct{})
-			for _, excSch := range exceptions[recID] {
-				original, err := time.Parse("2006-01-02 15:04", excSch.OriginalStart)
-				if err != nil {
-					log.Printf("failed to parse original start time: %v", err)
-					continue
-				}
+func (s *unitsService) units(window data.Window) ([]Unit, error) {
+	doctors, err := s.repo.Doctors.GetAllWithSchedule(window)
+	if err != nil {
+		return nil, err
+	}
 
-				origFrom := original.Hour()*60 + original.Minute()
-				origDate := original.Truncate(oneDay).UnixMilli()
-
-				if recSch.From == origFrom && recSch.Date <= origDate {
-					origDay := int(original.Weekday())
-					for _, recDay := range recDays {
-						if recDay == origDay {
-							// exception
-							if !excSch.Deleted {
-								routines = append(routines, excSch)
-							}
-
-							// deleted
-							emptySch := createEmpty(recSch.From, recSch.To, origDate, recID)
-							routines = append(routines, *emptySch)
-							break
-						}
-					}
-				}
+	summaries, err := s.repo.Reviews.GetSummaries()
+	if err != nil {
+		return nil, err
+	}
+
+	absences, err := getAbsences(s.repo, window)
+	if err != nil {
+		return nil, err
+	}
+
+	services, err := s.repo.Services.GetAll(0)
+	if err != nil {
+		return nil, err
+	}
+	byDoctor := make(map[int][]data.ServiceType)
+	for _, service := range services {
+		byDoctor[service.DoctorID] = append(byDoctor[service.DoctorID], service)
+	}
+
+	units := createUnits(doctors, absences, window, true, s.clock)
+	for i := range units {
+		units[i].Review = summaries[units[i].ID]
+		units[i].Services = byDoctor[units[i].ID]
+	}
+
+	return units, nil
+}
+
+// slots and used slots of units are set in the wall clock of the doctor's time zone encoded in UTC,
+// schedules are expanded into concrete dates of the window starting from the current date of the doctor;
+// slots which can't be booked because of the doctor's booking policy, closures or time off are used,
+// group sessions are used once they are full
+func createUnits(doctors []data.Doctor, absences absences, window data.Window, replace bool, clock data.Clock) []Unit {
+	units := make([]Unit, len(doctors))
+	for i, doctor := range doctors {
+		loc := doctor.Location()
+		from := clock.TodayIn(loc).UnixMilli() // date only
+		if window.From > from {
+			from = window.From
+		}
+
+		// organization occupied slots
+		slotsDates := make(map[int64][]time.Time) // search by dates
+		sessions := make(map[int64]session)       // wall clock of the start -> session
+		for _, occupiedSlot := range doctor.OccupiedSlots {
+			slot := time.UnixMilli(data.ToWall(occupiedSlot.Date, loc)).UTC()
+			start := slot.UnixMilli()
+
+			sess, exists := sessions[start]
+			if !exists {
+				slotDate := slot.Truncate(oneDay).UnixMilli()
+				slotsDates[slotDate] = append(slotsDates[slotDate], slot)
+				sess = session{serviceID: occupiedSlot.ServiceID, capacity: occupiedSlot.Seats()}
+			}
+			sess.count++
+			if seats := occupiedSlot.Seats(); seats < sess.capacity {
+				sess.capacity = seats
 			}
+			if end := start + int64(occupiedSlot.Duration+occupiedSlot.Buffer)*minuteMilli; end > sess.end {
+				sess.end = end
+			}
+			sessions[start] = sess
+		}
 
-			// empty schedules
-			for _, day := range recDays {
-				offset := (day - tWeekDay) % 7
-				for date := newStamp(todayMilli, offset*allDay); date < recSch.Date; date = newStamp(date, 7*allDay) {
-					// deleted
-					emptySch := createEmpty(recSch.From, recSch.To, date, recID)
-					routines = append(routines, *emptySch)
-				}
+		// group sessions with free seats don't block their starts
+		seats := make(map[int64]int)
+		services := make(map[int64]int)
+		for start, sess := range sessions {
+			if sess.count < sess.capacity {
+				seats[start] = sess.capacity - sess.count
+				services[start] = sess.serviceID
 			}
 		}
 
-		weekDates := make(map[int][]int64, 7)   // dates by days of the week
-		activeDates := make(map[int64]struct{}) // dates without deleted
+		routines, weekly := expandSchedules(doctor.DoctorSchedule, loc, from, window.To)
+		occurrences := make(map[string]struct{}, len(weekly)) // recID
+		for _, event := range weekly {
+			occurrences[strconv.Itoa(event.schedule.ID)] = struct{}{}
+		}
 
-		// routine events
+		bookedSlots := make(map[int64]struct{})
+		schedules := make([]Schedule, 0)
 		for _, routSch := range routines {
-			if todayMilli >= newStamp(routSch.Date, routSch.To) {
+			if from >= newStamp(routSch.Date, routSch.To) || routSch.Date >= window.To {
 				continue
 			}
 
 			// booked slots
-			if !routSch.Deleted {
-				booked := getRoutBookedSlots(slotsDates, routSch.Date, routSch.From, routSch.To, doctor.SlotSize, doctor.Gap, replace)
-				for _, slot := range booked {
+			booked := getRoutBookedSlots(slotsDates, routSch.Date, routSch.From, routSch.To, doctor.SlotSize, doctor.Gap, replace)
+			for _, slot := range booked {
+				if _, open := seats[slot]; !open && from <= slot && slot < window.To {
 					bookedSlots[slot] = struct{}{}
 				}
 			}
 
+			// occurrences of weekly events are presented as days of the week
+			if _, exists := occurrences[routSch.RecurringEventID]; exists && routSch.ID == 0 {
+				continue
+			}
+
 			// create schedules
 			newSchedules := createSchedules(routSch.From, routSch.To, doctor.SlotSize, doctor.Gap, nil, []int64{routSch.Date})
 			for _, sch := range newSchedules {
-				date := sch.Dates[0]
-
-				weekDay := int(time.UnixMilli(date).UTC().Weekday())
-				weekDates[weekDay] = append(weekDates[weekDay], date)
-
-				if routSch.Deleted {
-					empty[routSch.RecurringEventID][newStamp(date, sch.From.Get())] = struct{}{}
-				} else {
-					activeDates[date] = struct{}{}
+				if date := sch.Dates[0]; from <= date && date < window.To {
 					schedules = append(schedules, sch)
 				}
 			}
 		}
+		schedules = mergeSchedules(schedules)
+		schedules = append(schedules, weeklySchedules(weekly, schedules, doctor.SlotSize, doctor.Gap, from, window.To)...)
 
-		// recurring events
-		for _, recSch := range recurring {
-			recID := strconv.Itoa(recSch.ID)
-			recDays := daysFromRules(recSch.Rrule)
+		units[i] = Unit{
+			ID:       doctor.ID,
+			Title:    doctor.Name,
+			Subtitle: doctor.Details,
+			Details:  doctor.Subtitle,
+			Category: doctor.Category,
+			Price:    doctor.Price,
+			TimeZone: loc.String(),
+			Preview:  doctor.ImageURL,
+			Slots:    schedules,
+			size:     doctor.SlotSize,
+			gap:      doctor.Gap,
+		}
 
-			// booked slots
-			booked := getRecBookedSlots(slotsDays, recDays, recSch.Date, recSch.From, recSch.To, doctor.SlotSize, doctor.Gap, empty[recID], replace)
-			for _, slot := range booked {
-				bookedSlots[slot] = struct{}{}
+		policy := newBookingPolicy(doctor, loc, clock.Now())
+		for _, slot := range policy.blockedSlots(&units[i], from, window.To) {
+			bookedSlots[slot] = struct{}{}
+		}
+		for _, slot := range absentSlots(&units[i], absences.of(doctor), doctor.SlotSize, from, window.To) {
+			bookedSlots[slot] = struct{}{}
+		}
+		// reservations of services occupy all slots till their end
+		for start, sess := range sessions {
+			if sess.end <= start+int64(doctor.SlotSize)*minuteMilli {
+				continue
 			}
-
-			// create schedules
-			deleted := empty[recID]
-			newSchedules := createSchedules(recSch.From, recSch.To, doctor.SlotSize, doctor.Gap, recDays, nil)
-			for _, sch := range newSchedules {
-				from := sch.From.Get()
-
-				// additional for recurring
-				sch.Dates = additionalDates(sch.Days, weekDates, deleted, from)
-				schedules = append(schedules, sch)
-
-				// empty for recurring
-				emptyDates := emptyDates(deleted, activeDates, from)
-				if len(emptyDates) > 0 {
-					emptySch := newSchedule(from, from, sch.Size, sch.Gap, []int{}, emptyDates)
-					schedules = append(schedules, *emptySch)
+			for _, slot := range absentSlots(&units[i], []absence{{start, sess.end}}, doctor.SlotSize, from, window.To) {
+				if slot != start {
+					bookedSlots[slot] = struct{}{}
 				}
 			}
 		}
 
+		for slot := range seats {
+			if _, used := bookedSlots[slot]; used || slot < from || slot >= window.To {
+				delete(seats, slot)
+				delete(services, slot)
+			}
+		}
+		if len(seats) > 0 {
+			units[i].Seats = seats
+			units[i].sessions = services
+		}
+
 		usedSlots := make([]int64, 0, len(bookedSlots))
 		for slot := range bookedSlots {
 			usedSlots = append(usedSlots, slot)
 		}
+		sort.Slice(usedSlots, func(i, j int) bool { return usedSlots[i] < usedSlots[j] })
+		units[i].UsedSlots = usedSlots
+	}
 
-		units[i] = Unit{
-			ID:        doctor.ID,
-			Title:     doctor.Name,
-			Subtitle:  doctor.Details,
-			Details:   doctor.Subtitle,
-			Category:  doctor.Category,
-			Price:     doctor.Price,
-			Review:    doctor.Review,
-			Preview:   doctor.ImageURL,
-			UsedSlots: usedSlots,
-			Slots:     schedules,
+	return units
+}
+
+// checks if a slot of the unit starts at the given time (wall clock)
+func (u *Unit) hasSlot(stamp int64) bool {
+	if stamp%minuteMilli != 0 {
+		return false
+	}
+
+	date := stamp - stamp%allDayMilli
+	start := int((stamp - date) / minuteMilli)
+	for _, from := range u.slotsOn(date) {
+		if from == start {
+			return true
 		}
 	}
 
-	return units
+	return false
+}
+
+// returns sorted start times of free upcoming slots in the [from, to) interval,
+// group sessions with free seats are available only for their service
+func (u *Unit) availableSlots(from, to int64, moment time.Time, serviceID int) []int64 {
+	loc, err := data.LoadLocation(u.TimeZone)
+	if err != nil {
+		loc = time.UTC
+	}
+	now := data.ToWall(moment.UnixMilli(), loc)
+
+	used := make(map[int64]struct{}, len(u.UsedSlots))
+	for _, slot := range u.UsedSlots {
+		used[slot] = struct{}{}
+	}
+	for slot, service := range u.sessions {
+		if serviceID == 0 || service != serviceID {
+			used[slot] = struct{}{}
+		}
+	}
+
+	slots := make([]int64, 0)
+	for date := from - from%allDayMilli; date < to; date += allDayMilli {
+		for _, start := range u.slotsOn(date) {
+			stamp := newStamp(date, start)
+			if stamp < from || stamp >= to || stamp < now {
+				continue
+			}
+
+			if _, exists := used[stamp]; !exists {
+				slots = append(slots, stamp)
+			}
+		}
+	}
+
+	sort.Slice(slots, func(i, j int) bool { return slots[i] < slots[j] })
+	return slots
+}
+
+// returns start times (in minutes) of the unit's slots for the date,
+// schedules set for concrete dates override schedules set for days of the week
+func (u *Unit) slotsOn(date int64) []int {
+	weekDay := int(time.UnixMilli(date).UTC().Weekday())
+
+	byDates := make([]Schedule, 0)
+	byDays := make([]Schedule, 0)
+	for _, sch := range u.Slots {
+		if containsStamp(sch.Dates, date) {
+			byDates = append(byDates, sch)
+		} else if contains(sch.Days, weekDay) {
+			byDays = append(byDays, sch)
+		}
+	}
+
+	schedules := byDays
+	if len(byDates) > 0 {
+		schedules = byDates
+	}
+
+	starts := make([]int, 0)
+	for _, sch := range schedules {
+		to := sch.To.Get()
+		for from := sch.From.Get(); from+sch.Size <= to; from += sch.Size + sch.Gap {
+			starts = append(starts, from)
+		}
+	}
+
+	return starts
+}
+
+// returns slots of the list where the service fits into consecutive slots
+// and its time with the buffer doesn't overlap used slots, group sessions of the service are kept
+func (u *Unit) fitting(slots []int64, service data.ServiceType) []int64 {
+	out := make([]int64, 0, len(slots))
+	for _, slot := range slots {
+		if u.sessions[slot] == service.ID {
+			out = append(out, slot)
+		} else if u.fits(slot, service.Duration) && u.isFree(slot, slot+int64(service.Duration+service.Buffer)*minuteMilli) {
+			out = append(out, slot)
+		}
+	}
+
+	return out
+}
+
+// checks if the appointment of the duration (in minutes) starting at the time (wall clock)
+// fits into consecutive slots of the unit
+func (u *Unit) fits(stamp int64, duration int) bool {
+	if u.size <= 0 {
+		return false
+	}
+
+	end := stamp + int64(duration)*minuteMilli
+	for slot := stamp; u.hasSlot(slot); slot += int64(u.size+u.gap) * minuteMilli {
+		if slot+int64(u.size)*minuteMilli >= end {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checks that the [from, to) interval (wall clock) doesn't overlap used slots and group sessions of the unit
+func (u *Unit) isFree(from, to int64) bool {
+	size := int64(u.size) * minuteMilli
+	for _, slot := range u.UsedSlots {
+		if slot < to && from < slot+size {
+			return false
+		}
+	}
+	for slot := range u.sessions {
+		if slot < to && from < slot+size {
+			return false
+		}
+	}
+
+	return true
+}
+
+func containsStamp(list []int64, value int64) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
 }
 
 // helper functions
@@ -255,33 +506,190 @@ func daysFromRules(rrule string) []int {
 	return days
 }
 
-func createEmpty(from, to int, date int64, recID string) *data.DoctorSchedule {
-	return &data.DoctorSchedule{
-		From:             from,
-		To:               to,
-		Date:             date,
-		Deleted:          true,
-		RecurringEventID: recID,
+// converts schedules of the doctor into routines of concrete dates in the [from, to) interval
+// taking exceptions of recurring events into account, occurrences of weekly events are included
+// to find booked slots, the events are returned to be presented as days of the week
+func expandSchedules(schedules []data.DoctorSchedule, loc *time.Location, from, to int64) ([]data.DoctorSchedule, []weeklyEvent) {
+	routines := make([]data.DoctorSchedule, 0, len(schedules))
+	recurring := make([]data.DoctorSchedule, 0)
+	weekly := make([]weeklyEvent, 0)
+	exceptions := make(map[string][]data.DoctorSchedule) // recID -> []sch
+
+	// separation of events
+	for _, sch := range schedules {
+		if sch.Rrule != "" {
+			recurring = append(recurring, sch)
+		} else if sch.RecurringEventID != "" {
+			exceptions[sch.RecurringEventID] = append(exceptions[sch.RecurringEventID], sch)
+		} else {
+			routines = append(routines, sch)
+		}
 	}
+
+	for _, recSch := range recurring {
+		rule, err := parseRule(recSch.Rrule)
+		if err != nil {
+			log.Printf("WARN: invalid rrule of schedule %d: %v", recSch.ID, err)
+			continue
+		}
+
+		recID := strconv.Itoa(recSch.ID)
+		expanded := expandRecurring(recSch, rule.in(loc), exceptions[recID], from, to)
+		if rule.isWeekly() {
+			event := weeklyEvent{schedule: recSch, days: daysFromRules(recSch.Rrule), dates: make(map[int64]struct{})}
+			for _, routSch := range expanded {
+				if routSch.ID == 0 {
+					event.dates[routSch.Date] = struct{}{}
+				}
+			}
+			weekly = append(weekly, event)
+		}
+		routines = append(routines, expanded...)
+	}
+
+	return routines, weekly
 }
 
-// booked slots
+// converts occurrences of the recurring event in the [from, to) interval into routines taking its exceptions into account
+func expandRecurring(recSch data.DoctorSchedule, rule *rrule, exceptions []data.DoctorSchedule, from, to int64) []data.DoctorSchedule {
+	recID := strconv.Itoa(recSch.ID)
+	dtstart := time.UnixMilli(newStamp(recSch.Date, recSch.From)).UTC()
+
+	routines := make([]data.DoctorSchedule, 0)
+	changed := make(map[int64]struct{}) // original timestamps
+	for _, excSch := range exceptions {
+		original, err := time.Parse("2006-01-02 15:04", excSch.OriginalStart)
+		if err != nil {
+			log.Printf("failed to parse original start time: %v", err)
+			continue
+		}
 
-func getRoutBookedSlots(slots map[int64][]time.Time, date int64, from, to, size, gap int, replace bool) []int64 {
-	return getBookedSlots(slots, nil, []int{-1}, date, from, to, size, gap, nil, replace)
+		if !rule.occursAt(dtstart, original) {
+			continue
+		}
+
+		changed[original.UnixMilli()] = struct{}{}
+		if !excSch.Deleted {
+			routines = append(routines, excSch)
+		}
+	}
+
+	// the previous day is included as its schedule can encompass midnight
+	start := time.UnixMilli(from - allDayMilli).UTC()
+	for _, occ := range rule.between(dtstart, start, time.UnixMilli(to).UTC()) {
+		if _, exists := changed[occ.UnixMilli()]; exists {
+			continue
+		}
+
+		routines = append(routines, data.DoctorSchedule{
+			DoctorID:         recSch.DoctorID,
+			From:             recSch.From,
+			To:               recSch.To,
+			Date:             occ.Truncate(oneDay).UnixMilli(),
+			RecurringEventID: recID,
+		})
+	}
+
+	return routines
+}
+
+// joins schedules which differ by dates only
+func mergeSchedules(schedules []Schedule) []Schedule {
+	type key struct{ from, to, size, gap int }
+
+	index := make(map[key]int)
+	merged := make([]Schedule, 0, len(schedules))
+	for _, sch := range schedules {
+		k := key{sch.From.Get(), sch.To.Get(), sch.Size, sch.Gap}
+		if i, ok := index[k]; ok {
+			merged[i].Dates = append(merged[i].Dates, sch.Dates...)
+			continue
+		}
+
+		index[k] = len(merged)
+		merged = append(merged, sch)
+	}
+
+	for _, sch := range merged {
+		dates := sch.Dates
+		sort.Slice(dates, func(i, j int) bool { return dates[i] < dates[j] })
+	}
+
+	return merged
 }
 
-func getRecBookedSlots(slots map[int][]time.Time, days []int, date int64, from, to, size, gap int, exceptions map[int64]struct{}, replace bool) []int64 {
-	return getBookedSlots(nil, slots, days, date, from, to, size, gap, exceptions, replace)
+// presents weekly events as schedules by days of the week, in the [from, to) interval
+// dates with other schedules get occurrences of the events as additional dates
+// and dates of missing occurrences (before the start, deleted or moved) get empty schedules
+func weeklySchedules(events []weeklyEvent, dated []Schedule, size, gap int, from, to int64) []Schedule {
+	type part struct {
+		sch    Schedule
+		offset int64 // the part after midnight is shifted by a day
+		event  weeklyEvent
+	}
+
+	parts := make([]part, 0, len(events))
+	for _, event := range events {
+		for i, sch := range createSchedules(event.schedule.From, event.schedule.To, size, gap, event.days, nil) {
+			parts = append(parts, part{sch, int64(i) * allDayMilli, event})
+		}
+	}
+	onDay := func(p part, date int64) bool {
+		return contains(p.sch.Days, int(time.UnixMilli(date).UTC().Weekday()))
+	}
+	occurs := func(p part, date int64) bool {
+		_, exists := p.event.dates[date-p.offset]
+		return exists
+	}
+
+	active := make(map[int64]struct{}) // dates with other schedules
+	for _, sch := range dated {
+		for _, date := range sch.Dates {
+			active[date] = struct{}{}
+		}
+	}
+	special := make(map[int64]struct{}, len(active)) // dates which override days of the week
+	for date := range active {
+		special[date] = struct{}{}
+	}
+
+	empty := make([]Schedule, 0)
+	for _, p := range parts {
+		dates := make([]int64, 0)
+		for date := from; date < to; date += allDayMilli {
+			if _, exists := active[date]; !exists && onDay(p, date) && !occurs(p, date) {
+				dates = append(dates, date)
+				special[date] = struct{}{}
+			}
+		}
+		if len(dates) > 0 {
+			start := p.sch.From.Get()
+			empty = append(empty, *newSchedule(start, start, size, gap, []int{}, dates))
+		}
+	}
+
+	schedules := make([]Schedule, 0, len(parts)+len(empty))
+	for _, p := range parts {
+		sch := p.sch
+		for date := from; date < to; date += allDayMilli {
+			if _, exists := special[date]; exists && onDay(p, date) && occurs(p, date) {
+				sch.Dates = append(sch.Dates, date)
+			}
+		}
+		schedules = append(schedules, sch)
+	}
+
+	return append(schedules, empty...)
 }
 
-func getBookedSlots(slotsDates map[int64][]time.Time, slotsDays map[int][]time.Time, days []int, date int64, from, to, size, gap int, exceptions map[int64]struct{}, replace bool) []int64 {
+// booked slots
+
+func getRoutBookedSlots(slots map[int64][]time.Time, date int64, from, to, size, gap int, replace bool) []int64 {
 	if from+size > to {
 		return []int64{}
 	}
 
 	current := time.UnixMilli(date).UTC()
-	currentDate := date
 
 	segment := size + gap
 	newTo := to - (to-from)%segment
@@ -293,40 +701,29 @@ func getBookedSlots(slotsDates map[int64][]time.Time, slotsDays map[int][]time.T
 	prev := from-segment < 0 // prev day
 	next := newTo > allDay   // next day
 
-	var exists bool
-	bookedSlots := make([]int64, 0, len(slotsDates))
-	for _, day := range days {
-		slots := getSlots(slotsDates, slotsDays, day, date, prev, next)
-		for _, slot := range slots {
-			if exceptions != nil {
-				current, currentDate, exists = checkException(day, from, slot, exceptions)
-				if exists {
-					continue
-				}
-			}
-
-			ts := int(slot.Sub(current).Minutes())
-			if !replace {
-				// for client reservation
-				if from <= ts && ts+size <= to {
-					bookedSlots = append(bookedSlots, newStamp(currentDate, ts))
-				}
-				continue
+	bookedSlots := make([]int64, 0, len(slots))
+	for _, slot := range getSlots(slots, date, prev, next) {
+		ts := int(slot.Sub(current).Minutes())
+		if !replace {
+			// for client reservation
+			if from <= ts && ts+size <= to {
+				bookedSlots = append(bookedSlots, newStamp(date, ts))
 			}
+			continue
+		}
 
-			// for booking
-			rem := (segment + (ts-from)%segment) % segment
+		// for booking
+		rem := (segment + (ts-from)%segment) % segment
 
-			before := ts - rem
-			if from < before+segment && before < newTo {
-				bookedSlots = append(bookedSlots, newStamp(currentDate, before))
-			}
+		before := ts - rem
+		if from < before+segment && before < newTo {
+			bookedSlots = append(bookedSlots, newStamp(date, before))
+		}
 
-			if rem != 0 {
-				after := ts + segment - rem
-				if from < after+segment && after < newTo {
-					bookedSlots = append(bookedSlots, newStamp(currentDate, after))
-				}
+		if rem != 0 {
+			after := ts + segment - rem
+			if from < after+segment && after < newTo {
+				bookedSlots = append(bookedSlots, newStamp(date, after))
 			}
 		}
 	}
@@ -334,48 +731,22 @@ func getBookedSlots(slotsDates map[int64][]time.Time, slotsDays map[int][]time.T
 	return bookedSlots
 }
 
-func getSlots(slotsDates map[int64][]time.Time, slotsDays map[int][]time.Time, day int, date int64, prev, next bool) []time.Time {
-	if len(slotsDates) > 0 {
-		slots := slotsDates[date]
-		if prev {
-			slots = append(slots, slotsDates[date-allDayMilli]...)
-		}
-		if next {
-			slots = append(slots, slotsDates[date+allDayMilli]...)
-		}
-
-		return slots
+func getSlots(slotsDates map[int64][]time.Time, date int64, prev, next bool) []time.Time {
+	slots := append([]time.Time{}, slotsDates[date]...)
+	if prev {
+		slots = append(slots, slotsDates[date-allDayMilli]...)
 	}
-
-	if len(slotsDays) > 0 {
-		slots := slotsDays[day]
-		if prev {
-			slots = append(slots, slotsDays[(day+6)%7]...)
-		}
-		if next {
-			slots = append(slots, slotsDays[(day+1)%7]...)
-		}
-
-		return slots
+	if next {
+		slots = append(slots, slotsDates[date+allDayMilli]...)
 	}
 
-	return nil
+	return slots
 }
 
 func newStamp(date int64, from int) int64 {
 	return date + int64(from*minuteMilli)
 }
 
-func checkException(day, from int, slot time.Time, exceptions map[int64]struct{}) (time.Time, int64, bool) {
-	diff := day - int(slot.Weekday())
-
-	current := slot.Truncate(oneDay).AddDate(0, 0, diff)
-	currentDate := current.UnixMilli()
-
-	_, exists := exceptions[newStamp(currentDate, from)]
-	return current, currentDate, exists
-}
-
 // booking schedules for events
 
 func createSchedules(from, to, size, gap int, days []int, dates []int64) []Schedule {
@@ -424,40 +795,3 @@ func newSchedule(from, to, size, gap int, days []int, dates []int64) *Schedule {
 		Dates: dates,
 	}
 }
-
-// helper dates for recurring event
-
-func additionalDates(days []int, weekDates map[int][]int64, deleted map[int64]struct{}, from int) []int64 {
-	dates := make(map[int64]struct{}) // duplication of routines events
-
-	for _, day := range days {
-		for _, date := range weekDates[day] {
-			if _, exists := deleted[newStamp(date, from)]; !exists {
-				dates[date] = struct{}{}
-			}
-		}
-	}
-
-	addDates := make([]int64, 0, len(dates))
-	for date := range dates {
-		addDates = append(addDates, date)
-	}
-
-	return addDates
-}
-
-func emptyDates(deleted, activeDates map[int64]struct{}, from int) []int64 {
-	emptyDates := make([]int64, 0, len(deleted))
-	for stamp := range deleted {
-		empty := time.UnixMilli(stamp).UTC()
-
-		emptyFrom := empty.Hour()*60 + empty.Minute()
-		emptyDate := empty.Truncate(oneDay).UnixMilli()
-
-		if _, exists := activeDates[emptyDate]; !exists && from == emptyFrom {
-			emptyDates = append(emptyDates, emptyDate)
-		}
-	}
-
-	return emptyDates
-}
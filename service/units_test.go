@@ -1,8 +1,12 @@
 package service
 
 import (
+	"encoding/json"
 	"reflect"
 	"scheduler-booking/common"
+	"scheduler-booking/data"
+	"sort"
+	"strconv"
 	"testing"
 	"time"
 )
@@ -480,3 +484,239 @@ func TestBookedSlots(t *testing.T) {
 		checkTestCase(slots, &c, true)
 	}
 }
+
+func TestUnitHasSlot(t *testing.T) {
+	date := time.Date(2025, 1, 6, 0, 0, 0, 0, time.UTC) // Monday
+	stamp := func(day, h, m int) int64 {
+		return date.AddDate(0, 0, day).Add(time.Duration(h)*time.Hour + time.Duration(m)*time.Minute).UnixMilli()
+	}
+
+	unit := Unit{
+		Slots: []Schedule{
+			// mon, wed 9:00-12:00
+			*newSchedule(9*60, 12*60, 40, 20, []int{1, 3}, []int64{stamp(2, 0, 0)}),
+			// wed 18:00-20:00
+			*newSchedule(18*60, 20*60, 40, 20, nil, []int64{stamp(2, 0, 0)}),
+			// deleted next monday
+			*newSchedule(9*60, 9*60, 40, 20, []int{}, []int64{stamp(7, 0, 0)}),
+		},
+	}
+
+	cases := []struct {
+		stamp  int64
+		exists bool
+	}{
+		{stamp: stamp(0, 9, 0), exists: true},
+		{stamp: stamp(0, 10, 0), exists: true},
+		{stamp: stamp(0, 11, 0), exists: true},
+		{stamp: stamp(0, 9, 30), exists: false},    // between slots
+		{stamp: stamp(0, 12, 0), exists: false},    // schedule end
+		{stamp: stamp(0, 3, 0), exists: false},     // night
+		{stamp: stamp(1, 9, 0), exists: false},     // tuesday
+		{stamp: stamp(2, 10, 0), exists: true},     // wednesday
+		{stamp: stamp(2, 19, 0), exists: true},     // wednesday evening
+		{stamp: stamp(0, 19, 0), exists: false},    // monday evening
+		{stamp: stamp(7, 9, 0), exists: false},     // deleted
+		{stamp: stamp(14, 9, 0), exists: true},     // monday after next
+		{stamp: stamp(0, 9, 0) + 1, exists: false}, // arbitrary milliseconds
+	}
+
+	for _, c := range cases {
+		if unit.hasSlot(c.stamp) != c.exists {
+			t.Fatalf("%s: expected %v", time.UnixMilli(c.stamp).UTC(), c.exists)
+		}
+	}
+}
+
+// runs the booking pipeline at fixed instants around midnight and the week boundary
+func TestUnitsAtFixedInstants(t *testing.T) {
+	runStorages(t, testUnitsAtFixedInstants)
+}
+
+func testUnitsAtFixedInstants(t *testing.T, open openFunc) {
+	now := time.Date(2030, 1, 6, 23, 10, 0, 0, time.UTC) // sunday
+	clock := data.Clock(func() time.Time { return now })
+
+	repo := open(t, clock)
+	s := NewService(repo, Config{HoldTime: 10, Window: 60})
+
+	start := time.Date(2030, 1, 6, 0, 0, 0, 0, time.UTC).UnixMilli()
+	night := data.Doctor{
+		Name:     "Dr. Night",
+		SlotSize: 30,
+		// every day 22:00-02:00
+		DoctorSchedule: []data.DoctorSchedule{{From: 22 * 60, To: 26 * 60, Date: start, Rrule: "FREQ=DAILY", Duration: 4 * 60 * 60}},
+	}
+	monday := data.Doctor{
+		Name:     "Dr. Monday",
+		SlotSize: 30,
+		// every monday 9:00-10:00
+		DoctorSchedule: []data.DoctorSchedule{{From: 9 * 60, To: 10 * 60, Date: start, Rrule: "FREQ=WEEKLY;BYDAY=MO", Duration: 60 * 60}},
+	}
+	for _, doctor := range []*data.Doctor{&night, &monday} {
+		if _, err := repo.Doctors.Add(doctor); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	at := func(day, h, m int) int64 {
+		return time.Date(2030, 1, day, h, m, 0, 0, time.UTC).UnixMilli()
+	}
+	available := func(id int) []int64 {
+		units, err := s.Units.GetAvailable(0, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, u := range units {
+			if u.ID == id {
+				return u.AvailableSlots
+			}
+		}
+		t.Fatalf("unit %d not found", id)
+		return nil
+	}
+	code := func(err error) string {
+		if err == nil {
+			return ""
+		}
+		return AsError(err).Code
+	}
+
+	// sunday 23:10, the night shift continues after midnight
+	slots := available(night.ID)
+	expected := []int64{at(6, 23, 30), at(7, 0, 0), at(7, 0, 30), at(7, 1, 0), at(7, 1, 30), at(7, 22, 0)}
+	if !reflect.DeepEqual(slots[:len(expected)], expected) {
+		t.Fatalf("expected night slots %v, got %v", expected, slots[:len(expected)])
+	}
+	slots = available(monday.ID)
+	expected = []int64{at(7, 9, 0), at(7, 9, 30)} // the next monday is after the week
+	if !reflect.DeepEqual(slots, expected) {
+		t.Fatalf("expected monday slots %v, got %v", expected, slots)
+	}
+
+	form := ReservationForm{Name: "Client", Email: "client@scheduler.booking"}
+	if _, err := s.Reservations.Add(Reservation{DoctorID: night.ID, Date: at(6, 23, 0), Form: form}); code(err) != "booking_expired" {
+		t.Fatalf("expected booking_expired for the started slot, got %v", err)
+	}
+	id, err := s.Reservations.Add(Reservation{DoctorID: night.ID, Date: at(7, 0, 30), Form: form})
+	if err != nil {
+		t.Fatalf("expected the reservation after midnight, got %v", err)
+	}
+	if slots := available(night.ID); containsStamp(slots, at(7, 0, 30)) {
+		t.Fatal("expected the reserved slot to be unavailable")
+	}
+
+	// monday 9:45, the last slot of the day has started, the next one is in a week
+	now = time.Date(2030, 1, 7, 9, 45, 0, 0, time.UTC)
+	slots = available(monday.ID)
+	expected = []int64{at(14, 9, 0), at(14, 9, 30)}
+	if !reflect.DeepEqual(slots, expected) {
+		t.Fatalf("expected monday slots %v, got %v", expected, slots)
+	}
+	if err := s.Reservations.Cancel(id, "test"); code(err) != "reservation_expired" {
+		t.Fatalf("expected reservation_expired, got %v", err)
+	}
+
+	// work time can't start before the clock
+	past := common.JDate{Time: time.Date(2030, 1, 7, 8, 0, 0, 0, time.UTC)}
+	end := common.JDate{Time: time.Date(2030, 1, 7, 12, 0, 0, 0, time.UTC)}
+	if _, err := s.Worktime.Add(Worktime{DoctorID: monday.ID, StartDate: &past, EndDate: &end}); code(err) != "validation_failed" {
+		t.Fatalf("expected validation_failed, got %v", err)
+	}
+}
+
+// checks that available slots start at the current time of each doctor by default
+func TestAvailableSlotsInTimeZones(t *testing.T) {
+	runStorages(t, testAvailableSlotsInTimeZones)
+}
+
+func testAvailableSlotsInTimeZones(t *testing.T, open openFunc) {
+	f := newFixture(t, open, Config{HoldTime: 10, Window: 60})
+	// tuesday 2:00 UTC is monday 20:00 in Chicago
+	f.now = time.Date(2030, 1, 8, 2, 0, 0, 0, time.UTC)
+
+	chicago := f.addDoctor(data.Doctor{Name: "Dr. Chicago", SlotSize: 60, TimeZone: "America/Chicago"}, 9*60, 23*60)
+	utc := f.addDoctor(data.Doctor{Name: "Dr. UTC", SlotSize: 60}, 9*60, 23*60)
+
+	units, err := f.s.Units.GetAvailable(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := make(map[int][]int64)
+	for _, u := range units {
+		first[u.ID] = u.AvailableSlots[:3]
+	}
+
+	cases := map[int][]int64{
+		chicago.ID: {at(7, 20, 0), at(7, 21, 0), at(7, 22, 0)},
+		utc.ID:     {at(8, 9, 0), at(8, 10, 0), at(8, 11, 0)},
+	}
+	for id, expected := range cases {
+		if !reflect.DeepEqual(first[id], expected) {
+			t.Fatalf("doctor %d: expected the first slots %v, got %v", id, expected, first[id])
+		}
+	}
+}
+
+// checks that weekly schedules are returned as days of the week with dates of the window
+func TestWeeklySchedules(t *testing.T) {
+	runStorages(t, testWeeklySchedules)
+}
+
+func testWeeklySchedules(t *testing.T, open openFunc) {
+	f := newFixture(t, open, Config{HoldTime: 10, Window: 60})
+	doctor := f.addDoctor(data.Doctor{Name: "Dr. Weekly", SlotSize: 60}, 0, 0)
+
+	add := func(from, to int, date int64, rrule, original, recID string, deleted bool) int {
+		id, err := f.repo.DoctorsSchedule.Add(doctor.ID, from, to, date, rrule, (to-from)*60, original, recID, deleted)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+	// every monday and wednesday 9:00-12:00 since monday, the next wednesday is cancelled,
+	// the next monday has an extra hour, the night shift on fridays starts in a week
+	weekly := strconv.Itoa(add(9*60, 12*60, at(7, 0, 0), "FREQ=WEEKLY;INTERVAL=1;BYDAY=MO,WE", "", "", false))
+	add(9*60, 12*60, at(9, 0, 0), "", "2030-01-09 09:00", weekly, true)
+	add(13*60, 14*60, at(14, 0, 0), "", "", "", false)
+	add(23*60, 25*60, at(18, 0, 0), "FREQ=WEEKLY;BYDAY=FR", "", "", false)
+
+	units, err := f.s.Units.GetAll(at(7, 0, 0), at(21, 0, 0))
+	if err != nil || len(units) != 1 {
+		t.Fatalf("expected one unit, got %+v (%v)", units, err)
+	}
+
+	expected := []Schedule{
+		*newSchedule(13*60, 14*60, 60, 0, nil, []int64{at(14, 0, 0)}),
+		*newSchedule(9*60, 12*60, 60, 0, []int{1, 3}, []int64{at(14, 0, 0)}),
+		*newSchedule(23*60, 24*60, 60, 0, []int{5}, nil),
+		*newSchedule(0, 1*60, 60, 0, []int{6}, nil),
+		*newSchedule(9*60, 9*60, 60, 0, []int{}, []int64{at(9, 0, 0)}),
+		*newSchedule(23*60, 23*60, 60, 0, []int{}, []int64{at(11, 0, 0)}),
+		*newSchedule(0, 0, 60, 0, []int{}, []int64{at(12, 0, 0)}),
+	}
+	// the response keeps the shape of days and dates
+	raw, _ := json.Marshal(units[0].Slots)
+	if want, _ := json.Marshal(expected); string(raw) != string(want) {
+		t.Fatalf("expected %s, got %s", want, raw)
+	}
+
+	cases := []struct {
+		day    int
+		starts []int
+	}{
+		{day: 9, starts: []int{}},
+		{day: 11, starts: []int{}},
+		{day: 14, starts: []int{9 * 60, 10 * 60, 11 * 60, 13 * 60}},
+		{day: 16, starts: []int{9 * 60, 10 * 60, 11 * 60}},
+		{day: 18, starts: []int{23 * 60}},
+		{day: 19, starts: []int{0}},
+	}
+	for _, c := range cases {
+		starts := units[0].slotsOn(at(c.day, 0, 0))
+		sort.Ints(starts)
+		if !reflect.DeepEqual(starts, c.starts) {
+			t.Fatalf("january %d: expected %v, got %v", c.day, c.starts, starts)
+		}
+	}
+}
@@ -0,0 +1,303 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"scheduler-booking/data"
+	"scheduler-booking/notify"
+	"strings"
+)
+
+// path of the claim link, the token of the offer is appended
+const claimPath = "/waitlist/claim/"
+
+type waitlistService struct {
+	repo         data.Repositories
+	config       Config
+	clock        data.Clock
+	reservations *reservationsService
+}
+
+// the patient waits for the specific slot or for any slot of the interval,
+// dates are set in the wall clock of the doctor's time zone encoded in UTC
+type WaitlistForm struct {
+	DoctorID  int             `json:"doctor"`
+	ServiceID int             `json:"service,omitempty"` // (optional) service of the doctor, one slot by default
+	Date      int64           `json:"date,omitempty"`    // the specific slot
+	From      int64           `json:"from,omitempty"`    // the interval of slots if the date is not set
+	To        int64           `json:"to,omitempty"`
+	Form      ReservationForm `json:"form"`
+}
+
+type WaitlistEntryStr struct {
+	data.WaitlistEntry
+	Claim string `json:"claim,omitempty"` // link to claim the offered slot while the offer is active
+}
+
+// returns entries of the doctor in the order of registration, 0 returns entries of all doctors
+func (s *waitlistService) GetAll(doctorID int) ([]WaitlistEntryStr, error) {
+	entries, err := s.repo.Waitlist.GetAll(doctorID)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]WaitlistEntryStr, 0, len(entries))
+	for _, entry := range entries {
+		str := WaitlistEntryStr{WaitlistEntry: entry}
+		if entry.Status == data.WaitlistOffered {
+			str.Claim = claimPath + entry.OfferToken
+		}
+		out = append(out, str)
+	}
+
+	return out, nil
+}
+
+func (s *waitlistService) GetOne(id int) (data.WaitlistEntry, error) {
+	entry, err := s.repo.Waitlist.GetOne(id)
+	if err != nil {
+		return entry, err
+	}
+	if entry.ID == 0 {
+		return entry, notFound("waitlist_entry_not_found", "waitlist entry with id %d not found", id)
+	}
+
+	return entry, nil
+}
+
+func (s *waitlistService) Add(form WaitlistForm) (int, error) {
+	doctor, err := s.repo.Doctors.GetOne(form.DoctorID)
+	if err != nil {
+		return 0, err
+	}
+	if doctor.ID == 0 {
+		return 0, doctorNotFound(form.DoctorID)
+	}
+	if _, err := getAppointment(s.repo, form.DoctorID, form.ServiceID); err != nil {
+		return 0, err
+	}
+
+	if err := form.validate(data.ToWall(s.clock.Now().UnixMilli(), doctor.Location())); err != nil {
+		return 0, err
+	}
+
+	entry := form.toEntry()
+	entry.CreatedAt = s.clock.Now().UnixMilli()
+	return s.repo.Waitlist.Add(&entry)
+}
+
+// deletes the entry, the slot of its active offer is released
+func (s *waitlistService) Delete(id int) error {
+	entry, err := s.GetOne(id)
+	if err != nil {
+		return err
+	}
+
+	if entry.Status == data.WaitlistOffered {
+		if err := s.repo.OccupiedSlots.DeleteHold(entry.OfferToken); err != nil {
+			return err
+		}
+	}
+
+	return s.repo.Waitlist.Delete(id)
+}
+
+// turns the offered slot into the reservation of the patient
+func (s *waitlistService) Claim(token string) (int, error) {
+	entry, err := s.repo.Waitlist.GetByOffer(token)
+	if err != nil {
+		return 0, err
+	}
+
+	switch {
+	case entry.ID == 0:
+		return 0, notFound("offer_not_found", "offer doesn't exist")
+	case entry.Status == data.WaitlistClaimed:
+		return 0, conflict("offer_claimed", "offer is already claimed")
+	case entry.Status != data.WaitlistOffered || entry.OfferUntil < s.clock.Now().UnixMilli():
+		return 0, expired("offer_expired", "offer has expired")
+	}
+
+	hold, err := s.repo.OccupiedSlots.GetHold(token)
+	if errors.Is(err, data.ErrHoldNotFound) {
+		return 0, expired("offer_expired", "offer has expired")
+	}
+	if err != nil {
+		return 0, err
+	}
+	hold.ClientName, hold.ClientEmail = entry.ClientName, entry.ClientEmail
+
+	// the entry is closed with the confirmation of the hold, so the offer can't expire in between
+	id, err := s.repo.Waitlist.Claim(entry.ID, s.reservations.notice(notify.EventBooked, hold, nil))
+	if errors.Is(err, data.ErrOfferClosed) || errors.Is(err, data.ErrHoldNotFound) {
+		return 0, expired("offer_expired", "offer has expired")
+	}
+	return id, err
+}
+
+// closes offers which were not claimed in time and offers their slots to the next patients,
+// returns the number of expired offers
+func (s *waitlistService) ExpireOffers() (int, error) {
+	entries, err := s.repo.Waitlist.GetExpiredOffers(s.clock.Now().UnixMilli())
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, entry := range entries {
+		ok, err := s.repo.Waitlist.Close(entry.ID, data.WaitlistExpired, 0)
+		if err != nil {
+			return count, err
+		}
+		if !ok {
+			// claimed or expired concurrently
+			continue
+		}
+		count++
+
+		if err := s.repo.OccupiedSlots.DeleteHold(entry.OfferToken); err != nil {
+			return count, err
+		}
+		if err := s.offer(entry.DoctorID, entry.OfferDate); err != nil {
+			return count, err
+		}
+	}
+
+	return count, nil
+}
+
+// closes waiting entries whose requested time has passed in the wall clock of their doctors,
+// returns their number
+func (s *waitlistService) ExpireWaiting() (int64, error) {
+	doctors, err := s.repo.Doctors.GetAll()
+	if err != nil {
+		return 0, err
+	}
+
+	var count int64
+	now := s.clock.Now().UnixMilli()
+	for _, doctor := range doctors {
+		expired, err := s.repo.Waitlist.ExpireWaiting(doctor.ID, data.ToWall(now, doctor.Location()))
+		if err != nil {
+			return count, err
+		}
+		count += expired
+	}
+
+	return count, nil
+}
+
+// offers the freed slot (wall clock of the doctor) to the first waiting patient who can book it,
+// the slot is held for the patient until the offer expires
+func (s *waitlistService) offer(doctorID int, wall int64) error {
+	entries, err := s.repo.Waitlist.GetAll(doctorID)
+	if err != nil {
+		return err
+	}
+
+	until := s.clock.Now().UnixMilli() + int64(s.config.ClaimTime)*minuteMilli
+	for _, entry := range entries {
+		if entry.Status != data.WaitlistWaiting || !waitsFor(entry, wall) {
+			continue
+		}
+
+		// the same checks as for new reservations, e.g. the service of the patient must fit
+		token, err := s.reservations.hold(Hold{DoctorID: doctorID, Date: wall, ServiceID: entry.ServiceID}, until)
+		if err != nil {
+			if AsError(err).Kind == KindInternal {
+				return err
+			}
+			continue
+		}
+
+		ok, err := s.repo.Waitlist.Offer(entry.ID, token, wall, until)
+		if err != nil {
+			return err
+		}
+		if ok {
+			s.notifyOffer(entry, token, wall, until)
+			return nil
+		}
+
+		// the entry has been removed from the waitlist concurrently
+		if err := s.repo.OccupiedSlots.DeleteHold(token); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checks if the entry waits for the slot starting at the time (wall clock)
+func waitsFor(entry data.WaitlistEntry, wall int64) bool {
+	if entry.StartDate == entry.EndDate {
+		return wall == entry.StartDate
+	}
+
+	return entry.StartDate <= wall && wall < entry.EndDate
+}
+
+// now is the current wall clock of the doctor
+func (f *WaitlistForm) validate(now int64) error {
+	f.Form.Name = strings.TrimSpace(f.Form.Name)
+	f.Form.Email = strings.TrimSpace(f.Form.Email)
+
+	fields := make([]FieldError, 0)
+	if f.Form.Email == "" {
+		fields = append(fields, FieldError{Field: "form.email", Message: "email is required to send the offer"})
+	}
+	if f.Date != 0 {
+		if f.Date < now {
+			fields = append(fields, FieldError{Field: "date", Message: "slot has already started"})
+		}
+	} else if f.To <= f.From {
+		fields = append(fields, FieldError{Field: "to", Message: "invalid time interval"})
+	} else if f.To <= now {
+		fields = append(fields, FieldError{Field: "to", Message: "time interval has already passed"})
+	}
+
+	return invalid(fields...)
+}
+
+func (f WaitlistForm) toEntry() data.WaitlistEntry {
+	entry := data.WaitlistEntry{
+		DoctorID:      f.DoctorID,
+		ServiceID:     f.ServiceID,
+		StartDate:     f.From,
+		EndDate:       f.To,
+		ClientName:    f.Form.Name,
+		ClientEmail:   f.Form.Email,
+		ClientDetails: f.Form.Details,
+		Status:        data.WaitlistWaiting,
+	}
+	if f.Date != 0 {
+		entry.StartDate = f.Date
+		entry.EndDate = f.Date
+	}
+
+	return entry
+}
+
+// queues the offer to the patient, the wall clock and the expiration are shown in the doctor's time zone
+func (s *waitlistService) notifyOffer(entry data.WaitlistEntry, token string, wall, until int64) {
+	if !s.config.Notify {
+		return
+	}
+
+	doctor, err := s.repo.Doctors.GetOne(entry.DoctorID)
+	if err != nil {
+		log.Printf("WARN: offer message of waitlist entry %d is not queued: %v", entry.ID, err)
+		return
+	}
+
+	payload, err := s.reservations.payload(doctor, entry.ServiceID, data.FromWall(wall, doctor.Location()))
+	if err != nil {
+		log.Printf("WARN: offer message of waitlist entry %d is not queued: %v", entry.ID, err)
+		return
+	}
+	payload.ClientName = entry.ClientName
+	payload.Claim = claimPath + token
+	payload.Expires = formatDate(until, doctor.Location())
+
+	s.reservations.enqueue(notify.EventOffered, entry.ClientEmail, payload)
+}
@@ -0,0 +1,168 @@
+package service
+
+import (
+	"scheduler-booking/data"
+	"strings"
+	"testing"
+	"time"
+)
+
+// checks that freed slots are offered to the waitlist in the order of registration
+func TestWaitlist(t *testing.T) {
+	runStorages(t, testWaitlist)
+}
+
+func testWaitlist(t *testing.T, open openFunc) {
+	f := newFixture(t, open, Config{HoldTime: 10, ClaimTime: 30, Window: 60})
+	s := f.s
+	doctor := f.addDoctor(data.Doctor{Name: "Dr. Waitlist", SlotSize: 60}, 9*60, 12*60)
+
+	entry := func(email string) WaitlistEntryStr {
+		entries, err := s.Waitlist.GetAll(doctor.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, e := range entries {
+			if e.ClientEmail == email {
+				return e
+			}
+		}
+		t.Fatalf("entry of %s not found", email)
+		return WaitlistEntryStr{}
+	}
+
+	reservations := make(map[int64]int)
+	for _, h := range []int{9, 10, 11} {
+		id, code := f.book(Reservation{DoctorID: doctor.ID, Date: at(7, h, 0)})
+		if code != "" {
+			t.Fatal(code)
+		}
+		reservations[at(7, h, 0)] = id
+	}
+
+	cases := []struct {
+		form WaitlistForm
+		code string
+	}{
+		{form: WaitlistForm{DoctorID: doctor.ID, Date: at(7, 11, 0)}, code: "validation_failed"}, // no email
+		{form: WaitlistForm{DoctorID: doctor.ID, Date: at(7, 7, 0), Form: ReservationForm{Email: "past@scheduler.booking"}}, code: "validation_failed"},
+		{form: WaitlistForm{DoctorID: doctor.ID, From: at(7, 12, 0), To: at(7, 9, 0), Form: ReservationForm{Email: "interval@scheduler.booking"}}, code: "validation_failed"},
+		{form: WaitlistForm{DoctorID: doctor.ID + 1, Date: at(7, 11, 0), Form: ReservationForm{Email: "other@scheduler.booking"}}, code: "doctor_not_found"},
+		{form: WaitlistForm{DoctorID: doctor.ID, Date: at(7, 11, 0), Form: ReservationForm{Name: "Slot", Email: "slot@scheduler.booking"}}},
+		{form: WaitlistForm{DoctorID: doctor.ID, From: at(7, 9, 0), To: at(7, 12, 0), Form: ReservationForm{Name: "Day", Email: "day@scheduler.booking"}}},
+	}
+	for _, c := range cases {
+		if _, err := s.Waitlist.Add(c.form); errorCode(err) != c.code {
+			t.Fatalf("%+v: expected %q, got %v", c.form, c.code, err)
+		}
+	}
+
+	// the freed slot goes to the first patient who waits for it
+	if err := s.Reservations.Cancel(reservations[at(7, 10, 0)], "test"); err != nil {
+		t.Fatal(err)
+	}
+	if e := entry("slot@scheduler.booking"); e.Status != data.WaitlistWaiting {
+		t.Fatalf("expected the entry of another slot to wait, got %+v", e)
+	}
+	day := entry("day@scheduler.booking")
+	if day.Status != data.WaitlistOffered || day.OfferDate != at(7, 10, 0) || day.Claim == "" {
+		t.Fatalf("expected the offer of the freed slot, got %+v", day)
+	}
+	if _, err := s.Reservations.Add(Reservation{DoctorID: doctor.ID, Date: at(7, 10, 0), Form: ReservationForm{Name: "Client"}}); errorCode(err) != "slot_taken" {
+		t.Fatalf("expected the offered slot to be held, got %v", err)
+	}
+
+	id, err := s.Waitlist.Claim(strings.TrimPrefix(day.Claim, claimPath))
+	if err != nil {
+		t.Fatalf("expected the claim, got %v", err)
+	}
+	if slot, err := s.Reservations.GetOne(id); err != nil || slot.ClientEmail != "day@scheduler.booking" || slot.Date != at(7, 10, 0) {
+		t.Fatalf("expected the reservation of the patient, got %+v (%v)", slot, err)
+	}
+	if e := entry("day@scheduler.booking"); e.Status != data.WaitlistClaimed || e.ReservationID != id || e.Claim != "" {
+		t.Fatalf("expected the claimed entry, got %+v", e)
+	}
+	if _, err := s.Waitlist.Claim(strings.TrimPrefix(day.Claim, claimPath)); errorCode(err) != "offer_claimed" {
+		t.Fatalf("expected offer_claimed, got %v", err)
+	}
+	if _, err := s.Waitlist.Claim("unknown"); errorCode(err) != "offer_not_found" {
+		t.Fatalf("expected offer_not_found, got %v", err)
+	}
+
+	// the offer which isn't claimed in time expires and the slot is free again
+	if err := s.Reservations.Cancel(reservations[at(7, 11, 0)], "test"); err != nil {
+		t.Fatal(err)
+	}
+	slot := entry("slot@scheduler.booking")
+	if slot.Status != data.WaitlistOffered {
+		t.Fatalf("expected the offer, got %+v", slot)
+	}
+	f.now = f.now.Add(31 * time.Minute)
+	if _, err := s.Waitlist.Claim(strings.TrimPrefix(slot.Claim, claimPath)); errorCode(err) != "offer_expired" {
+		t.Fatalf("expected offer_expired, got %v", err)
+	}
+	if count, err := s.Waitlist.ExpireOffers(); err != nil || count != 1 {
+		t.Fatalf("expected the expired offer, got %d (%v)", count, err)
+	}
+	if e := entry("slot@scheduler.booking"); e.Status != data.WaitlistExpired {
+		t.Fatalf("expected the expired entry, got %+v", e)
+	}
+	if _, err := s.Reservations.Add(Reservation{DoctorID: doctor.ID, Date: at(7, 11, 0), Form: ReservationForm{Name: "Client"}}); err != nil {
+		t.Fatalf("expected the released slot, got %v", err)
+	}
+}
+
+// checks that entries stop waiting when their times have passed in the wall clock of the doctor
+func TestExpireWaiting(t *testing.T) {
+	runStorages(t, testExpireWaiting)
+}
+
+func testExpireWaiting(t *testing.T, open openFunc) {
+	f := newFixture(t, open, Config{HoldTime: 10, ClaimTime: 30, Window: 60})
+	s := f.s
+	// 10:00 in Berlin is 9:00 UTC
+	doctor := f.addDoctor(data.Doctor{Name: "Dr. Past", SlotSize: 60, TimeZone: "Europe/Berlin"}, 9*60, 12*60)
+
+	forms := []WaitlistForm{
+		{DoctorID: doctor.ID, Date: at(7, 10, 0), Form: ReservationForm{Email: "slot@scheduler.booking"}},
+		{DoctorID: doctor.ID, From: at(7, 9, 0), To: at(7, 12, 0), Form: ReservationForm{Email: "day@scheduler.booking"}},
+	}
+	for _, form := range forms {
+		if _, err := s.Waitlist.Add(form); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	statuses := func() map[string]string {
+		entries, err := s.Waitlist.GetAll(doctor.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out := make(map[string]string)
+		for _, e := range entries {
+			out[e.ClientEmail] = e.Status
+		}
+		return out
+	}
+
+	cases := []struct {
+		now   time.Time
+		count int64
+		slot  string
+		day   string
+	}{
+		{now: time.UnixMilli(at(7, 8, 30)), count: 0, slot: data.WaitlistWaiting, day: data.WaitlistWaiting},
+		{now: time.UnixMilli(at(7, 9, 1)), count: 1, slot: data.WaitlistExpired, day: data.WaitlistWaiting},
+		{now: time.UnixMilli(at(7, 11, 0)), count: 0, slot: data.WaitlistExpired, day: data.WaitlistWaiting},
+		{now: time.UnixMilli(at(7, 11, 1)), count: 1, slot: data.WaitlistExpired, day: data.WaitlistExpired},
+	}
+	for _, c := range cases {
+		f.now = c.now
+		if count, err := s.Waitlist.ExpireWaiting(); err != nil || count != c.count {
+			t.Fatalf("%s: expected %d closed entries, got %d (%v)", c.now.UTC(), c.count, count, err)
+		}
+		if st := statuses(); st["slot@scheduler.booking"] != c.slot || st["day@scheduler.booking"] != c.day {
+			t.Fatalf("%s: expected %s and %s, got %v", c.now.UTC(), c.slot, c.day, st)
+		}
+	}
+}
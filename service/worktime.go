@@ -8,7 +8,9 @@ import (
 )
 
 type worktimeService struct {
-	dao *data.DAO
+	repo   data.Repositories
+	config Config
+	clock  data.Clock
 }
 
 type Worktime struct {
@@ -32,15 +34,40 @@ type DoctorRoutineStr struct {
 	RecurringEventID string `json:"recurring_event_id,omitempty"`
 	OriginalStart    string `json:"original_start,omitempty"`
 	Deleted          bool   `json:"deleted,omitempty"`
+	Type             string `json:"type,omitempty"` // "time_off" for time off of the doctor, IDs are unique within the type
+	Reason           string `json:"reason,omitempty"`
+	Conflicts        []int  `json:"conflicts,omitempty"` // upcoming reservations within the time off
 }
 
+// type of time off records of the Doctors View
+const TypeTimeOff = "time_off"
+
 const strFormat = "2006-01-02 15:04:05"
 
-// returns records for the Scheduler Doctors View
-func (s *worktimeService) GetAll() ([]DoctorRoutineStr, error) {
-	schedule, err := s.dao.DoctorsSchedule.GetAll()
-	out := make([]DoctorRoutineStr, 0)
+// returns records for the Scheduler Doctors View which overlap the [from, to) interval,
+// the default interval is set by the config
+func (s *worktimeService) GetAll(from, to int64) ([]DoctorRoutineStr, error) {
+	window, err := s.config.window(s.clock, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	schedule, err := s.repo.DoctorsSchedule.GetAll(window)
+	if err != nil {
+		return nil, err
+	}
+
+	doctors, err := s.repo.Doctors.GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	locations := make(map[int]*time.Location, len(doctors))
+	for _, doctor := range doctors {
+		locations[doctor.ID] = doctor.Location()
+	}
 
+	out := make([]DoctorRoutineStr, 0)
 	for _, sch := range schedule {
 		fh := sch.From / 60
 		fm := sch.From % 60
@@ -49,15 +76,26 @@ func (s *worktimeService) GetAll() ([]DoctorRoutineStr, error) {
 
 		y, m, d := time.UnixMilli(sch.Date).UTC().Date()
 
+		start := time.Date(y, m, d, fh, fm, 0, 0, time.UTC)
 		end := data.EndDate
+		endless := sch.Rrule != ""
 		if sch.Rrule == "" {
 			end = time.Date(y, m, d, th, tm, 0, 0, time.UTC)
+		} else if rule, err := parseRule(sch.Rrule); err == nil && locations[sch.DoctorID] != nil {
+			// the recurring event ends with its last occurrence
+			if last, ok := rule.in(locations[sch.DoctorID]).last(start); ok {
+				end = last.Add(time.Duration(sch.To-sch.From) * time.Minute)
+				endless = false
+			}
+		}
+		if !endless && end.UnixMilli() <= window.From {
+			continue
 		}
 
 		r := DoctorRoutineStr{
 			ID:               sch.ID,
 			DoctorID:         sch.DoctorID,
-			StartDate:        time.Date(y, m, d, fh, fm, 0, 0, time.UTC).Format(strFormat),
+			StartDate:        start.Format(strFormat),
 			EndDate:          end.Format(strFormat),
 			Rrule:            sch.Rrule,
 			Duration:         sch.Duration,
@@ -69,12 +107,38 @@ func (s *worktimeService) GetAll() ([]DoctorRoutineStr, error) {
 		out = append(out, r)
 	}
 
-	return out, err
+	// time off overrides work time, so it is shown over it
+	timeOff, err := s.repo.TimeOff.GetAll(window)
+	if err != nil {
+		return nil, err
+	}
+	conflicts, err := timeOffConflicts(s.repo, s.clock.Now().UnixMilli(), timeOff)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range timeOff {
+		out = append(out, DoctorRoutineStr{
+			ID:        t.ID,
+			DoctorID:  t.DoctorID,
+			StartDate: time.UnixMilli(t.StartDate).UTC().Format(strFormat),
+			EndDate:   time.UnixMilli(t.EndDate).UTC().Format(strFormat),
+			Type:      TypeTimeOff,
+			Reason:    t.Reason,
+			Conflicts: conflicts[t.ID],
+		})
+	}
+
+	return out, nil
 }
 
 // adds doctor's schedule
 func (s *worktimeService) Add(data Worktime) (int, error) {
-	if err := data.validate(); err != nil {
+	loc, err := s.location(data.DoctorID)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := data.validate(loc, s.clock.Now()); err != nil {
 		return 0, err
 	}
 
@@ -83,7 +147,7 @@ func (s *worktimeService) Add(data Worktime) (int, error) {
 	from := data.StartDate.Hour()*60 + data.StartDate.Minute()
 	to := from + data.duration()
 
-	id, err := s.dao.DoctorsSchedule.Add(
+	id, err := s.repo.DoctorsSchedule.Add(
 		data.DoctorID,
 		from,
 		to,
@@ -97,18 +161,31 @@ func (s *worktimeService) Add(data Worktime) (int, error) {
 	return id, err
 }
 
+// returns the doctor's schedule
+func (s *worktimeService) GetOne(id int) (data.DoctorSchedule, error) {
+	schedule, err := s.repo.DoctorsSchedule.GetOne(id)
+	if err != nil {
+		return schedule, err
+	}
+	if schedule.ID == 0 {
+		return schedule, notFound("schedule_not_found", "schedule with id %d not found", id)
+	}
+
+	return schedule, nil
+}
+
 // updates doctor's schedule
 func (s *worktimeService) Update(scheduleID int, data Worktime) error {
-	schedule, err := s.dao.DoctorsSchedule.GetOne(scheduleID)
-	if err != nil {
+	if _, err := s.GetOne(scheduleID); err != nil {
 		return err
 	}
 
-	if schedule.ID == 0 {
-		return fmt.Errorf("schedule with id %d not found", scheduleID)
+	loc, err := s.location(data.DoctorID)
+	if err != nil {
+		return err
 	}
 
-	if err := data.validate(); err != nil {
+	if err := data.validate(loc, s.clock.Now()); err != nil {
 		return err
 	}
 
@@ -117,7 +194,7 @@ func (s *worktimeService) Update(scheduleID int, data Worktime) error {
 	from := data.StartDate.Hour()*60 + data.StartDate.Minute()
 	to := from + data.duration()
 
-	err = s.dao.DoctorsSchedule.Update(
+	err = s.repo.DoctorsSchedule.Update(
 		scheduleID,
 		data.DoctorID,
 		from,
@@ -134,17 +211,41 @@ func (s *worktimeService) Update(scheduleID int, data Worktime) error {
 
 // delets doctor's schedule for the specific day
 func (s *worktimeService) Delete(id int) error {
-	return s.dao.DoctorsSchedule.Delete(id)
+	return s.repo.DoctorsSchedule.Delete(id)
 }
 
-func (w Worktime) validate() error {
-	if w.StartDate.UnixMilli() < data.Now().UnixMilli() {
-		return fmt.Errorf("cannot set work time in the past")
+// returns the time zone of the doctor
+func (s *worktimeService) location(doctorID int) (*time.Location, error) {
+	doctor, err := s.repo.Doctors.GetOne(doctorID)
+	if err != nil {
+		return nil, err
+	}
+	if doctor.ID == 0 {
+		return nil, doctorNotFound(doctorID)
+	}
+
+	return doctor.Location(), nil
+}
+
+// work time is set in the wall clock of the doctor's time zone
+func (w Worktime) validate(loc *time.Location, now time.Time) error {
+	if w.StartDate == nil || w.EndDate == nil {
+		return invalidField("start_date", "start and end dates are required")
+	}
+
+	fields := make([]FieldError, 0)
+	if data.FromWall(w.StartDate.UnixMilli(), loc) < now.UnixMilli() {
+		fields = append(fields, FieldError{Field: "start_date", Message: "cannot set work time in the past"})
 	}
 	if w.StartDate.UnixMilli() >= w.EndDate.UnixMilli() {
-		return fmt.Errorf("invalid time interval")
+		fields = append(fields, FieldError{Field: "end_date", Message: "invalid time interval"})
+	}
+	if w.Rrule != "" {
+		if _, err := parseRule(w.Rrule); err != nil {
+			fields = append(fields, FieldError{Field: "rrule", Message: fmt.Sprintf("invalid recurrence rule: %v", err)})
+		}
 	}
-	return nil
+	return invalid(fields...)
 }
 
 // in minutes